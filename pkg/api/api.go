@@ -4,13 +4,40 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend/httpclient"
 )
 
+// Default limits used when no explicit timeouts are configured
+const (
+	DefaultTimeout      = 10 * time.Second
+	DefaultQueryTimeout = 60 * time.Second
+)
+
 // API is used to communicate with the historian API
 type API struct {
-	client *http.Client
+	client       *http.Client
+	timeout      time.Duration
+	queryTimeout time.Duration
+	cache        *metadataCache
+}
+
+// Options configures the connection to the historian API
+type Options struct {
+	URL          string
+	Token        string
+	Organization string
+	// Timeout limits connecting to the historian and metadata/resource calls
+	Timeout time.Duration
+	// QueryTimeout limits measurement, raw and event queries
+	QueryTimeout time.Duration
+	// TLS holds the optional TLS configuration, nil uses the system defaults
+	TLS *httpclient.TLSOptions
+	// Retry configures retries and the circuit breaker, nil uses DefaultRetryOptions
+	Retry *RetryOptions
+	// MetadataCacheTTL is how long metadata like assets and event types is cached, 0 disables caching
+	MetadataCacheTTL time.Duration
 }
 
 // baseURLRoundTripper wraps an http.RoundTripper to prepend a base URL to all requests
@@ -43,18 +70,45 @@ func (b *baseURLRoundTripper) RoundTrip(req *http.Request) (*http.Response, erro
 	return b.next.RoundTrip(req)
 }
 
-// NewAPIWithToken creates a new instance of API using a token
+// NewAPIWithToken creates a new instance of API using a token and the default timeouts
 func NewAPIWithToken(baseURL string, token string, organization string) (*API, error) {
+	return NewAPI(Options{
+		URL:          baseURL,
+		Token:        token,
+		Organization: organization,
+		Timeout:      DefaultTimeout,
+		QueryTimeout: DefaultQueryTimeout,
+	})
+}
+
+// NewAPI creates a new instance of API using the given options
+func NewAPI(options Options) (*API, error) {
 	headers := http.Header{
-		"x-organization-uuid": []string{organization},
-		"Authorization":       []string{"Bearer " + token},
+		"x-organization-uuid": []string{options.Organization},
+		"Authorization":       []string{"Bearer " + options.Token},
 	}
-	parsedBaseURL, err := url.Parse(baseURL)
+	parsedBaseURL, err := url.Parse(options.URL)
 	if err != nil {
 		return nil, err
 	}
 
+	// The overall deadline differs between metadata calls and queries, so it is applied
+	// per request in API.do instead of on the client. Only connection setup is bounded here.
+	timeouts := httpclient.DefaultTimeoutOptions
+	timeouts.Timeout = 0
+	if options.Timeout > 0 {
+		timeouts.DialTimeout = options.Timeout
+		timeouts.TLSHandshakeTimeout = options.Timeout
+	}
+
+	retryOptions := DefaultRetryOptions
+	if options.Retry != nil {
+		retryOptions = *options.Retry
+	}
+
 	client, err := httpclient.New(httpclient.Options{
+		Timeouts: &timeouts,
+		TLS:      options.TLS,
 		Middlewares: []httpclient.Middleware{
 			httpclient.MiddlewareFunc(func(_ httpclient.Options, next http.RoundTripper) http.RoundTripper {
 				return &baseURLRoundTripper{
@@ -63,12 +117,18 @@ func NewAPIWithToken(baseURL string, token string, organization string) (*API, e
 					next:    next,
 				}
 			}),
+			newRetryMiddleware(retryOptions),
 		},
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	api := &API{client}
+	api := &API{
+		client:       client,
+		timeout:      options.Timeout,
+		queryTimeout: options.QueryTimeout,
+		cache:        newMetadataCache(options.MetadataCacheTTL),
+	}
 	return api, nil
 }
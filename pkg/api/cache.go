@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// metadataCache caches metadata responses of the historian for a limited time.
+// Concurrent misses for the same key share a single request.
+type metadataCache struct {
+	ttl   time.Duration
+	group singleflight.Group
+
+	mu      sync.Mutex
+	entries map[string]metadataCacheEntry
+	// generation is incremented on every flush, so responses of requests that were
+	// in flight during a flush are not stored
+	generation uint64
+}
+
+type bypassCacheKey struct{}
+
+// WithoutCache returns a context for which metadata is always fetched from the historian,
+// the fresh response still replaces the cached one
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassCacheKey{}, true)
+}
+
+// metadataCacheEntry holds a JSON encoded response, every caller decodes its own copy so
+// nested maps, slices and pointers of the cached values are never shared
+type metadataCacheEntry struct {
+	value  []byte
+	expiry time.Time
+}
+
+func newMetadataCache(ttl time.Duration) *metadataCache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &metadataCache{
+		ttl:     ttl,
+		entries: map[string]metadataCacheEntry{},
+	}
+}
+
+// get returns the cached value for key and the current generation
+func (c *metadataCache) get(key string) ([]byte, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiry) {
+		return nil, c.generation, false
+	}
+	return entry.value, c.generation, true
+}
+
+// set stores value for key unless the cache was flushed since generation was read
+func (c *metadataCache) set(generation uint64, key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expiry) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = metadataCacheEntry{value: value, expiry: now.Add(c.ttl)}
+}
+
+// flush removes all cached values
+func (c *metadataCache) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[string]metadataCacheEntry{}
+	c.generation++
+}
+
+// cached returns the cached response for key, calling fetch on a miss. The shared request
+// is detached from the cancellation of the caller that started it, it stays bounded by the
+// configured timeout. Callers receive their own deep copy of the response.
+func cached[S ~[]E, E any](ctx context.Context, c *metadataCache, key string, fetch func(context.Context) (S, error)) (S, error) {
+	if c == nil {
+		return fetch(ctx)
+	}
+
+	value, generation, ok := c.get(key)
+	if bypass, _ := ctx.Value(bypassCacheKey{}).(bool); bypass {
+		result, err := fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if encoded, err := json.Marshal(result); err == nil {
+			c.set(generation, key, encoded)
+		}
+		return result, nil
+	}
+	if ok {
+		return decodeCached[S](value)
+	}
+
+	resultChan := c.group.DoChan(fmt.Sprintf("%d/%s", generation, key), func() (interface{}, error) {
+		result, err := fetch(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+
+		c.set(generation, key, encoded)
+		return encoded, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-resultChan:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return decodeCached[S](result.Val.([]byte))
+	}
+}
+
+// decodeCached decodes a cached response into values that share no memory with the cache
+func decodeCached[S ~[]E, E any](value []byte) (S, error) {
+	var result S
+	if err := json.Unmarshal(value, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FlushCache removes all cached metadata
+func (api *API) FlushCache() {
+	if api.cache != nil {
+		api.cache.flush()
+	}
+}
@@ -0,0 +1,140 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataCache(t *testing.T) {
+	t.Parallel()
+
+	startServer := func(t *testing.T) (*httptest.Server, *atomic.Int32) {
+		t.Helper()
+		var requests atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			requests.Add(1)
+			time.Sleep(20 * time.Millisecond)
+			_, _ = w.Write([]byte(`[{"Name":"a1"}]`))
+		}))
+		t.Cleanup(srv.Close)
+		return srv, &requests
+	}
+
+	t.Run("concurrent misses share a single request", func(t *testing.T) {
+		t.Parallel()
+		srv, requests := startServer(t)
+		client, err := api.NewAPI(api.Options{URL: srv.URL, MetadataCacheTTL: time.Minute})
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Go(func() {
+				assets, err := client.GetAssets(context.Background(), "Path=site")
+				assert.NoError(t, err)
+				assert.Len(t, assets, 1)
+			})
+		}
+		wg.Wait()
+
+		_, err = client.GetAssets(context.Background(), "Path=site")
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), requests.Load())
+
+		_, err = client.GetAssets(context.Background(), "Path=other")
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), requests.Load(), "different queries must not share an entry")
+	})
+
+	t.Run("flush and expiry refetch", func(t *testing.T) {
+		t.Parallel()
+		srv, requests := startServer(t)
+		client, err := api.NewAPI(api.Options{URL: srv.URL, MetadataCacheTTL: 50 * time.Millisecond})
+		require.NoError(t, err)
+
+		_, err = client.GetEventTypes(context.Background(), "")
+		require.NoError(t, err)
+		client.FlushCache()
+		_, err = client.GetEventTypes(context.Background(), "")
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), requests.Load())
+
+		time.Sleep(60 * time.Millisecond)
+		_, err = client.GetEventTypes(context.Background(), "")
+		require.NoError(t, err)
+		assert.Equal(t, int32(3), requests.Load())
+	})
+
+	t.Run("bypass fetches and refreshes the entry", func(t *testing.T) {
+		t.Parallel()
+		srv, requests := startServer(t)
+		client, err := api.NewAPI(api.Options{URL: srv.URL, MetadataCacheTTL: time.Minute})
+		require.NoError(t, err)
+
+		_, err = client.GetMeasurements(context.Background(), "")
+		require.NoError(t, err)
+		_, err = client.GetMeasurements(api.WithoutCache(context.Background()), "")
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), requests.Load())
+
+		_, err = client.GetMeasurements(context.Background(), "")
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), requests.Load(), "the bypassing response must be cached")
+	})
+
+	t.Run("callers get their own copy", func(t *testing.T) {
+		t.Parallel()
+		srv, _ := startServer(t)
+		client, err := api.NewAPI(api.Options{URL: srv.URL, MetadataCacheTTL: time.Minute})
+		require.NoError(t, err)
+
+		assets, err := client.GetAssets(context.Background(), "")
+		require.NoError(t, err)
+		assets[0].Name = "changed"
+
+		assets, err = client.GetAssets(context.Background(), "")
+		require.NoError(t, err)
+		assert.Equal(t, "a1", assets[0].Name)
+	})
+
+	t.Run("callers do not share nested values", func(t *testing.T) {
+		t.Parallel()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(`[{"Name":"m1","Attributes":{"unit":"bar","limits":[1,2]}}]`))
+		}))
+		t.Cleanup(srv.Close)
+		client, err := api.NewAPI(api.Options{URL: srv.URL, MetadataCacheTTL: time.Minute})
+		require.NoError(t, err)
+
+		measurements, err := client.GetMeasurements(context.Background(), "")
+		require.NoError(t, err)
+		measurements[0].Attributes["unit"] = "changed"
+		measurements[0].Attributes["limits"].([]interface{})[0] = 10.0
+
+		measurements, err = client.GetMeasurements(context.Background(), "")
+		require.NoError(t, err)
+		assert.Equal(t, "bar", measurements[0].Attributes["unit"])
+		assert.Equal(t, []interface{}{1.0, 2.0}, measurements[0].Attributes["limits"])
+	})
+
+	t.Run("zero ttl disables caching", func(t *testing.T) {
+		t.Parallel()
+		srv, requests := startServer(t)
+		client, err := api.NewAPI(api.Options{URL: srv.URL})
+		require.NoError(t, err)
+
+		for range 3 {
+			_, err = client.GetAssetProperties(context.Background(), "")
+			require.NoError(t, err)
+		}
+		assert.Equal(t, int32(3), requests.Load())
+	})
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxErrorBodySize limits how much of an error response is read
+const maxErrorBodySize = 1 << 20
+
+// Historian error kinds, use errors.Is to check the kind of an error returned by the API
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrValidation   = errors.New("validation failed")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrServer       = errors.New("historian server error")
+)
+
+// HTTPError represents an HTTP error response of the historian
+type HTTPError struct {
+	StatusCode int
+	// Kind is one of the historian error kinds, nil when the status code does not match any of them
+	Kind error
+	// Message is the error message decoded from the response, empty when the response has none
+	Message string
+	// Details are the individual problems reported by a validation error
+	Details []string
+	// RetryAfter is set for rate limited responses that tell when to try again
+	RetryAfter time.Duration
+	// Body is the raw response body, it is meant for logging and can be large
+	Body string
+}
+
+// Error implements the error interface. It only contains the decoded message, the body is left out.
+func (e *HTTPError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		sb.WriteString(": ")
+		sb.WriteString(e.Message)
+	}
+	if len(e.Details) > 0 {
+		sb.WriteString(" (")
+		sb.WriteString(strings.Join(e.Details, "; "))
+		sb.WriteString(")")
+	}
+	if e.RetryAfter > 0 {
+		fmt.Fprintf(&sb, ", retry after %s", e.RetryAfter)
+	}
+	return sb.String()
+}
+
+// Unwrap returns the error kind, so errors.Is(err, ErrNotFound) works
+func (e *HTTPError) Unwrap() error {
+	return e.Kind
+}
+
+// errorPayload is the JSON error response of the historian
+type errorPayload struct {
+	Message string          `json:"message"`
+	Error   string          `json:"error"`
+	Detail  string          `json:"detail"`
+	Errors  json.RawMessage `json:"errors"`
+}
+
+// fieldError is a single validation problem reported by the historian
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// handleHTTPError processes HTTP error responses
+func handleHTTPError(resp *http.Response) error {
+	// Read and parse the error response body
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err != nil {
+		return err
+	}
+
+	httpError := &HTTPError{
+		StatusCode: resp.StatusCode,
+		Kind:       errorKind(resp.StatusCode),
+		Body:       string(body),
+	}
+	httpError.Message, httpError.Details = decodeErrorBody(body)
+	if httpError.Kind == ErrRateLimited {
+		httpError.RetryAfter, _ = parseRetryAfter(resp)
+	}
+
+	return httpError
+}
+
+// errorKind returns the historian error kind of a status code
+func errorKind(statusCode int) error {
+	switch {
+	case statusCode == http.StatusNotFound:
+		return ErrNotFound
+	case statusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case statusCode == http.StatusForbidden:
+		return ErrForbidden
+	case statusCode == http.StatusBadRequest, statusCode == http.StatusUnprocessableEntity:
+		return ErrValidation
+	case statusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case statusCode >= http.StatusInternalServerError:
+		return ErrServer
+	default:
+		return nil
+	}
+}
+
+// decodeErrorBody returns the message and validation details of an error response body.
+// Bodies that are not JSON, like the HTML pages of a reverse proxy, give no message.
+func decodeErrorBody(body []byte) (string, []string) {
+	payload := errorPayload{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", nil
+	}
+
+	message := payload.Message
+	for _, alternative := range []string{payload.Error, payload.Detail} {
+		if message == "" {
+			message = alternative
+		}
+	}
+
+	return message, decodeErrorDetails(payload.Errors)
+}
+
+// decodeErrorDetails decodes the validation errors, which are either a list of messages,
+// a list of field errors or a map of field names to messages
+func decodeErrorDetails(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	messages := []string{}
+	if err := json.Unmarshal(raw, &messages); err == nil {
+		return messages
+	}
+
+	fieldErrors := []fieldError{}
+	if err := json.Unmarshal(raw, &fieldErrors); err == nil {
+		details := make([]string, 0, len(fieldErrors))
+		for _, fieldError := range fieldErrors {
+			details = append(details, formatFieldError(fieldError.Field, fieldError.Message))
+		}
+		return details
+	}
+
+	fieldMessages := map[string]string{}
+	if err := json.Unmarshal(raw, &fieldMessages); err == nil {
+		details := make([]string, 0, len(fieldMessages))
+		for field, message := range fieldMessages {
+			details = append(details, formatFieldError(field, message))
+		}
+		slices.Sort(details)
+		return details
+	}
+
+	return nil
+}
+
+func formatFieldError(field, message string) string {
+	if field == "" {
+		return message
+	}
+	return field + ": " + message
+}
@@ -0,0 +1,123 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPError(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name            string
+		status          int
+		body            string
+		header          http.Header
+		expectedKind    error
+		expectedMessage string
+		expectedDetails []string
+		expectedError   string
+	}{
+		{
+			name:            "not found with message",
+			status:          http.StatusNotFound,
+			body:            `{"message": "measurement not found"}`,
+			expectedKind:    api.ErrNotFound,
+			expectedMessage: "measurement not found",
+			expectedError:   "Not Found: measurement not found",
+		},
+		{
+			name:            "unauthorized with error field",
+			status:          http.StatusUnauthorized,
+			body:            `{"error": "token expired"}`,
+			expectedKind:    api.ErrUnauthorized,
+			expectedMessage: "token expired",
+			expectedError:   "Unauthorized: token expired",
+		},
+		{
+			name:          "forbidden without body",
+			status:        http.StatusForbidden,
+			expectedKind:  api.ErrForbidden,
+			expectedError: "Forbidden",
+		},
+		{
+			name:            "validation with field errors",
+			status:          http.StatusBadRequest,
+			body:            `{"message": "invalid query", "errors": [{"field": "Start", "message": "is required"}, {"field": "End", "message": "before start"}]}`,
+			expectedKind:    api.ErrValidation,
+			expectedMessage: "invalid query",
+			expectedDetails: []string{"Start: is required", "End: before start"},
+			expectedError:   "Bad Request: invalid query (Start: is required; End: before start)",
+		},
+		{
+			name:            "validation with a map of errors",
+			status:          http.StatusUnprocessableEntity,
+			body:            `{"errors": {"Start": "is required", "Aggregation": "unknown"}}`,
+			expectedKind:    api.ErrValidation,
+			expectedDetails: []string{"Aggregation: unknown", "Start: is required"},
+			expectedError:   "Unprocessable Entity (Aggregation: unknown; Start: is required)",
+		},
+		{
+			name:            "rate limited with Retry-After",
+			status:          http.StatusTooManyRequests,
+			body:            `{"message": "slow down"}`,
+			header:          http.Header{"Retry-After": []string{"120"}},
+			expectedKind:    api.ErrRateLimited,
+			expectedMessage: "slow down",
+			expectedError:   "Too Many Requests: slow down, retry after 2m0s",
+		},
+		{
+			name:          "server error with an HTML body",
+			status:        http.StatusInternalServerError,
+			body:          "<html><body>internal error</body></html>",
+			expectedKind:  api.ErrServer,
+			expectedError: "Internal Server Error",
+		},
+		{
+			name:            "other status",
+			status:          http.StatusConflict,
+			body:            `{"detail": "already exists"}`,
+			expectedMessage: "already exists",
+			expectedError:   "Conflict: already exists",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				for key, values := range tc.header {
+					w.Header()[key] = values
+				}
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			t.Cleanup(srv.Close)
+
+			client, err := api.NewAPI(api.Options{URL: srv.URL, Timeout: time.Second, Retry: &api.RetryOptions{}})
+			require.NoError(t, err)
+
+			_, err = client.GetAssets(context.Background(), "")
+			var httpError *api.HTTPError
+			require.True(t, errors.As(err, &httpError), "expected an HTTPError, got %v", err)
+			assert.Equal(t, tc.status, httpError.StatusCode)
+			assert.Equal(t, tc.body, httpError.Body)
+			assert.Equal(t, tc.expectedMessage, httpError.Message)
+			assert.Equal(t, tc.expectedDetails, httpError.Details)
+			assert.Equal(t, tc.expectedError, err.Error())
+			if tc.expectedKind != nil {
+				assert.ErrorIs(t, err, tc.expectedKind)
+			} else {
+				assert.Nil(t, httpError.Kind)
+			}
+		})
+	}
+}
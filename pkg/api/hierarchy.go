@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"strings"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/google/uuid"
+)
+
+// RecursiveAssetSuffix selects an asset and all of its descendants, e.g. "Site\Line 1/**"
+const RecursiveAssetSuffix = "/**"
+
+// AssetHierarchyOptions controls which descendants of the selected assets are included
+type AssetHierarchyOptions struct {
+	// Recursive includes the descendants of every selected asset, not only those selected with RecursiveAssetSuffix
+	Recursive bool
+	// MaxDepth limits how many levels below a selected asset are included, 0 means no limit
+	MaxDepth int
+}
+
+// GetFilteredAssetsWithDescendants returns the assets that match the given asset strings, like GetFilteredAssets.
+// Asset strings ending with RecursiveAssetSuffix, or all of them when options.Recursive is set, also select
+// the descendants of the matching assets, found by walking the ParentUUID of every asset.
+func (api *API) GetFilteredAssetsWithDescendants(ctx context.Context, assetStrings []string, options AssetHierarchyOptions, historianInfo *schemas.HistorianInfo) (map[uuid.UUID]schemas.Asset, error) {
+	plainAssetStrings := make([]string, 0, len(assetStrings))
+	recursiveAssetStrings := make([]string, 0, len(assetStrings))
+	for _, assetString := range assetStrings {
+		if trimmed, ok := strings.CutSuffix(assetString, RecursiveAssetSuffix); ok {
+			recursiveAssetStrings = append(recursiveAssetStrings, trimmed)
+		} else if options.Recursive {
+			recursiveAssetStrings = append(recursiveAssetStrings, assetString)
+		} else {
+			plainAssetStrings = append(plainAssetStrings, assetString)
+		}
+	}
+
+	assets, err := api.GetFilteredAssets(ctx, plainAssetStrings, historianInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	roots, err := api.GetFilteredAssets(ctx, recursiveAssetStrings, historianInfo)
+	if err != nil || len(roots) == 0 {
+		return assets, err
+	}
+
+	allAssets, err := api.GetAssets(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	for assetUUID, asset := range descendantAssets(roots, allAssets, options.MaxDepth) {
+		assets[assetUUID] = asset
+	}
+	return assets, nil
+}
+
+// descendantAssets returns the roots and their descendants up to maxDepth levels below them, 0 means no limit
+func descendantAssets(roots map[uuid.UUID]schemas.Asset, allAssets []schemas.Asset, maxDepth int) map[uuid.UUID]schemas.Asset {
+	children := map[uuid.UUID][]schemas.Asset{}
+	for _, asset := range allAssets {
+		if asset.ParentUUID != nil {
+			children[*asset.ParentUUID] = append(children[*asset.ParentUUID], asset)
+		}
+	}
+
+	result := make(map[uuid.UUID]schemas.Asset, len(roots))
+	level := make([]uuid.UUID, 0, len(roots))
+	for assetUUID, asset := range roots {
+		result[assetUUID] = asset
+		level = append(level, assetUUID)
+	}
+
+	// The visited check guards against cycles in the hierarchy
+	for depth := 1; len(level) > 0 && (maxDepth <= 0 || depth <= maxDepth); depth++ {
+		nextLevel := []uuid.UUID{}
+		for _, parentUUID := range level {
+			for _, child := range children[parentUUID] {
+				if _, visited := result[child.UUID]; visited {
+					continue
+				}
+				result[child.UUID] = child
+				nextLevel = append(nextLevel, child.UUID)
+			}
+		}
+		level = nextLevel
+	}
+
+	return result
+}
@@ -0,0 +1,113 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/api"
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetFilteredAssetsWithDescendants(t *testing.T) {
+	t.Parallel()
+
+	// site
+	// ├── line1
+	// │   ├── machine1
+	// │   │   └── sensor1
+	// │   └── machine2
+	// └── line2
+	newAsset := func(name, path string, parent *schemas.Asset) schemas.Asset {
+		asset := schemas.Asset{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: name}, AssetPath: path}
+		if parent != nil {
+			asset.ParentUUID = &parent.UUID
+		}
+		return asset
+	}
+	site := newAsset("site", "site", nil)
+	line1 := newAsset("line1", "site\\line1", &site)
+	line2 := newAsset("line2", "site\\line2", &site)
+	machine1 := newAsset("machine1", "site\\line1\\machine1", &line1)
+	machine2 := newAsset("machine2", "site\\line1\\machine2", &line1)
+	sensor1 := newAsset("sensor1", "site\\line1\\machine1\\sensor1", &machine1)
+	allAssets := []schemas.Asset{site, line1, line2, machine1, machine2, sensor1}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(allAssets)
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := api.NewAPIWithToken(srv.URL, "tok", "org")
+	require.NoError(t, err)
+
+	names := func(assets map[uuid.UUID]schemas.Asset) []string {
+		result := []string{}
+		for asset := range maps.Values(assets) {
+			result = append(result, asset.Name)
+		}
+		slices.Sort(result)
+		return result
+	}
+
+	testCases := []struct {
+		name         string
+		assetStrings []string
+		options      api.AssetHierarchyOptions
+		expected     []string
+	}{
+		{
+			name:         "without recursion only the asset is selected",
+			assetStrings: []string{"site\\line1"},
+			expected:     []string{"line1"},
+		},
+		{
+			name:         "path suffix selects all descendants",
+			assetStrings: []string{"site\\line1/**"},
+			expected:     []string{"line1", "machine1", "machine2", "sensor1"},
+		},
+		{
+			name:         "uuid with suffix",
+			assetStrings: []string{site.UUID.String() + "/**"},
+			expected:     []string{"line1", "line2", "machine1", "machine2", "sensor1", "site"},
+		},
+		{
+			name:         "recursive flag applies to every asset",
+			assetStrings: []string{"site\\line1\\machine1", "site\\line2"},
+			options:      api.AssetHierarchyOptions{Recursive: true},
+			expected:     []string{"line2", "machine1", "sensor1"},
+		},
+		{
+			name:         "maximum depth",
+			assetStrings: []string{"site/**"},
+			options:      api.AssetHierarchyOptions{MaxDepth: 1},
+			expected:     []string{"line1", "line2", "site"},
+		},
+		{
+			name:         "mixed plain and recursive asset strings",
+			assetStrings: []string{"site\\line2", "site\\line1\\machine1/**"},
+			expected:     []string{"line2", "machine1", "sensor1"},
+		},
+		{
+			name:         "unknown asset",
+			assetStrings: []string{"other/**"},
+			expected:     []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assets, err := client.GetFilteredAssetsWithDescendants(context.Background(), tc.assetStrings, tc.options, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, names(assets))
+		})
+	}
+}
@@ -14,33 +14,35 @@ import (
 
 // GetMeasurements calls get measurements in the historian API
 func (api *API) GetMeasurements(ctx context.Context, query string) ([]schemas.Measurement, error) {
-	measurements := []schemas.Measurement{}
-
 	queryURL, err := AppendEscapedQuery("/api/measurements", query)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := newHTTPRequest(ctx, "GET", queryURL, nil)
-	if err != nil {
-		return nil, err
-	}
+	return cached(ctx, api.cache, queryURL, func(ctx context.Context) ([]schemas.Measurement, error) {
+		measurements := []schemas.Measurement{}
 
-	resp, err := api.client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+		req, err := newHTTPRequest(ctx, "GET", queryURL, nil)
+		if err != nil {
+			return nil, err
+		}
 
-	if resp.StatusCode >= 300 {
-		return nil, handleHTTPError(resp)
-	}
+		resp, err := api.do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
 
-	if err := json.NewDecoder(resp.Body).Decode(&measurements); err != nil {
-		return nil, err
-	}
+		if resp.StatusCode >= 300 {
+			return nil, handleHTTPError(resp)
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&measurements); err != nil {
+			return nil, err
+		}
 
-	return measurements, nil
+		return measurements, nil
+	})
 }
 
 // GetMeasurement calls get measurement in the historian API
@@ -52,7 +54,7 @@ func (api *API) GetMeasurement(ctx context.Context, uuid string) (schemas.Measur
 		return measurement, err
 	}
 
-	resp, err := api.client.Do(req)
+	resp, err := api.do(req)
 	if err != nil {
 		return measurement, err
 	}
@@ -78,7 +80,7 @@ func (api *API) GetCollectors(ctx context.Context) ([]schemas.Collector, error)
 		return nil, err
 	}
 
-	resp, err := api.client.Do(req)
+	resp, err := api.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -97,157 +99,167 @@ func (api *API) GetCollectors(ctx context.Context) ([]schemas.Collector, error)
 
 // GetTimeseriesDatabases calls get timeseries databases in the historian API
 func (api *API) GetTimeseriesDatabases(ctx context.Context, query string) ([]schemas.TimeseriesDatabase, error) {
-	timeseriesDatabases := []schemas.TimeseriesDatabase{}
-
 	queryURL, err := AppendEscapedQuery("/api/timeseries-databases", query)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := newHTTPRequest(ctx, "GET", queryURL, nil)
-	if err != nil {
-		return nil, err
-	}
+	return cached(ctx, api.cache, queryURL, func(ctx context.Context) ([]schemas.TimeseriesDatabase, error) {
+		timeseriesDatabases := []schemas.TimeseriesDatabase{}
 
-	resp, err := api.client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+		req, err := newHTTPRequest(ctx, "GET", queryURL, nil)
+		if err != nil {
+			return nil, err
+		}
 
-	if resp.StatusCode >= 300 {
-		return nil, handleHTTPError(resp)
-	}
+		resp, err := api.do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
 
-	if err := json.NewDecoder(resp.Body).Decode(&timeseriesDatabases); err != nil {
-		return nil, err
-	}
+		if resp.StatusCode >= 300 {
+			return nil, handleHTTPError(resp)
+		}
 
-	return timeseriesDatabases, nil
+		if err := json.NewDecoder(resp.Body).Decode(&timeseriesDatabases); err != nil {
+			return nil, err
+		}
+
+		return timeseriesDatabases, nil
+	})
 }
 
 // GetAssets calls get assets in the historian API
 func (api *API) GetAssets(ctx context.Context, query string) ([]schemas.Asset, error) {
-	assets := []schemas.Asset{}
-
 	queryURL, err := AppendEscapedQuery("/api/assets", query)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := newHTTPRequest(ctx, "GET", queryURL, nil)
-	if err != nil {
-		return nil, err
-	}
+	return cached(ctx, api.cache, queryURL, func(ctx context.Context) ([]schemas.Asset, error) {
+		assets := []schemas.Asset{}
 
-	resp, err := api.client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+		req, err := newHTTPRequest(ctx, "GET", queryURL, nil)
+		if err != nil {
+			return nil, err
+		}
 
-	if resp.StatusCode >= 300 {
-		return nil, handleHTTPError(resp)
-	}
+		resp, err := api.do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
 
-	if err := json.NewDecoder(resp.Body).Decode(&assets); err != nil {
-		return nil, err
-	}
+		if resp.StatusCode >= 300 {
+			return nil, handleHTTPError(resp)
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&assets); err != nil {
+			return nil, err
+		}
 
-	return assets, nil
+		return assets, nil
+	})
 }
 
 // GetAssetProperties calls get asset properties in the historian API
 func (api *API) GetAssetProperties(ctx context.Context, query string) ([]schemas.AssetProperty, error) {
-	assetProperties := []schemas.AssetProperty{}
-
 	queryURL, err := AppendEscapedQuery("/api/asset-properties", query)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := newHTTPRequest(ctx, "GET", queryURL, nil)
-	if err != nil {
-		return nil, err
-	}
+	return cached(ctx, api.cache, queryURL, func(ctx context.Context) ([]schemas.AssetProperty, error) {
+		assetProperties := []schemas.AssetProperty{}
 
-	resp, err := api.client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+		req, err := newHTTPRequest(ctx, "GET", queryURL, nil)
+		if err != nil {
+			return nil, err
+		}
 
-	if resp.StatusCode >= 300 {
-		return nil, handleHTTPError(resp)
-	}
+		resp, err := api.do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
 
-	if err := json.NewDecoder(resp.Body).Decode(&assetProperties); err != nil {
-		return nil, err
-	}
+		if resp.StatusCode >= 300 {
+			return nil, handleHTTPError(resp)
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&assetProperties); err != nil {
+			return nil, err
+		}
 
-	return assetProperties, nil
+		return assetProperties, nil
+	})
 }
 
 // GetEventTypes calls get event types in the historian API
 func (api *API) GetEventTypes(ctx context.Context, query string) ([]schemas.EventType, error) {
-	eventTypes := []schemas.EventType{}
-
 	queryURL, err := AppendEscapedQuery("/api/event-types", query)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := newHTTPRequest(ctx, "GET", queryURL, nil)
-	if err != nil {
-		return nil, err
-	}
+	return cached(ctx, api.cache, queryURL, func(ctx context.Context) ([]schemas.EventType, error) {
+		eventTypes := []schemas.EventType{}
 
-	resp, err := api.client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+		req, err := newHTTPRequest(ctx, "GET", queryURL, nil)
+		if err != nil {
+			return nil, err
+		}
 
-	if resp.StatusCode >= 300 {
-		return nil, handleHTTPError(resp)
-	}
+		resp, err := api.do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
 
-	if err := json.NewDecoder(resp.Body).Decode(&eventTypes); err != nil {
-		return nil, err
-	}
+		if resp.StatusCode >= 300 {
+			return nil, handleHTTPError(resp)
+		}
 
-	return eventTypes, nil
+		if err := json.NewDecoder(resp.Body).Decode(&eventTypes); err != nil {
+			return nil, err
+		}
+
+		return eventTypes, nil
+	})
 }
 
 // GetEventTypeProperties calls get event type properties in the historian API
 func (api *API) GetEventTypeProperties(ctx context.Context, query string) ([]schemas.EventTypeProperty, error) {
-	eventTypeProperties := []schemas.EventTypeProperty{}
-
 	queryURL, err := AppendEscapedQuery("/api/event-type-properties", query)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := newHTTPRequest(ctx, "GET", queryURL, nil)
-	if err != nil {
-		return nil, err
-	}
+	return cached(ctx, api.cache, queryURL, func(ctx context.Context) ([]schemas.EventTypeProperty, error) {
+		eventTypeProperties := []schemas.EventTypeProperty{}
 
-	resp, err := api.client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+		req, err := newHTTPRequest(ctx, "GET", queryURL, nil)
+		if err != nil {
+			return nil, err
+		}
 
-	if resp.StatusCode >= 300 {
-		return nil, handleHTTPError(resp)
-	}
+		resp, err := api.do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
 
-	if err := json.NewDecoder(resp.Body).Decode(&eventTypeProperties); err != nil {
-		return nil, err
-	}
+		if resp.StatusCode >= 300 {
+			return nil, handleHTTPError(resp)
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&eventTypeProperties); err != nil {
+			return nil, err
+		}
 
-	return eventTypeProperties, nil
+		return eventTypeProperties, nil
+	})
 }
 
 // GetEventConfigurations calls get event configurations in the historian API
@@ -259,7 +271,7 @@ func (api *API) GetEventConfigurations(ctx context.Context) ([]schemas.EventConf
 		return nil, err
 	}
 
-	resp, err := api.client.Do(req)
+	resp, err := api.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -285,7 +297,7 @@ func (api *API) GetInfo(ctx context.Context) (schemas.HistorianInfo, error) {
 		return info, err
 	}
 
-	resp, err := api.client.Do(req)
+	resp, err := api.do(req)
 	if err != nil {
 		return info, err
 	}
@@ -304,7 +316,8 @@ func (api *API) GetInfo(ctx context.Context) (schemas.HistorianInfo, error) {
 
 // GetDistinctEventPropertyValues calls get distinct event property values in the historian API
 func (api *API) GetDistinctEventPropertyValues(ctx context.Context, eventTypePropertyUUID string, request schemas.EventPropertyValuesRequest) ([]interface{}, error) {
-	assets, err := api.GetFilteredAssets(ctx, request.Assets, &request.HistorianInfo)
+	hierarchyOptions := AssetHierarchyOptions{Recursive: request.Recursive, MaxDepth: request.MaxDepth}
+	assets, err := api.GetFilteredAssetsWithDescendants(ctx, request.Assets, hierarchyOptions, &request.HistorianInfo)
 	if err != nil {
 		return nil, err
 	}
@@ -345,7 +358,7 @@ func (api *API) GetDistinctEventPropertyValues(ctx context.Context, eventTypePro
 		return nil, err
 	}
 
-	resp, err := api.client.Do(req)
+	resp, err := api.do(req)
 	if err != nil {
 		return nil, err
 	}
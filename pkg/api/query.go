@@ -7,12 +7,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
+	"slices"
+	"strings"
 
 	arrow_pb "github.com/factrylabs/factry-historian-datasource.git/pkg/proto"
 	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
 	"github.com/go-playground/form"
+	"github.com/google/uuid"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"google.golang.org/protobuf/proto"
 )
@@ -64,9 +68,10 @@ func (api *API) MeasurementQuery(ctx context.Context, query schemas.Query) (data
 	if err != nil {
 		return nil, err
 	}
+	req = withIdempotent(req)
 	req.Header.Set(HeaderAccept, MIMEApplicationProtobuf)
 
-	resp, err := api.client.Do(req)
+	resp, err := api.doQuery(req)
 	if err != nil {
 		return nil, err
 	}
@@ -85,9 +90,10 @@ func (api *API) RawQuery(ctx context.Context, timeseriesDatabaseUUID string, que
 	if err != nil {
 		return nil, err
 	}
+	req = withIdempotent(req)
 	req.Header.Set(HeaderAccept, MIMEApplicationProtobuf)
 
-	resp, err := api.client.Do(req)
+	resp, err := api.doQuery(req)
 	if err != nil {
 		return nil, err
 	}
@@ -95,9 +101,63 @@ func (api *API) RawQuery(ctx context.Context, timeseriesDatabaseUUID string, que
 	return handleDataFramesResponse(resp)
 }
 
-// EventQuery executes an event query
+// eventQueryPageSize is the number of events EventQuery requests at once
+const eventQueryPageSize = 1000
+
+// ErrEventPagingStalled is returned when a page of an event query holds no events that were not returned before
+var ErrEventPagingStalled = errors.New("event query paging made no progress, more events than the page size share a start time or the historian ignores the time filter")
+
+// EventQuery executes an event query. The events are requested in pages, every page continues from the start time of
+// the last event of the previous page, so paging only relies on the time filter and order the historian already
+// supports. Events at the start time of the cursor are returned again and skipped by UUID.
 func (api *API) EventQuery(ctx context.Context, filter schemas.EventFilter) ([]schemas.Event, error) {
-	queryResult := []schemas.Event{}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = math.MaxInt
+	}
+
+	pageSize := min(limit, eventQueryPageSize)
+	pageFilter := filter
+	pageFilter.Limit = pageSize
+	events := []schemas.Event{}
+	seen := map[uuid.UUID]struct{}{}
+	for len(events) < limit {
+		pageEvents, err := api.eventQueryPage(ctx, pageFilter, pageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		added := 0
+		for _, event := range pageEvents {
+			if _, ok := seen[event.UUID]; ok || len(events) == limit {
+				continue
+			}
+			seen[event.UUID] = struct{}{}
+			events = append(events, event)
+			added++
+		}
+		if len(pageEvents) < pageSize {
+			break
+		}
+		if added == 0 {
+			return nil, ErrEventPagingStalled
+		}
+
+		cursor := pageEvents[len(pageEvents)-1].StartTime
+		if filter.Ascending {
+			if filter.StartTime == nil || cursor.After(*filter.StartTime) {
+				pageFilter.StartTime = &cursor
+			}
+		} else if filter.StopTime == nil || cursor.Before(*filter.StopTime) {
+			pageFilter.StopTime = &cursor
+		}
+	}
+
+	return events, nil
+}
+
+// eventQueryPage executes a single event query request and decodes at most maxEvents events
+func (api *API) eventQueryPage(ctx context.Context, filter schemas.EventFilter, maxEvents int) ([]schemas.Event, error) {
 	eventFilterParams, err := getEventFilter(filter)
 	if err != nil {
 		return nil, err
@@ -113,7 +173,7 @@ func (api *API) EventQuery(ctx context.Context, filter schemas.EventFilter) ([]s
 		return nil, err
 	}
 
-	resp, err := api.client.Do(req)
+	resp, err := api.doQuery(req)
 	if err != nil {
 		return nil, err
 	}
@@ -123,11 +183,34 @@ func (api *API) EventQuery(ctx context.Context, filter schemas.EventFilter) ([]s
 		return nil, handleHTTPError(resp)
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&queryResult); err != nil {
+	return decodeEvents(resp.Body, maxEvents)
+}
+
+// decodeEvents decodes a JSON array of events one event at a time, so the response is never held in memory as a
+// whole, and stops after maxEvents events
+func decodeEvents(r io.Reader, maxEvents int) ([]schemas.Event, error) {
+	decoder := json.NewDecoder(r)
+	token, err := decoder.Token()
+	if err != nil {
 		return nil, err
 	}
+	if token == nil {
+		return []schemas.Event{}, nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("expected an array of events, got %v", token)
+	}
 
-	return queryResult, nil
+	events := []schemas.Event{}
+	for decoder.More() && len(events) < maxEvents {
+		event := schemas.Event{}
+		if err := decoder.Decode(&event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
 }
 
 // GetTagKeys queries the tag keys for a measurement
@@ -138,7 +221,7 @@ func (api *API) GetTagKeys(ctx context.Context, measurementUUID string) (data.Fr
 	}
 	req.Header.Set(HeaderAccept, MIMEApplicationProtobuf)
 
-	resp, err := api.client.Do(req)
+	resp, err := api.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -154,7 +237,7 @@ func (api *API) GetTagValues(ctx context.Context, measurementUUID, tagKey string
 	}
 	req.Header.Set(HeaderAccept, MIMEApplicationProtobuf)
 
-	resp, err := api.client.Do(req)
+	resp, err := api.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -162,7 +245,45 @@ func (api *API) GetTagValues(ctx context.Context, measurementUUID, tagKey string
 	return handleDataFramesResponse(resp)
 }
 
+// ExpandMultiValuePropertyFilters turns = and != filters with several values into IN and NOT IN filters. A single value
+// in the {a,b,c} format Grafana uses for multi-value variables is split into its trimmed, non-empty values first.
+func ExpandMultiValuePropertyFilters(filters []schemas.EventPropertyValueFilter) []schemas.EventPropertyValueFilter {
+	filters = slices.Clone(filters)
+	for i := range filters {
+		if filters[i].Operator != "=" && filters[i].Operator != "!=" {
+			continue
+		}
+
+		values := filters[i].Value
+		if len(values) == 1 {
+			if value, ok := values[0].(string); ok && strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") && strings.Contains(value, ",") {
+				values = []interface{}{}
+				for _, part := range strings.Split(value[1:len(value)-1], ",") {
+					if part = strings.TrimSpace(part); part != "" {
+						values = append(values, part)
+					}
+				}
+				if len(values) == 1 {
+					filters[i].Value = values
+				}
+			}
+		}
+		if len(values) < 2 {
+			continue
+		}
+
+		operator := "IN"
+		if filters[i].Operator == "!=" {
+			operator = "NOT IN"
+		}
+		filters[i].Operator = operator
+		filters[i].Value = values
+	}
+	return filters
+}
+
 func fixPropertyFilterValues(filter schemas.EventFilter) schemas.EventFilter {
+	filter.PropertyFilter = ExpandMultiValuePropertyFilters(filter.PropertyFilter)
 	for i := range filter.PropertyFilter {
 		if filter.PropertyFilter[i].Datatype == "" {
 			filter.PropertyFilter[i].Datatype = "string"
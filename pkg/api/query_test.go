@@ -0,0 +1,148 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/api"
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandMultiValuePropertyFilters(t *testing.T) {
+	t.Parallel()
+
+	filters := []schemas.EventPropertyValueFilter{
+		{Property: "Batch", Operator: "=", Value: []interface{}{"{B1,B2}"}},
+		{Property: "Batch", Operator: "!=", Value: []interface{}{"B3", "B4"}},
+		{Property: "Batch", Operator: "=", Value: []interface{}{"{B5}"}},
+		{Property: "Amount", Operator: ">", Value: []interface{}{"{1,2}"}},
+		{Property: "Batch", Operator: "=", Value: []interface{}{"{B6, B7 ,, }"}},
+		{Property: "Batch", Operator: "=", Value: []interface{}{"{B8, }"}},
+	}
+
+	expanded := api.ExpandMultiValuePropertyFilters(filters)
+	assert.Equal(t, []schemas.EventPropertyValueFilter{
+		{Property: "Batch", Operator: "IN", Value: []interface{}{"B1", "B2"}},
+		{Property: "Batch", Operator: "NOT IN", Value: []interface{}{"B3", "B4"}},
+		{Property: "Batch", Operator: "=", Value: []interface{}{"{B5}"}},
+		{Property: "Amount", Operator: ">", Value: []interface{}{"{1,2}"}},
+		{Property: "Batch", Operator: "IN", Value: []interface{}{"B6", "B7"}},
+		{Property: "Batch", Operator: "=", Value: []interface{}{"B8"}},
+	}, expanded)
+	assert.Equal(t, "=", filters[0].Operator, "the filters of the query must not be changed")
+}
+
+func TestEventQuery_Pages(t *testing.T) {
+	t.Parallel()
+
+	// Two events share every start time, so pages end in the middle of events with the same start time
+	startTime := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	events := make([]schemas.Event, 2500)
+	for i := range events {
+		events[i] = schemas.Event{UUID: uuid.New(), StartTime: startTime.Add(time.Duration(i/2) * time.Second)}
+	}
+	descending := slices.Clone(events)
+	slices.Reverse(descending)
+
+	// startServer serves the events that start within StartTime and StopTime in the requested order, up to Limit
+	// events, and records the query of every request
+	startServer := func(t *testing.T, ignoreTimeFilter bool) (*api.API, func() []url.Values) {
+		t.Helper()
+		var mu sync.Mutex
+		var requests []url.Values
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			mu.Lock()
+			requests = append(requests, query)
+			mu.Unlock()
+
+			result := events
+			if query.Get("Ascending") != "true" {
+				result = descending
+			}
+			result = slices.DeleteFunc(slices.Clone(result), func(event schemas.Event) bool {
+				if ignoreTimeFilter {
+					return false
+				}
+				if from, err := time.Parse(time.RFC3339, query.Get("StartTime")); err == nil && event.StartTime.Before(from) {
+					return true
+				}
+				to, err := time.Parse(time.RFC3339, query.Get("StopTime"))
+				return err == nil && event.StartTime.After(to)
+			})
+			if limit, err := strconv.Atoi(query.Get("Limit")); err == nil && limit > 0 {
+				result = result[:min(limit, len(result))]
+			}
+			if err := json.NewEncoder(w).Encode(result); err != nil {
+				t.Errorf("encoding events: %v", err)
+			}
+		}))
+		t.Cleanup(srv.Close)
+
+		client, err := api.NewAPIWithToken(srv.URL, "tok", "org")
+		require.NoError(t, err)
+		return client, func() []url.Values {
+			mu.Lock()
+			defer mu.Unlock()
+			return slices.Clone(requests)
+		}
+	}
+
+	t.Run("ascending", func(t *testing.T) {
+		t.Parallel()
+		client, requests := startServer(t, false)
+		got, err := client.EventQuery(context.Background(), schemas.EventFilter{Ascending: true})
+		require.NoError(t, err)
+		assert.Equal(t, events, got)
+		require.Len(t, requests(), 3)
+		assert.Empty(t, requests()[0].Get("StartTime"))
+		assert.Equal(t, events[999].StartTime.Format(time.RFC3339), requests()[1].Get("StartTime"), "the next page starts at the last event of the page")
+	})
+
+	t.Run("descending", func(t *testing.T) {
+		t.Parallel()
+		client, requests := startServer(t, false)
+		got, err := client.EventQuery(context.Background(), schemas.EventFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, descending, got)
+		assert.Equal(t, descending[999].StartTime.Format(time.RFC3339), requests()[1].Get("StopTime"))
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		t.Parallel()
+		client, requests := startServer(t, false)
+		got, err := client.EventQuery(context.Background(), schemas.EventFilter{Ascending: true, Limit: 1200})
+		require.NoError(t, err)
+		assert.Equal(t, events[:1200], got)
+		assert.Len(t, requests(), 2)
+	})
+
+	t.Run("cursor stays within the time filter", func(t *testing.T) {
+		t.Parallel()
+		client, requests := startServer(t, false)
+		from := events[100].StartTime
+		got, err := client.EventQuery(context.Background(), schemas.EventFilter{Ascending: true, StartTime: &from})
+		require.NoError(t, err)
+		assert.Equal(t, events[100:], got)
+		assert.Equal(t, from.Format(time.RFC3339), requests()[0].Get("StartTime"))
+	})
+
+	t.Run("historian ignoring the time filter", func(t *testing.T) {
+		t.Parallel()
+		client, requests := startServer(t, true)
+		_, err := client.EventQuery(context.Background(), schemas.EventFilter{Ascending: true})
+		require.ErrorIs(t, err, api.ErrEventPagingStalled)
+		assert.Len(t, requests(), 2, "paging stops as soon as a page holds no new events")
+	})
+}
@@ -0,0 +1,274 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/httpclient"
+)
+
+// ErrCircuitOpen is returned without contacting the historian while it is considered unavailable
+var ErrCircuitOpen = errors.New("historian is unavailable, requests are paused")
+
+// maxRetryAfter is the longest Retry-After the client is willing to wait for
+const maxRetryAfter = 30 * time.Second
+
+// RetryOptions configures retrying failed requests and the circuit breaker
+type RetryOptions struct {
+	// MaxRetries is the number of times a failed request is retried, 0 disables retries
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// BreakerThreshold is the number of consecutive failures that opens the circuit breaker, 0 disables it
+	BreakerThreshold int
+	// BreakerCooldown is how long the circuit breaker stays open before a trial request is let through
+	BreakerCooldown time.Duration
+}
+
+// DefaultRetryOptions are used when no retry options are given
+var DefaultRetryOptions = RetryOptions{
+	MaxRetries:       3,
+	InitialBackoff:   200 * time.Millisecond,
+	MaxBackoff:       5 * time.Second,
+	BreakerThreshold: 5,
+	BreakerCooldown:  30 * time.Second,
+}
+
+type idempotentKey struct{}
+
+// withIdempotent marks a request that is safe to retry even though its method is not
+func withIdempotent(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), idempotentKey{}, true))
+}
+
+// isRetryable returns whether the request may be sent again
+func isRetryable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	idempotent, _ := req.Context().Value(idempotentKey{}).(bool)
+	return idempotent
+}
+
+// circuitBreaker stops sending requests after a number of consecutive failures
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// allow returns an error when the circuit is open. Once the cooldown passed a single trial request is let through.
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+
+	if now := time.Now(); now.Before(b.openUntil) || b.probing {
+		return fmt.Errorf("%w until %s", ErrCircuitOpen, b.openUntil.Format(time.RFC3339))
+	}
+
+	b.probing = true
+	return nil
+}
+
+// record registers the outcome of a request
+func (b *circuitBreaker) record(failed bool) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// release lets another trial request through without recording an outcome
+func (b *circuitBreaker) release() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// retryRoundTripper retries failed idempotent requests with exponential backoff and jitter
+type retryRoundTripper struct {
+	options RetryOptions
+	breaker *circuitBreaker
+	next    http.RoundTripper
+}
+
+// newRetryMiddleware returns a middleware that retries requests and fails fast while the circuit breaker is open
+func newRetryMiddleware(options RetryOptions) httpclient.Middleware {
+	var breaker *circuitBreaker
+	if options.BreakerThreshold > 0 {
+		breaker = &circuitBreaker{threshold: options.BreakerThreshold, cooldown: options.BreakerCooldown}
+	}
+
+	return httpclient.MiddlewareFunc(func(_ httpclient.Options, next http.RoundTripper) http.RoundTripper {
+		return &retryRoundTripper{
+			options: options,
+			breaker: breaker,
+			next:    next,
+		}
+	})
+}
+
+// RoundTrip implements http.RoundTripper. The circuit breaker records a single outcome per request, once
+// the retries are done, so a request retried a few times counts as one failure.
+func (r *retryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := r.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	resp, err := r.roundTrip(req)
+	if req.Context().Err() != nil {
+		// Running into the configured timeout counts as a failure, a caller that
+		// gave up says nothing about the historian
+		var timeoutErr *TimeoutError
+		if errors.As(context.Cause(req.Context()), &timeoutErr) {
+			r.breaker.record(true)
+		} else {
+			r.breaker.release()
+		}
+		return resp, err
+	}
+
+	r.breaker.record(err != nil || resp.StatusCode >= http.StatusInternalServerError)
+	return resp, err
+}
+
+// roundTrip sends the request, retrying it while it fails and may be sent again
+func (r *retryRoundTripper) roundTrip(req *http.Request) (*http.Response, error) {
+	retryable := isRetryable(req)
+
+	for attempt := 0; ; attempt++ {
+		resp, err := r.next.RoundTrip(req)
+		if req.Context().Err() != nil {
+			return resp, err
+		}
+
+		if !retryable || attempt >= r.options.MaxRetries || !shouldRetry(resp, err) {
+			return resp, err
+		}
+
+		wait := r.backoff(attempt)
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp); ok {
+				if retryAfter > maxRetryAfter {
+					return resp, nil
+				}
+				wait = retryAfter
+			}
+		}
+
+		if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) < wait {
+			return resp, err
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+			resp.Body.Close()
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the delay before the given retry, exponential with full jitter
+func (r *retryRoundTripper) backoff(attempt int) time.Duration {
+	backoff := r.options.InitialBackoff << attempt
+	if backoff <= 0 || backoff > r.options.MaxBackoff {
+		backoff = r.options.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return rand.N(backoff) + 1
+}
+
+// shouldRetry returns whether the outcome of a request is worth retrying
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter reads the Retry-After header of 429 and 503 responses, either in seconds or as HTTP date
+func parseRetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,183 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/api"
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFlakyServer returns a server that answers the first failures requests with status and succeeds afterwards
+func newFlakyServer(t *testing.T, failures int32, status int, retryAfter string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if requests.Add(1) <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write([]byte("[]"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+
+	retryOptions := &api.RetryOptions{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+	t.Run("retries server errors", func(t *testing.T) {
+		t.Parallel()
+		srv, requests := newFlakyServer(t, 2, http.StatusBadGateway, "")
+		client, err := api.NewAPI(api.Options{URL: srv.URL, Timeout: time.Second, Retry: retryOptions})
+		require.NoError(t, err)
+
+		_, err = client.GetAssets(context.Background(), "")
+		require.NoError(t, err)
+		assert.Equal(t, int32(3), requests.Load())
+	})
+
+	t.Run("honors Retry-After", func(t *testing.T) {
+		t.Parallel()
+		srv, requests := newFlakyServer(t, 1, http.StatusTooManyRequests, "1")
+		client, err := api.NewAPI(api.Options{URL: srv.URL, Timeout: 5 * time.Second, Retry: retryOptions})
+		require.NoError(t, err)
+
+		start := time.Now()
+		_, err = client.GetAssets(context.Background(), "")
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), requests.Load())
+		assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	})
+
+	t.Run("gives up after the maximum number of retries", func(t *testing.T) {
+		t.Parallel()
+		srv, requests := newFlakyServer(t, 10, http.StatusServiceUnavailable, "")
+		client, err := api.NewAPI(api.Options{URL: srv.URL, Timeout: time.Second, Retry: retryOptions})
+		require.NoError(t, err)
+
+		_, err = client.GetAssets(context.Background(), "")
+		require.Error(t, err)
+		assert.Equal(t, int32(4), requests.Load())
+	})
+
+	t.Run("retries measurement queries", func(t *testing.T) {
+		t.Parallel()
+		srv, requests := newFlakyServer(t, 1, http.StatusGatewayTimeout, "")
+		client, err := api.NewAPI(api.Options{URL: srv.URL, QueryTimeout: time.Second, Retry: retryOptions})
+		require.NoError(t, err)
+
+		// The empty response is not a valid arrow response, only the number of requests matters
+		_, _ = client.MeasurementQuery(context.Background(), schemas.Query{})
+		assert.Equal(t, int32(2), requests.Load())
+	})
+
+	t.Run("does not retry client errors", func(t *testing.T) {
+		t.Parallel()
+		srv, requests := newFlakyServer(t, 1, http.StatusBadRequest, "")
+		client, err := api.NewAPI(api.Options{URL: srv.URL, Timeout: time.Second, Retry: retryOptions})
+		require.NoError(t, err)
+
+		_, err = client.GetAssets(context.Background(), "")
+		require.Error(t, err)
+		assert.Equal(t, int32(1), requests.Load())
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	var healthy atomic.Bool
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("[]"))
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := api.NewAPI(api.Options{
+		URL:     srv.URL,
+		Timeout: time.Second,
+		Retry:   &api.RetryOptions{BreakerThreshold: 2, BreakerCooldown: 50 * time.Millisecond},
+	})
+	require.NoError(t, err)
+
+	for range 2 {
+		_, err = client.GetAssets(context.Background(), "")
+		require.Error(t, err)
+	}
+
+	_, err = client.GetAssets(context.Background(), "")
+	assert.True(t, errors.Is(err, api.ErrCircuitOpen), "expected the circuit to be open, got %v", err)
+	assert.Equal(t, int32(2), requests.Load())
+
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+
+	_, err = client.GetAssets(context.Background(), "")
+	require.NoError(t, err)
+	_, err = client.GetAssets(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, int32(4), requests.Load())
+}
+
+func TestCircuitBreaker_CountsRetriedRequestOnce(t *testing.T) {
+	t.Parallel()
+
+	retryOptions := &api.RetryOptions{
+		MaxRetries:       3,
+		InitialBackoff:   time.Millisecond,
+		MaxBackoff:       5 * time.Millisecond,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Minute,
+	}
+
+	t.Run("retries that succeed do not open the circuit", func(t *testing.T) {
+		t.Parallel()
+		srv, requests := newFlakyServer(t, 3, http.StatusBadGateway, "")
+		client, err := api.NewAPI(api.Options{URL: srv.URL, Timeout: time.Second, Retry: retryOptions})
+		require.NoError(t, err)
+
+		_, err = client.GetAssets(context.Background(), "")
+		require.NoError(t, err)
+		assert.Equal(t, int32(4), requests.Load())
+
+		_, err = client.GetAssets(context.Background(), "")
+		require.NoError(t, err)
+	})
+
+	t.Run("every failed request counts once", func(t *testing.T) {
+		t.Parallel()
+		srv, requests := newFlakyServer(t, 100, http.StatusBadGateway, "")
+		client, err := api.NewAPI(api.Options{URL: srv.URL, Timeout: time.Second, Retry: retryOptions})
+		require.NoError(t, err)
+
+		for range 2 {
+			_, err = client.GetAssets(context.Background(), "")
+			require.Error(t, err)
+			assert.False(t, errors.Is(err, api.ErrCircuitOpen), "expected the circuit to be closed, got %v", err)
+		}
+		assert.Equal(t, int32(8), requests.Load())
+
+		_, err = client.GetAssets(context.Background(), "")
+		assert.True(t, errors.Is(err, api.ErrCircuitOpen), "expected the circuit to be open, got %v", err)
+		assert.Equal(t, int32(8), requests.Load())
+	})
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// TimeoutError is returned when a call to the historian exceeds one of the configured limits
+type TimeoutError struct {
+	// Setting is the name of the datasource setting that limited the call
+	Setting string
+	Limit   time.Duration
+}
+
+// Error implements the error interface
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("historian did not respond within the configured %s of %s", e.Setting, e.Limit)
+}
+
+// Unwrap allows errors.Is(err, context.DeadlineExceeded) to keep working
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// do sends a metadata or resource request, limited by the configured timeout
+func (api *API) do(req *http.Request) (*http.Response, error) {
+	return doWithTimeout(api.client, req, "timeout", api.timeout)
+}
+
+// doQuery sends a data query request, limited by the configured query timeout
+func (api *API) doQuery(req *http.Request) (*http.Response, error) {
+	return doWithTimeout(api.client, req, "query timeout", api.queryTimeout)
+}
+
+// doWithTimeout sends the request with a deadline of limit. The deadline stays in effect
+// until the response body is closed, so reading a slow body is covered as well.
+func doWithTimeout(client *http.Client, req *http.Request, setting string, limit time.Duration) (*http.Response, error) {
+	if limit <= 0 {
+		return client.Do(req)
+	}
+
+	ctx, cancel := context.WithTimeoutCause(req.Context(), limit, &TimeoutError{Setting: setting, Limit: limit})
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		err = timeoutCause(ctx, err)
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &timeoutBody{ReadCloser: resp.Body, ctx: ctx, cancel: cancel}
+	return resp, nil
+}
+
+// timeoutCause replaces err with the TimeoutError when the request context expired because of it
+func timeoutCause(ctx context.Context, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+
+	var timeoutErr *TimeoutError
+	if errors.As(context.Cause(ctx), &timeoutErr) {
+		return timeoutErr
+	}
+	return err
+}
+
+// timeoutBody releases the request deadline once the body is closed
+type timeoutBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Read implements io.Reader
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = timeoutCause(b.ctx, err)
+	}
+	return n, err
+}
+
+// Close implements io.Closer
+func (b *timeoutBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
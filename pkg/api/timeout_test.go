@@ -0,0 +1,76 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/api"
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeouts(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		_, _ = w.Write([]byte("[]"))
+	}))
+	t.Cleanup(srv.Close)
+
+	t.Run("metadata calls use the timeout", func(t *testing.T) {
+		t.Parallel()
+		client, err := api.NewAPI(api.Options{URL: srv.URL, Timeout: 20 * time.Millisecond, QueryTimeout: time.Second})
+		require.NoError(t, err)
+
+		_, err = client.GetAssets(context.Background(), "")
+		var timeoutErr *api.TimeoutError
+		require.True(t, errors.As(err, &timeoutErr), "expected a TimeoutError, got %v", err)
+		assert.Equal(t, "timeout", timeoutErr.Setting)
+		assert.Equal(t, 20*time.Millisecond, timeoutErr.Limit)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("queries use the query timeout", func(t *testing.T) {
+		t.Parallel()
+		client, err := api.NewAPI(api.Options{URL: srv.URL, Timeout: time.Second, QueryTimeout: 20 * time.Millisecond})
+		require.NoError(t, err)
+
+		_, err = client.EventQuery(context.Background(), schemas.EventFilter{})
+		var timeoutErr *api.TimeoutError
+		require.True(t, errors.As(err, &timeoutErr), "expected a TimeoutError, got %v", err)
+		assert.Equal(t, "query timeout", timeoutErr.Setting)
+	})
+
+	t.Run("calls within the limit succeed", func(t *testing.T) {
+		t.Parallel()
+		client, err := api.NewAPI(api.Options{URL: srv.URL, Timeout: time.Second, QueryTimeout: time.Second})
+		require.NoError(t, err)
+
+		assets, err := client.GetAssets(context.Background(), "")
+		require.NoError(t, err)
+		assert.Empty(t, assets)
+	})
+
+	t.Run("cancelled callers keep their own error", func(t *testing.T) {
+		t.Parallel()
+		client, err := api.NewAPI(api.Options{URL: srv.URL, Timeout: time.Second})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err = client.GetAssets(ctx, "")
+		var timeoutErr *api.TimeoutError
+		assert.False(t, errors.As(err, &timeoutErr))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
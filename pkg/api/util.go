@@ -26,30 +26,6 @@ func newHTTPRequest(ctx context.Context, method, requestURL string, body io.Read
 	return req, nil
 }
 
-// handleHTTPError processes HTTP error responses
-func handleHTTPError(resp *http.Response) error {
-	// Read and parse the error response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-	return &HTTPError{
-		StatusCode: resp.StatusCode,
-		Body:       string(body),
-	}
-}
-
-// HTTPError represents an HTTP error response
-type HTTPError struct {
-	StatusCode int
-	Body       string
-}
-
-// Error implements the error interface
-func (e *HTTPError) Error() string {
-	return http.StatusText(e.StatusCode) + ": " + e.Body
-}
-
 // GetFilteredAssets returns a map of assets that match the given asset strings
 func (api *API) GetFilteredAssets(ctx context.Context, assetStrings []string, historianInfo *schemas.HistorianInfo) (map[uuid.UUID]schemas.Asset, error) {
 	assetUUIDSet := map[uuid.UUID]schemas.Asset{}
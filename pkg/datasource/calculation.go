@@ -0,0 +1,130 @@
+package datasource
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/util"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// calculateFrames replaces the frames by a single series derived from them with the calculation expression.
+// The frames are joined on time, truncated to the aggregation period, and a value is only calculated at the
+// times every alias has a numeric value. Raw series of different measurements rarely share timestamps, so
+// calculations require an aggregation to align them.
+func calculateFrames(frames data.Frames, calculation schemas.Calculation, aggregation *schemas.Aggregation) (data.Frames, error) {
+	if aggregation == nil {
+		return nil, ErrorMessageCalculationNeedsAggregation
+	}
+
+	expression, err := util.ParseExpression(calculation.Expression)
+	if err != nil {
+		return nil, err
+	}
+
+	period, _ := time.ParseDuration(aggregation.Period)
+
+	variables := expression.Variables()
+	valuesByTime := map[time.Time]map[string]float64{}
+	for _, variable := range variables {
+		frame, err := aliasFrame(frames, variable, calculation.Aliases)
+		if err != nil {
+			return nil, err
+		}
+
+		timeField, _ := frame.FieldByName("time")
+		valueField, _ := frame.FieldByName(valueFieldName)
+		if timeField == nil || valueField == nil {
+			continue
+		}
+
+		for i := 0; i < valueField.Len(); i++ {
+			timestamp, ok := timeField.ConcreteAt(i)
+			if !ok {
+				continue
+			}
+			value, ok := valueField.ConcreteAt(i)
+			if !ok {
+				continue
+			}
+			f, ok := toFloat64(value)
+			if !ok {
+				continue
+			}
+
+			t := timestamp.(time.Time)
+			if period > 0 {
+				t = t.Truncate(period)
+			}
+			if _, ok := valuesByTime[t]; !ok {
+				valuesByTime[t] = map[string]float64{}
+			}
+			valuesByTime[t][variable] = f
+		}
+	}
+
+	timestamps := slices.SortedFunc(maps.Keys(valuesByTime), func(a, b time.Time) int {
+		return a.Compare(b)
+	})
+
+	timeValues := make([]time.Time, 0, len(timestamps))
+	values := make([]*float64, 0, len(timestamps))
+	for _, timestamp := range timestamps {
+		if len(valuesByTime[timestamp]) < len(variables) {
+			continue
+		}
+
+		timeValues = append(timeValues, timestamp)
+		value := expression.Evaluate(valuesByTime[timestamp])
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			values = append(values, nil)
+		} else {
+			values = append(values, &value)
+		}
+	}
+
+	name := cmp.Or(calculation.Name, calculation.Expression)
+	valueField := data.NewField(valueFieldName, nil, values)
+	valueField.Config = &data.FieldConfig{DisplayNameFromDS: name, Unit: calculation.Unit}
+
+	frame := data.NewFrame(name, data.NewField("time", nil, timeValues), valueField)
+	frame.Meta = &data.FrameMeta{
+		Custom: map[string]interface{}{
+			"Calculation": calculation.Expression,
+		},
+	}
+	return data.Frames{frame}, nil
+}
+
+// aliasFrame returns the frame of the measurement the alias refers to by UUID or name
+func aliasFrame(frames data.Frames, alias string, aliases map[string]string) (*data.Frame, error) {
+	measurement, ok := aliases[alias]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrorMessageUnknownAlias, alias)
+	}
+
+	var match *data.Frame
+	for _, frame := range frames {
+		if frame.Meta == nil {
+			continue
+		}
+		meta, ok := frame.Meta.Custom.(map[string]interface{})
+		if !ok || (meta["MeasurementUUID"] != measurement && meta["MeasurementName"] != measurement) {
+			continue
+		}
+		if match != nil {
+			return nil, fmt.Errorf("%w: %s matches more than one series of %s, filter or remove the group by", ErrorMessageAmbiguousAlias, alias, measurement)
+		}
+		match = frame
+	}
+
+	if match == nil {
+		return nil, fmt.Errorf("%w: %s refers to %s, which is not part of the query", ErrorMessageUnknownAlias, alias, measurement)
+	}
+	return match, nil
+}
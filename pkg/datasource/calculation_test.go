@@ -0,0 +1,80 @@
+package datasource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalculateFrames(t *testing.T) {
+	t.Parallel()
+
+	a := makeSeries(t, data.NewField(valueFieldName, nil, []*float64{new(10.0), new(20.0), new(30.0)}), "m1")
+	b := makeSeries(t, data.NewField(valueFieldName, nil, []*float64{new(5.0), nil, new(0.0)}), "m2")
+	calculation := schemas.Calculation{
+		Expression: "a / b",
+		Aliases:    map[string]string{"a": "m1", "b": "m2"},
+		Name:       "Ratio",
+		Unit:       "percent",
+	}
+
+	frames, err := calculateFrames(data.Frames{a, b}, calculation, &schemas.Aggregation{Name: schemas.Mean, Period: "1s"})
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+
+	frame := frames[0]
+	assert.Equal(t, "Ratio", frame.Name)
+	require.Equal(t, 2, frame.Rows())
+	assert.Equal(t, time.Unix(0, 0), frame.Fields[0].At(0))
+	assert.Equal(t, time.Unix(2, 0), frame.Fields[0].At(1))
+	assert.Equal(t, 2.0, *frame.Fields[1].At(0).(*float64))
+	assert.Nil(t, frame.Fields[1].At(1), "division by zero gives no value")
+	assert.Equal(t, "percent", frame.Fields[1].Config.Unit)
+}
+
+func TestCalculateFrames_AlignsOnPeriod(t *testing.T) {
+	t.Parallel()
+
+	a := makeSeries(t, data.NewField(valueFieldName, nil, []float64{1, 2}), "m1")
+	b := makeSeries(t, data.NewField(valueFieldName, nil, []float64{3, 4}), "m2")
+	b.Fields[0] = data.NewField("time", nil, []time.Time{time.Unix(0, 500), time.Unix(1, 500)})
+	calculation := schemas.Calculation{Expression: "a + b", Aliases: map[string]string{"a": "m1", "b": "m2"}}
+
+	frames, err := calculateFrames(data.Frames{a, b}, calculation, &schemas.Aggregation{Period: "1s"})
+	require.NoError(t, err)
+	require.Equal(t, 2, frames[0].Rows())
+	assert.Equal(t, "a + b", frames[0].Name)
+	assert.Equal(t, 4.0, *frames[0].Fields[1].At(0).(*float64))
+	assert.Equal(t, 6.0, *frames[0].Fields[1].At(1).(*float64))
+}
+
+func TestCalculateFrames_Errors(t *testing.T) {
+	t.Parallel()
+
+	a := makeSeries(t, data.NewField(valueFieldName, nil, []float64{1}), "m1")
+	duplicate := makeSeries(t, data.NewField(valueFieldName, nil, []float64{1}), "m1")
+	aggregation := &schemas.Aggregation{Name: schemas.Mean}
+
+	_, err := calculateFrames(data.Frames{a}, schemas.Calculation{Expression: "a +"}, aggregation)
+	status, _ := errorStatus(err)
+	assert.Equal(t, backend.StatusBadRequest, status)
+
+	_, err = calculateFrames(data.Frames{a}, schemas.Calculation{Expression: "a", Aliases: map[string]string{"a": "m1"}}, nil)
+	assert.ErrorIs(t, err, ErrorMessageCalculationNeedsAggregation)
+	status, _ = errorStatus(err)
+	assert.Equal(t, backend.StatusBadRequest, status)
+
+	_, err = calculateFrames(data.Frames{a}, schemas.Calculation{Expression: "a + c", Aliases: map[string]string{"a": "m1"}}, aggregation)
+	assert.ErrorIs(t, err, ErrorMessageUnknownAlias)
+
+	_, err = calculateFrames(data.Frames{a}, schemas.Calculation{Expression: "a", Aliases: map[string]string{"a": "m2"}}, aggregation)
+	assert.ErrorIs(t, err, ErrorMessageUnknownAlias)
+
+	_, err = calculateFrames(data.Frames{a, duplicate}, schemas.Calculation{Expression: "a", Aliases: map[string]string{"a": "m1"}}, aggregation)
+	assert.ErrorIs(t, err, ErrorMessageAmbiguousAlias)
+}
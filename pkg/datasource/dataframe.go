@@ -114,8 +114,9 @@ func convertLastKnownFramesForAggregation(frames data.Frames, aggregation schema
 //   - count: every row becomes 1 so the last-known point contributes a single
 //     observation when merged into a count series.
 //   - other numeric aggregations (integral, mean, median, spread, stddev, sum,
-//     twa): coerced to nullable float64 via convertFieldType.
-//   - first / last / max / min / mode: returned as-is — these preserve the
+//     twa, duration_in_state, percent_good, state_duration, state_count):
+//     coerced to nullable float64 via convertFieldType.
+//   - first / last / max / min / mode / state_at_start: returned as-is — these preserve the
 //     source measurement's type, so the last-known field already matches.
 func convertFieldForAggregation(field *data.Field, aggregation schemas.AggregationType) *data.Field {
 	switch aggregation {
@@ -128,7 +129,8 @@ func convertFieldForAggregation(field *data.Field, aggregation schemas.Aggregati
 			countField.Set(i, new(1.0))
 		}
 		return countField
-	case schemas.Integral, schemas.Mean, schemas.Median, schemas.Spread, schemas.Stddev, schemas.Sum, schemas.TWA:
+	case schemas.Integral, schemas.Mean, schemas.Median, schemas.Spread, schemas.Stddev, schemas.Sum, schemas.TWA, schemas.DurationInState, schemas.PercentGood,
+		schemas.StateDuration, schemas.StateCount:
 		return convertFieldType(field, data.FieldTypeNullableFloat64)
 	default:
 		return field
@@ -590,6 +592,121 @@ func repeatStringPtr(value string, n int) []*string {
 	return out
 }
 
+// formatFrames shapes the frames of a measurement query according to its FrameFormat
+func formatFrames(frames data.Frames, options schemas.MeasurementQueryOptions) (data.Frames, error) {
+	if options.FrameFormat == schemas.FrameFormatNumeric {
+		return reduceFrames(frames, options.Reducer)
+	}
+	return applyFrameFormat(frames, options.FrameFormat), nil
+}
+
+// reduceFrames reduces every series to a single value and returns them as one FrameTypeNumericWide
+// frame, with one field per series identified by its labels. This is the shape alerting and SSE
+// expect, so alert rules don't need a reduce expression. Values that are not numeric are skipped:
+// bools count as 1/0 and strings only when they parse as a number, a series without numeric values
+// reduces to null. Must run after setFieldLabels / setAssetFrameNames, like finalizeFlatFrames.
+func reduceFrames(frames data.Frames, reducer schemas.Reducer) (data.Frames, error) {
+	if reducer == "" {
+		reducer = schemas.ReducerLast
+	}
+	if !slices.Contains([]schemas.Reducer{
+		schemas.ReducerLast, schemas.ReducerFirst, schemas.ReducerMin, schemas.ReducerMax,
+		schemas.ReducerMean, schemas.ReducerSum, schemas.ReducerCount,
+	}, reducer) {
+		return nil, fmt.Errorf("%w: %s", ErrorMessageInvalidReducer, reducer)
+	}
+
+	reduced := data.NewFrame("")
+	reduced.Meta = &data.FrameMeta{
+		Type:        data.FrameTypeNumericWide,
+		TypeVersion: data.FrameTypeVersion{0, 1},
+	}
+
+	for _, frame := range frames {
+		valueField, _ := frame.FieldByName(valueFieldName)
+		if valueField == nil {
+			continue
+		}
+		timeField, _ := frame.FieldByName("time")
+
+		labels := data.Labels{}
+		maps.Copy(labels, mergedLabelsFromMeta(frame))
+		maps.Copy(labels, valueField.Labels)
+
+		field := data.NewField(valueFieldName, labels, []*float64{reduceField(valueField, timeField, reducer)})
+		if valueField.Config != nil {
+			config := *valueField.Config
+			field.Config = &config
+		}
+		if frame.Name != "" && (field.Config == nil || field.Config.DisplayNameFromDS == "") {
+			if field.Config == nil {
+				field.Config = &data.FieldConfig{}
+			}
+			field.Config.DisplayNameFromDS = frame.Name
+		}
+		reduced.Fields = append(reduced.Fields, field)
+	}
+
+	return data.Frames{reduced}, nil
+}
+
+// reduceField reduces the values of a field, first and last are determined by the time field
+// when there is one so descending queries reduce the same way
+func reduceField(valueField, timeField *data.Field, reducer schemas.Reducer) *float64 {
+	var result *float64
+	var resultTime time.Time
+	count := 0
+
+	for i := 0; i < valueField.Len(); i++ {
+		value, ok := valueField.ConcreteAt(i)
+		if !ok {
+			continue
+		}
+		if reducer == schemas.ReducerCount {
+			count++
+			continue
+		}
+
+		f, ok := toFloat64(value)
+		if !ok || math.IsNaN(f) {
+			continue
+		}
+		count++
+
+		var t time.Time
+		if timeField != nil && i < timeField.Len() {
+			if timestamp, ok := timeField.ConcreteAt(i); ok {
+				t, _ = timestamp.(time.Time)
+			}
+		}
+
+		switch {
+		case result == nil:
+			result, resultTime = &f, t
+		case reducer == schemas.ReducerLast && !t.Before(resultTime),
+			reducer == schemas.ReducerFirst && t.Before(resultTime),
+			reducer == schemas.ReducerMin && f < *result,
+			reducer == schemas.ReducerMax && f > *result:
+			result, resultTime = &f, t
+		case reducer == schemas.ReducerMean, reducer == schemas.ReducerSum:
+			sum := *result + f
+			result = &sum
+		}
+	}
+
+	switch reducer {
+	case schemas.ReducerCount:
+		value := float64(count)
+		return &value
+	case schemas.ReducerMean:
+		if result != nil {
+			mean := *result / float64(count)
+			return &mean
+		}
+	}
+	return result
+}
+
 func setFieldConfig(frame *data.Frame, useEngineeringSpecs bool) {
 	field, _ := frame.FieldByName(valueFieldName)
 	if field == nil {
@@ -175,6 +175,86 @@ func TestApplyFrameFormat_EmptyDisplayName(t *testing.T) {
 	assert.False(t, ok, "display name column should be null when no display name is set")
 }
 
+// makeSeries builds a frame with one point per value, one second apart
+func makeSeries(t *testing.T, valueField *data.Field, measurementUUID string) *data.Frame {
+	t.Helper()
+	timestamps := make([]time.Time, valueField.Len())
+	for i := range timestamps {
+		timestamps[i] = time.Unix(int64(i), 0)
+	}
+	frame := makeFrame(t, valueField, measurementUUID)
+	frame.Fields[0] = data.NewField("time", nil, timestamps)
+	frame.Meta.Custom.(map[string]interface{})["MeasurementUUID"] = measurementUUID
+	return frame
+}
+
+func TestFormatFrames_Numeric(t *testing.T) {
+	t.Parallel()
+
+	one, two, three, five, nine := 1.0, 2.0, 3.0, 5.0, 9.0
+	testCases := []struct {
+		reducer  schemas.Reducer
+		expected []*float64
+	}{
+		{reducer: "", expected: []*float64{&one, nil}},
+		{reducer: schemas.ReducerLast, expected: []*float64{&one, nil}},
+		{reducer: schemas.ReducerFirst, expected: []*float64{&three, nil}},
+		{reducer: schemas.ReducerMin, expected: []*float64{&one, nil}},
+		{reducer: schemas.ReducerMax, expected: []*float64{&five, nil}},
+		{reducer: schemas.ReducerMean, expected: []*float64{&three, nil}},
+		{reducer: schemas.ReducerSum, expected: []*float64{&nine, nil}},
+		{reducer: schemas.ReducerCount, expected: []*float64{&three, &two}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.reducer), func(t *testing.T) {
+			t.Parallel()
+			numeric := makeSeries(t, data.NewField("value", nil, []*float64{&three, &five, nil, &one}), "numeric")
+			text := makeSeries(t, data.NewField("value", nil, []string{"running", "stopped"}), "text")
+
+			out, err := formatFrames(data.Frames{numeric, text}, schemas.MeasurementQueryOptions{
+				FrameFormat: schemas.FrameFormatNumeric,
+				Reducer:     tc.reducer,
+			})
+			require.NoError(t, err)
+			require.Len(t, out, 1)
+			assert.Equal(t, data.FrameTypeNumericWide, out[0].Meta.Type)
+			require.Len(t, out[0].Fields, 2)
+
+			for i, field := range out[0].Fields {
+				require.Equal(t, 1, field.Len())
+				assert.Equal(t, tc.expected[i], field.At(0))
+				assert.Equal(t, "Good", field.Labels["status"])
+			}
+			assert.Equal(t, "numeric", out[0].Fields[0].Labels["MeasurementUUID"])
+			assert.Equal(t, "text", out[0].Fields[1].Labels["MeasurementUUID"])
+			assert.Equal(t, "numeric", out[0].Fields[0].Config.DisplayNameFromDS)
+		})
+	}
+}
+
+func TestFormatFrames_NumericBool(t *testing.T) {
+	t.Parallel()
+	frame := makeSeries(t, data.NewField("value", nil, []bool{true, false, true}), "running")
+
+	out, err := formatFrames(data.Frames{frame}, schemas.MeasurementQueryOptions{
+		FrameFormat: schemas.FrameFormatNumeric,
+		Reducer:     schemas.ReducerSum,
+	})
+	require.NoError(t, err)
+	require.Len(t, out[0].Fields, 1)
+	assert.InDelta(t, 2.0, *out[0].Fields[0].At(0).(*float64), 0)
+}
+
+func TestFormatFrames_InvalidReducer(t *testing.T) {
+	t.Parallel()
+	_, err := formatFrames(data.Frames{}, schemas.MeasurementQueryOptions{
+		FrameFormat: schemas.FrameFormatNumeric,
+		Reducer:     "median",
+	})
+	assert.ErrorIs(t, err, ErrorMessageInvalidReducer)
+}
+
 func TestConvertFieldType_NullableToNonNullablePreservesValues(t *testing.T) {
 	t.Parallel()
 	one, two := 1.5, 2.5
@@ -1,23 +1,94 @@
 package datasource
 
-import "github.com/pkg/errors"
+import (
+	"encoding/json"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/api"
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/util"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/pkg/errors"
+)
 
 // error consts
 var (
-	ErrorMessageInvalidJSON              = errors.New("could not parse json")
-	ErrorMessageInvalidURL               = errors.New("invalid url. Either empty or not set")
-	ErrorMessageInvalidPort              = errors.New("invalid port")
-	ErrorMessageInvalidUserName          = errors.New("username is either empty or not set")
-	ErrorMessageInvalidPassword          = errors.New("password is either empty or not set")
-	ErrorQueryDataNotImplemented         = errors.New("query data not implemented")
-	ErrorInvalidResourceCallQuery        = errors.New("invalid resource query")
-	ErrorFailedUnmarshalingResourceQuery = errors.New("failed to unmarshal resource query")
-	ErrorQueryParsingNotImplemented      = errors.New("query parsing not implemented yet")
-	ErrorUnmarshalingSettings            = errors.New("error while unmarshaling settings")
-	ErrorInvalidSentryConfig             = errors.New("invalid sentry configuration")
-	ErrorInvalidAuthToken                = errors.New("empty or invalid auth token found")
-	ErrorInvalidOrganizationSlug         = errors.New("invalid or empty organization slug")
-	ErrorUnknownQueryType                = errors.New("unknown query type")
-	ErrorMessageMissingCredentials       = errors.New("no token")
-	ErrorMessageNoOrganization           = errors.New("no organization selected")
+	ErrorMessageInvalidJSON                 = errors.New("could not parse json")
+	ErrorMessageInvalidURL                  = errors.New("invalid url. Either empty or not set")
+	ErrorMessageInvalidPort                 = errors.New("invalid port")
+	ErrorMessageInvalidUserName             = errors.New("username is either empty or not set")
+	ErrorMessageInvalidPassword             = errors.New("password is either empty or not set")
+	ErrorQueryDataNotImplemented            = errors.New("query data not implemented")
+	ErrorInvalidResourceCallQuery           = errors.New("invalid resource query")
+	ErrorFailedUnmarshalingResourceQuery    = errors.New("failed to unmarshal resource query")
+	ErrorQueryParsingNotImplemented         = errors.New("query parsing not implemented yet")
+	ErrorUnmarshalingSettings               = errors.New("error while unmarshaling settings")
+	ErrorInvalidSentryConfig                = errors.New("invalid sentry configuration")
+	ErrorInvalidAuthToken                   = errors.New("empty or invalid auth token found")
+	ErrorInvalidOrganizationSlug            = errors.New("invalid or empty organization slug")
+	ErrorUnknownQueryType                   = errors.New("unknown query type")
+	ErrorMessageMissingCredentials          = errors.New("no token")
+	ErrorMessageNoOrganization              = errors.New("no organization selected")
+	ErrorMessageInvalidTimeout              = errors.New("invalid timeout, expected a number of seconds or a duration")
+	ErrorMessageInvalidCacheTTL             = errors.New("invalid metadata cache TTL, expected a number of seconds or a duration")
+	ErrorMessageInvalidDuration             = errors.New("duration must not be negative")
+	ErrorMessageInvalidQueryCacheSize       = errors.New("query cache size must not be negative")
+	ErrorMessageMissingClientCertificate    = errors.New("TLS client authentication requires a client certificate and key")
+	ErrorMessageInvalidReducer              = errors.New("invalid reducer")
+	ErrorMessageUnknownTimeseriesDatabase   = errors.New("unknown time series database")
+	ErrorMessageInvalidMacroInterval        = errors.New("invalid macro interval")
+	ErrorMessageUnsupportedDatabaseType     = errors.New("raw queries are not supported for this time series database type")
+	ErrorMessageUnknownAlias                = errors.New("unknown calculation alias")
+	ErrorMessageAmbiguousAlias              = errors.New("ambiguous calculation alias")
+	ErrorMessageInvalidAggregationPeriod    = errors.New("invalid aggregation period")
+	ErrorMessageMissingAggregationArgument  = errors.New("missing aggregation argument")
+	ErrorMessageCalculationNeedsAggregation = errors.New("calculations require an aggregation to align the measurements on time")
 )
+
+// errorStatus returns the status and source of a failed query. Failures of the historian are
+// downstream errors, failures to interpret the query or the response are plugin errors.
+func errorStatus(err error) (backend.Status, backend.ErrorSource) {
+	var httpError *api.HTTPError
+	var timeoutError *api.TimeoutError
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &httpError):
+		return httpErrorStatus(httpError), backend.ErrorSourceFromHTTPStatus(httpError.StatusCode)
+	case errors.As(err, &timeoutError):
+		return backend.StatusTimeout, backend.ErrorSourceDownstream
+	case errors.Is(err, api.ErrCircuitOpen), backend.IsDownstreamHTTPError(err):
+		return backend.StatusBadGateway, backend.ErrorSourceDownstream
+	case errors.As(err, &syntaxError), errors.As(err, &typeError),
+		errors.Is(err, ErrorMessageInvalidReducer), errors.Is(err, ErrorMessageInvalidMacroInterval),
+		errors.Is(err, ErrorMessageUnsupportedDatabaseType), errors.Is(err, ErrorMessageUnknownTimeseriesDatabase),
+		errors.Is(err, ErrorMessageUnknownAlias), errors.Is(err, ErrorMessageAmbiguousAlias), errors.Is(err, util.ErrInvalidExpression),
+		errors.Is(err, ErrorMessageInvalidAggregationPeriod), errors.Is(err, ErrorMessageMissingAggregationArgument),
+		errors.Is(err, ErrorMessageCalculationNeedsAggregation):
+		return backend.StatusBadRequest, backend.ErrorSourcePlugin
+	default:
+		return backend.StatusInternal, backend.ErrorSourcePlugin
+	}
+}
+
+// httpErrorStatus returns the status for an error response of the historian
+func httpErrorStatus(httpError *api.HTTPError) backend.Status {
+	switch httpError.Kind {
+	case api.ErrNotFound:
+		return backend.StatusNotFound
+	case api.ErrUnauthorized:
+		return backend.StatusUnauthorized
+	case api.ErrForbidden:
+		return backend.StatusForbidden
+	case api.ErrValidation:
+		return backend.StatusValidationFailed
+	case api.ErrRateLimited:
+		return backend.StatusTooManyRequests
+	case api.ErrServer:
+		return backend.StatusBadGateway
+	}
+
+	if status := backend.Status(httpError.StatusCode); status.IsValid() {
+		return status
+	}
+	return backend.StatusUnknown
+}
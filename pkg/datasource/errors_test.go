@@ -0,0 +1,107 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/api"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorStatus(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		err            error
+		expectedStatus backend.Status
+		expectedSource backend.ErrorSource
+	}{
+		{
+			name:           "not found",
+			err:            &api.HTTPError{StatusCode: http.StatusNotFound, Kind: api.ErrNotFound},
+			expectedStatus: backend.StatusNotFound,
+			expectedSource: backend.ErrorSourceDownstream,
+		},
+		{
+			name:           "wrapped unauthorized",
+			err:            fmt.Errorf("get assets: %w", &api.HTTPError{StatusCode: http.StatusUnauthorized, Kind: api.ErrUnauthorized}),
+			expectedStatus: backend.StatusUnauthorized,
+			expectedSource: backend.ErrorSourceDownstream,
+		},
+		{
+			name:           "validation",
+			err:            &api.HTTPError{StatusCode: http.StatusBadRequest, Kind: api.ErrValidation},
+			expectedStatus: backend.StatusValidationFailed,
+			expectedSource: backend.ErrorSourceDownstream,
+		},
+		{
+			name:           "rate limited",
+			err:            &api.HTTPError{StatusCode: http.StatusTooManyRequests, Kind: api.ErrRateLimited},
+			expectedStatus: backend.StatusTooManyRequests,
+			expectedSource: backend.ErrorSourceDownstream,
+		},
+		{
+			name:           "server error",
+			err:            &api.HTTPError{StatusCode: http.StatusServiceUnavailable, Kind: api.ErrServer},
+			expectedStatus: backend.StatusBadGateway,
+			expectedSource: backend.ErrorSourceDownstream,
+		},
+		{
+			name:           "other status",
+			err:            &api.HTTPError{StatusCode: http.StatusMethodNotAllowed},
+			expectedStatus: backend.Status(http.StatusMethodNotAllowed),
+			expectedSource: backend.ErrorSourcePlugin,
+		},
+		{
+			name:           "timeout",
+			err:            &api.TimeoutError{Setting: "query timeout", Limit: time.Minute},
+			expectedStatus: backend.StatusTimeout,
+			expectedSource: backend.ErrorSourceDownstream,
+		},
+		{
+			name:           "circuit open",
+			err:            fmt.Errorf("%w until later", api.ErrCircuitOpen),
+			expectedStatus: backend.StatusBadGateway,
+			expectedSource: backend.ErrorSourceDownstream,
+		},
+		{
+			name:           "cancelled",
+			err:            context.Canceled,
+			expectedStatus: backend.StatusBadGateway,
+			expectedSource: backend.ErrorSourceDownstream,
+		},
+		{
+			name:           "invalid query",
+			err:            json.Unmarshal([]byte("{"), &Query{}),
+			expectedStatus: backend.StatusBadRequest,
+			expectedSource: backend.ErrorSourcePlugin,
+		},
+		{
+			name:           "unsupported database type",
+			err:            fmt.Errorf("%w: %s", ErrorMessageUnsupportedDatabaseType, "Graphite"),
+			expectedStatus: backend.StatusBadRequest,
+			expectedSource: backend.ErrorSourcePlugin,
+		},
+		{
+			name:           "other",
+			err:            fmt.Errorf("unsupported query type %s", "Foo"),
+			expectedStatus: backend.StatusInternal,
+			expectedSource: backend.ErrorSourcePlugin,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			status, source := errorStatus(tc.err)
+			assert.Equal(t, tc.expectedStatus, status)
+			assert.Equal(t, tc.expectedSource, source)
+		})
+	}
+}
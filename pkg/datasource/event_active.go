@@ -0,0 +1,112 @@
+package datasource
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/google/uuid"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// maxActiveSeriesPoints is the maximum number of samples in an event active series, the interval is widened when needed
+const maxActiveSeriesPoints = 10000
+
+// activeSeriesKey identifies the asset and event type of an event active series
+type activeSeriesKey struct {
+	assetUUID     uuid.UUID
+	eventTypeUUID uuid.UUID
+}
+
+// EventQueryResultToActiveDataFrame converts an event query result to a step series per asset and event type.
+// The series is sampled every interval between from and to and is 1 while an event is active and 0 otherwise.
+// When a property is given, the series has the numeric value of that simple property while an event is active
+// and no value otherwise. Events without a stop time stay active until the end of the time range.
+func EventQueryResultToActiveDataFrame(assets []schemas.Asset, events []schemas.Event, eventTypes map[uuid.UUID]schemas.EventType, property string, from, to time.Time, interval time.Duration) (data.Frames, error) {
+	if !to.After(from) {
+		return data.Frames{}, nil
+	}
+	if minInterval := to.Sub(from) / maxActiveSeriesPoints; interval < minInterval {
+		interval = minInterval
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	timestamps := []time.Time{}
+	for timestamp := from.Truncate(interval); !timestamp.After(to); timestamp = timestamp.Add(interval) {
+		if timestamp.Before(from) {
+			continue
+		}
+		timestamps = append(timestamps, timestamp)
+	}
+
+	uuidToAssetMap := make(map[uuid.UUID]schemas.Asset)
+	for _, asset := range assets {
+		uuidToAssetMap[asset.UUID] = asset
+	}
+
+	groupedEvents := map[activeSeriesKey][]*schemas.Event{}
+	keys := []activeSeriesKey{}
+	for i := range events {
+		key := activeSeriesKey{assetUUID: events[i].AssetUUID, eventTypeUUID: events[i].EventTypeUUID}
+		if _, ok := groupedEvents[key]; !ok {
+			keys = append(keys, key)
+		}
+		groupedEvents[key] = append(groupedEvents[key], &events[i])
+	}
+
+	frames := make(data.Frames, 0, len(keys))
+	for _, key := range keys {
+		values := make([]*float64, len(timestamps))
+		if property == "" {
+			for i := range values {
+				values[i] = new(0.0)
+			}
+		}
+
+		for _, event := range groupedEvents[key] {
+			value := 1.0
+			if property != "" {
+				if event.Properties == nil {
+					continue
+				}
+				var ok bool
+				if value, ok = toFloat64(event.Properties.Properties[property]); !ok {
+					continue
+				}
+			}
+
+			first, _ := slices.BinarySearchFunc(timestamps, event.StartTime, func(timestamp, startTime time.Time) int {
+				return timestamp.Compare(startTime)
+			})
+			for i := first; i < len(timestamps) && (event.StopTime == nil || timestamps[i].Before(*event.StopTime)); i++ {
+				values[i] = new(value)
+			}
+		}
+
+		assetPath := getAssetPath(uuidToAssetMap, key.assetUUID)
+		eventTypeName := eventTypes[key.eventTypeUUID].Name
+		valueName := "active"
+		if property != "" {
+			valueName = property
+		}
+
+		valueField := data.NewField(valueName, data.Labels{
+			AssetColumnName:     getAssetName(uuidToAssetMap, key.assetUUID),
+			AssetPathColumnName: assetPath,
+			EventTypeColumnName: eventTypeName,
+		}, values)
+		valueField.SetConfig(&data.FieldConfig{
+			DisplayNameFromDS: fmt.Sprintf("%s\\\\%s", assetPath, eventTypeName),
+		})
+		if property != "" {
+			valueField.Config.DisplayNameFromDS += "\\\\" + property
+		}
+
+		frames = append(frames, data.NewFrame(eventTypeName, data.NewField("time", nil, slices.Clone(timestamps)), valueField))
+	}
+
+	return frames, nil
+}
@@ -0,0 +1,77 @@
+package datasource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/google/uuid"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventQueryResultToActiveDataFrame(t *testing.T) {
+	t.Parallel()
+
+	line := schemas.Asset{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Line 1"}, AssetPath: `Site\\Line 1`}
+	downtime := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Downtime"}}
+	eventTypes := map[uuid.UUID]schemas.EventType{downtime.UUID: downtime}
+
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(5 * time.Minute)
+	events := []schemas.Event{
+		{
+			UUID:          uuid.New(),
+			AssetUUID:     line.UUID,
+			EventTypeUUID: downtime.UUID,
+			StartTime:     from.Add(-time.Minute),
+			StopTime:      new(from.Add(time.Minute)),
+			Properties:    &schemas.EventProperties{Properties: schemas.Attributes{"Scrap": 2.0}},
+		},
+		{
+			UUID:          uuid.New(),
+			AssetUUID:     line.UUID,
+			EventTypeUUID: downtime.UUID,
+			StartTime:     from.Add(150 * time.Second),
+			Properties:    &schemas.EventProperties{Properties: schemas.Attributes{"Scrap": 5.0}},
+		},
+	}
+
+	t.Run("active", func(t *testing.T) {
+		t.Parallel()
+		frames, err := EventQueryResultToActiveDataFrame([]schemas.Asset{line}, events, eventTypes, "", from, to, time.Minute)
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+
+		frame := frames[0]
+		require.Equal(t, 6, frame.Rows())
+		assert.Equal(t, from, frame.Fields[0].At(0))
+		assert.Equal(t, []*float64{new(1.0), new(0.0), new(0.0), new(1.0), new(1.0), new(1.0)}, fieldValues[*float64](frame, 1))
+		assert.Equal(t, `Site\\Line 1`, frame.Fields[1].Labels[AssetPathColumnName])
+		assert.Equal(t, `Site\\Line 1\\Downtime`, frame.Fields[1].Config.DisplayNameFromDS)
+	})
+
+	t.Run("property", func(t *testing.T) {
+		t.Parallel()
+		frames, err := EventQueryResultToActiveDataFrame([]schemas.Asset{line}, events, eventTypes, "Scrap", from, to, time.Minute)
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		assert.Equal(t, []*float64{new(2.0), nil, nil, new(5.0), new(5.0), new(5.0)}, fieldValues[*float64](frames[0], 1))
+	})
+
+	t.Run("limits the number of points", func(t *testing.T) {
+		t.Parallel()
+		frames, err := EventQueryResultToActiveDataFrame([]schemas.Asset{line}, events, eventTypes, "", from, to, time.Millisecond)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, frames[0].Rows(), maxActiveSeriesPoints+1)
+	})
+}
+
+func fieldValues[T any](frame *data.Frame, field int) []T {
+	values := make([]T, frame.Rows())
+	for i := range values {
+		values[i] = frame.Fields[field].At(i).(T)
+	}
+	return values
+}
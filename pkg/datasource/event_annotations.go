@@ -0,0 +1,104 @@
+package datasource
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/google/uuid"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Default templates of the event annotations
+const (
+	defaultAnnotationTitle = "{{EventType}}"
+	defaultAnnotationText  = "{{AssetPath}}"
+)
+
+// annotationTemplateRegex matches the placeholders of an annotation template, e.g. {{EventType}} or {{Batch number}}
+var annotationTemplateRegex = regexp.MustCompile(`{{\s*([^{}]+?)\s*}}`)
+
+// EventQueryResultToAnnotationDataFrame converts an event query result to an annotation frame with the time, timeEnd,
+// title, text and tags fields Grafana expects. The title and text are templates in which {{EventType}}, {{Asset}},
+// {{AssetPath}}, {{StartTime}}, {{StopTime}}, {{Duration}} and {{<simple property>}} are replaced by the values of the
+// event. The tags are the selected properties as "name: value". Open events end at now.
+func EventQueryResultToAnnotationDataFrame(assets []schemas.Asset, events []schemas.Event, eventTypes map[uuid.UUID]schemas.EventType, annotation schemas.EventAnnotation, tagProperties []string, now time.Time) (data.Frames, error) {
+	titleTemplate := annotation.Title
+	if titleTemplate == "" {
+		titleTemplate = defaultAnnotationTitle
+	}
+	textTemplate := annotation.Text
+	if textTemplate == "" {
+		textTemplate = defaultAnnotationText
+	}
+
+	uuidToAssetMap := make(map[uuid.UUID]schemas.Asset)
+	for _, asset := range assets {
+		uuidToAssetMap[asset.UUID] = asset
+	}
+
+	times := make([]time.Time, len(events))
+	timeEnds := make([]time.Time, len(events))
+	titles := make([]string, len(events))
+	texts := make([]string, len(events))
+	tags := make([]string, len(events))
+	for i := range events {
+		times[i] = events[i].StartTime
+		timeEnds[i] = now
+		if events[i].StopTime != nil {
+			timeEnds[i] = *events[i].StopTime
+		}
+
+		values := annotationTemplateValues(&events[i], uuidToAssetMap, eventTypes, timeEnds[i])
+		titles[i] = expandAnnotationTemplate(titleTemplate, values)
+		texts[i] = expandAnnotationTemplate(textTemplate, values)
+
+		eventTags := make([]string, 0, len(tagProperties))
+		for _, property := range tagProperties {
+			if value, ok := values[property]; ok && value != "" {
+				eventTags = append(eventTags, fmt.Sprintf("%s: %s", property, value))
+			}
+		}
+		tags[i] = strings.Join(eventTags, ",")
+	}
+
+	return data.Frames{data.NewFrame("Annotations",
+		data.NewField("time", nil, times),
+		data.NewField("timeEnd", nil, timeEnds),
+		data.NewField("title", nil, titles),
+		data.NewField("text", nil, texts),
+		data.NewField("tags", nil, tags),
+	)}, nil
+}
+
+// annotationTemplateValues returns the values of an event that can be used in the annotation templates and tags
+func annotationTemplateValues(event *schemas.Event, uuidToAssetMap map[uuid.UUID]schemas.Asset, eventTypes map[uuid.UUID]schemas.EventType, stopTime time.Time) map[string]string {
+	values := map[string]string{}
+	if event.Properties != nil {
+		for name, value := range event.Properties.Properties {
+			if stringValue, ok := toString(value); ok {
+				values[name] = stringValue
+			}
+		}
+	}
+
+	values[EventTypeColumnName] = eventTypes[event.EventTypeUUID].Name
+	values[AssetColumnName] = getAssetName(uuidToAssetMap, event.AssetUUID)
+	values[AssetPathColumnName] = getAssetPath(uuidToAssetMap, event.AssetUUID)
+	values[StartTimeColumnName] = event.StartTime.Format(time.RFC3339)
+	values[StopTimeColumnName] = ""
+	if event.StopTime != nil {
+		values[StopTimeColumnName] = event.StopTime.Format(time.RFC3339)
+	}
+	values[DurationColumnName] = stopTime.Sub(event.StartTime).Round(time.Second).String()
+	return values
+}
+
+// expandAnnotationTemplate replaces the placeholders of the template by their values, unknown placeholders become empty
+func expandAnnotationTemplate(template string, values map[string]string) string {
+	return annotationTemplateRegex.ReplaceAllStringFunc(template, func(match string) string {
+		return values[annotationTemplateRegex.FindStringSubmatch(match)[1]]
+	})
+}
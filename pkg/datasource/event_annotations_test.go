@@ -0,0 +1,62 @@
+package datasource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventQueryResultToAnnotationDataFrame(t *testing.T) {
+	t.Parallel()
+
+	line := schemas.Asset{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Line 1"}, AssetPath: `Site\\Line 1`}
+	downtime := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Downtime"}}
+	eventTypes := map[uuid.UUID]schemas.EventType{downtime.UUID: downtime}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start.Add(time.Hour)
+	events := []schemas.Event{
+		{
+			UUID:          uuid.New(),
+			AssetUUID:     line.UUID,
+			EventTypeUUID: downtime.UUID,
+			StartTime:     start,
+			StopTime:      new(start.Add(90 * time.Second)),
+			Properties:    &schemas.EventProperties{Properties: schemas.Attributes{"Reason": "Jam", "Scrap": 2.5}},
+		},
+		{
+			UUID:          uuid.New(),
+			AssetUUID:     line.UUID,
+			EventTypeUUID: downtime.UUID,
+			StartTime:     start.Add(30 * time.Minute),
+			Properties:    &schemas.EventProperties{Properties: schemas.Attributes{"Reason": "Cleaning"}},
+		},
+	}
+
+	t.Run("templates", func(t *testing.T) {
+		t.Parallel()
+		annotation := schemas.EventAnnotation{Title: "{{EventType}}: {{ Reason }}", Text: "{{AssetPath}} for {{Duration}}{{Unknown}}"}
+		frames, err := EventQueryResultToAnnotationDataFrame([]schemas.Asset{line}, events, eventTypes, annotation, []string{"Reason", "Scrap"}, now)
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+
+		frame := frames[0]
+		assert.Equal(t, []string{"time", "timeEnd", "title", "text", "tags"}, fieldNames(frame))
+		require.Equal(t, 2, frame.Rows())
+		assert.Equal(t, []interface{}{start, start.Add(90 * time.Second), "Downtime: Jam", `Site\\Line 1 for 1m30s`, "Reason: Jam,Scrap: 2.5"}, frameRow(frame, 0))
+		assert.Equal(t, []interface{}{start.Add(30 * time.Minute), now, "Downtime: Cleaning", `Site\\Line 1 for 30m0s`, "Reason: Cleaning"}, frameRow(frame, 1))
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		t.Parallel()
+		frames, err := EventQueryResultToAnnotationDataFrame([]schemas.Asset{line}, events, eventTypes, schemas.EventAnnotation{}, nil, now)
+		require.NoError(t, err)
+		assert.Equal(t, "Downtime", frames[0].Fields[2].At(0))
+		assert.Equal(t, `Site\\Line 1`, frames[0].Fields[3].At(0))
+		assert.Equal(t, "", frames[0].Fields[4].At(0))
+	})
+}
@@ -0,0 +1,75 @@
+package datasource
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/google/uuid"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// AddChildEventColumns adds the number and total duration of the child events per child event type as columns to the
+// frames of EventQueryResultToDataFrame. The rows are matched to the child events on the EventUUID column, the total
+// duration only includes the stopped child events.
+func AddChildEventColumns(frames data.Frames, childEvents []schemas.Event, childEventTypes map[uuid.UUID]schemas.EventType) data.Frames {
+	eventTypes := slices.SortedFunc(maps.Values(childEventTypes), func(a, b schemas.EventType) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	type childKey struct {
+		ParentUUID    uuid.UUID
+		EventTypeUUID uuid.UUID
+	}
+	counts := map[childKey]int64{}
+	durations := map[childKey]float64{}
+	for i := range childEvents {
+		if childEvents[i].ParentUUID == nil {
+			continue
+		}
+
+		key := childKey{ParentUUID: *childEvents[i].ParentUUID, EventTypeUUID: childEvents[i].EventTypeUUID}
+		counts[key]++
+		if childEvents[i].StopTime != nil {
+			durations[key] += childEvents[i].StopTime.Sub(childEvents[i].StartTime).Seconds()
+		}
+	}
+
+	durationConfig := &data.FieldConfig{Unit: "dtdhms"}
+	for _, frame := range frames {
+		eventUUIDs, _ := frame.FieldByName(EventUUIDColumnName)
+		if eventUUIDs == nil {
+			continue
+		}
+
+		for _, eventType := range eventTypes {
+			countValues := make([]int64, eventUUIDs.Len())
+			durationValues := make([]*float64, eventUUIDs.Len())
+			for i := range eventUUIDs.Len() {
+				value, ok := eventUUIDs.ConcreteAt(i)
+				if !ok {
+					continue
+				}
+				eventUUID, err := uuid.Parse(value.(string))
+				if err != nil {
+					continue
+				}
+
+				key := childKey{ParentUUID: eventUUID, EventTypeUUID: eventType.UUID}
+				countValues[i] = counts[key]
+				if duration, ok := durations[key]; ok {
+					durationValues[i] = new(duration)
+				}
+			}
+
+			frame.Fields = append(frame.Fields,
+				data.NewField(fmt.Sprintf("%s (%s)", eventType.Name, CountColumnName), nil, countValues),
+				data.NewField(fmt.Sprintf("%s (%s)", eventType.Name, TotalDurationColumnName), nil, durationValues).SetConfig(durationConfig),
+			)
+		}
+	}
+
+	return frames
+}
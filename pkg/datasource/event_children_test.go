@@ -0,0 +1,53 @@
+package datasource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/google/uuid"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddChildEventColumns(t *testing.T) {
+	t.Parallel()
+
+	asset := schemas.Asset{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "reactor"}}
+	batchType := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Batch"}}
+	phaseType := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Phase"}}
+	alarmType := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Alarm"}}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	batches := []schemas.Event{
+		{UUID: uuid.New(), AssetUUID: asset.UUID, EventTypeUUID: batchType.UUID, StartTime: start},
+		{UUID: uuid.New(), AssetUUID: asset.UUID, EventTypeUUID: batchType.UUID, StartTime: start.Add(time.Hour)},
+	}
+	children := []schemas.Event{
+		{UUID: uuid.New(), EventTypeUUID: phaseType.UUID, ParentUUID: &batches[0].UUID, StartTime: start, StopTime: new(start.Add(10 * time.Minute))},
+		{UUID: uuid.New(), EventTypeUUID: phaseType.UUID, ParentUUID: &batches[0].UUID, StartTime: start.Add(10 * time.Minute), StopTime: new(start.Add(30 * time.Minute))},
+		{UUID: uuid.New(), EventTypeUUID: phaseType.UUID, ParentUUID: &batches[0].UUID, StartTime: start.Add(30 * time.Minute)},
+		{UUID: uuid.New(), EventTypeUUID: alarmType.UUID, ParentUUID: &batches[1].UUID, StartTime: start.Add(time.Hour), StopTime: new(start.Add(time.Hour + time.Minute))},
+	}
+
+	frames, err := EventQueryResultToDataFrame(0, false, []schemas.Asset{asset}, batches, []schemas.EventType{batchType}, nil, map[string]struct{}{}, map[assetPropertyColumn]data.FieldType{}, map[uuid.UUID]data.Frames{})
+	require.NoError(t, err)
+	frames = AddChildEventColumns(frames, children, map[uuid.UUID]schemas.EventType{phaseType.UUID: phaseType, alarmType.UUID: alarmType})
+	require.Len(t, frames, 1)
+
+	frame := frames[0]
+	names := fieldNames(frame)
+	assert.Equal(t, []string{"Alarm (Count)", "Alarm (TotalDuration)", "Phase (Count)", "Phase (TotalDuration)"}, names[len(names)-4:])
+
+	field := func(name string) *data.Field {
+		f, _ := frame.FieldByName(name)
+		require.NotNil(t, f, name)
+		return f
+	}
+	assert.Equal(t, []interface{}{int64(3), int64(0)}, []interface{}{field("Phase (Count)").At(0), field("Phase (Count)").At(1)})
+	assert.Equal(t, new(1800.0), field("Phase (TotalDuration)").At(0))
+	assert.Nil(t, field("Phase (TotalDuration)").At(1))
+	assert.Equal(t, int64(1), field("Alarm (Count)").At(1))
+	assert.Equal(t, new(60.0), field("Alarm (TotalDuration)").At(1))
+}
@@ -0,0 +1,165 @@
+package datasource
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Constants for the event envelope fields
+const (
+	OutsideEnvelopeLabel = "OutsideEnvelope"
+	ReferenceLabel       = "Reference"
+
+	defaultEnvelopeStdDevs = 2.0
+)
+
+// AddEventEnvelope adds the mean, minimum, maximum and mean ± N·stddev of the numeric event columns per offset to the
+// offset based frames of EventQueryResultToTrendDataFrame. Events start at arbitrary times so their columns rarely have
+// a value at the same offset, every value holds until the next value of its column for the statistics. The columns
+// are grouped by property, every event column gets an OutsideEnvelope label that tells if one of its values is outside
+// the stddev band. The column of the reference event is repeated as a reference series.
+func AddEventEnvelope(frames data.Frames, envelope schemas.EventEnvelope) data.Frames {
+	stdDevs := envelope.StdDevs
+	if stdDevs <= 0 {
+		stdDevs = defaultEnvelopeStdDevs
+	}
+
+	for _, frame := range frames {
+		if len(frame.Fields) == 0 || frame.Fields[0].Type() != data.FieldTypeFloat64 {
+			continue
+		}
+
+		properties := []string{}
+		fieldsByProperty := map[string][]*data.Field{}
+		for _, field := range frame.Fields[1:] {
+			if field.Type() != data.FieldTypeNullableFloat64 {
+				continue
+			}
+			property := field.Labels[PropertyColumnName]
+			if _, ok := fieldsByProperty[property]; !ok {
+				properties = append(properties, property)
+			}
+			fieldsByProperty[property] = append(fieldsByProperty[property], field)
+		}
+
+		for _, property := range properties {
+			frame.Fields = append(frame.Fields, envelopeFields(property, fieldsByProperty[property], frame.Rows(), stdDevs, envelope.ReferenceEventUUID)...)
+		}
+	}
+
+	return frames
+}
+
+// envelopeFields returns the envelope fields over the given event columns of one property
+func envelopeFields(property string, fields []*data.Field, rows int, stdDevs float64, referenceEventUUID string) []*data.Field {
+	means := make([]*float64, rows)
+	minimums := make([]*float64, rows)
+	maximums := make([]*float64, rows)
+	lowerBounds := make([]*float64, rows)
+	upperBounds := make([]*float64, rows)
+	heldColumns := make([][]*float64, len(fields))
+	for i, field := range fields {
+		heldColumns[i] = heldValues(field, rows)
+	}
+	for i := range rows {
+		count, sum, sumOfSquares := 0, 0.0, 0.0
+		minimum, maximum := math.Inf(1), math.Inf(-1)
+		for _, held := range heldColumns {
+			if held[i] == nil {
+				continue
+			}
+			v := *held[i]
+			count++
+			sum += v
+			sumOfSquares += v * v
+			minimum = math.Min(minimum, v)
+			maximum = math.Max(maximum, v)
+		}
+		if count == 0 {
+			continue
+		}
+
+		mean := sum / float64(count)
+		stdDev := math.Sqrt(math.Max(sumOfSquares/float64(count)-mean*mean, 0))
+		means[i] = new(mean)
+		minimums[i] = new(minimum)
+		maximums[i] = new(maximum)
+		lowerBounds[i] = new(mean - stdDevs*stdDev)
+		upperBounds[i] = new(mean + stdDevs*stdDev)
+	}
+
+	var reference *data.Field
+	for _, field := range fields {
+		outside := false
+		for i := range rows {
+			value, ok := field.ConcreteAt(i)
+			if !ok {
+				continue
+			}
+			if v := value.(float64); v < *lowerBounds[i] || v > *upperBounds[i] {
+				outside = true
+				break
+			}
+		}
+		if field.Labels == nil {
+			field.Labels = data.Labels{}
+		}
+		field.Labels[OutsideEnvelopeLabel] = strconv.FormatBool(outside)
+
+		if referenceEventUUID != "" && field.Labels[EventUUIDColumnName] == referenceEventUUID && reference == nil {
+			reference = data.NewField(fmt.Sprintf("%s (reference)", property), data.Labels{PropertyColumnName: property, ReferenceLabel: referenceEventUUID}, make([]*float64, rows))
+			for i := range rows {
+				reference.Set(i, field.At(i))
+			}
+			reference.Config = envelopeFieldConfig(field)
+		}
+	}
+
+	envelope := []*data.Field{
+		data.NewField(fmt.Sprintf("%s (mean)", property), data.Labels{PropertyColumnName: property}, means),
+		data.NewField(fmt.Sprintf("%s (min)", property), data.Labels{PropertyColumnName: property}, minimums),
+		data.NewField(fmt.Sprintf("%s (max)", property), data.Labels{PropertyColumnName: property}, maximums),
+		data.NewField(fmt.Sprintf("%s (mean - %g stddev)", property, stdDevs), data.Labels{PropertyColumnName: property}, lowerBounds),
+		data.NewField(fmt.Sprintf("%s (mean + %g stddev)", property, stdDevs), data.Labels{PropertyColumnName: property}, upperBounds),
+	}
+	for _, field := range envelope {
+		field.Config = envelopeFieldConfig(fields[0])
+	}
+	if reference != nil {
+		envelope = append(envelope, reference)
+	}
+
+	return envelope
+}
+
+// heldValues returns the value of an event column at every row of the offset frame, a value holds until the next value
+// of the column. Rows before the first and after the last value of the column are outside the event and have none.
+func heldValues(field *data.Field, rows int) []*float64 {
+	values := make([]*float64, rows)
+	var current *float64
+	last := -1
+	for i := range rows {
+		if value, ok := field.ConcreteAt(i); ok {
+			current = new(value.(float64))
+			last = i
+		}
+		values[i] = current
+	}
+	for i := last + 1; i < rows; i++ {
+		values[i] = nil
+	}
+	return values
+}
+
+// envelopeFieldConfig returns the field config of an envelope field with the unit of the event column
+func envelopeFieldConfig(field *data.Field) *data.FieldConfig {
+	if field.Config == nil {
+		return nil
+	}
+
+	return &data.FieldConfig{Unit: field.Config.Unit}
+}
@@ -0,0 +1,81 @@
+package datasource
+
+import (
+	"testing"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddEventEnvelope(t *testing.T) {
+	t.Parallel()
+
+	column := func(eventUUID string, values ...*float64) *data.Field {
+		return data.NewField("Temperature ("+eventUUID+")", data.Labels{PropertyColumnName: "Temperature", EventUUIDColumnName: eventUUID}, values)
+	}
+	frame := data.NewFrame("Result",
+		data.NewField("Offset", nil, []float64{0, 60}),
+		column("a", new(10.0), new(20.0)),
+		column("b", new(12.0), new(22.0)),
+		column("c", new(14.0), nil),
+		data.NewField("Phase (a)", data.Labels{PropertyColumnName: "Phase", EventUUIDColumnName: "a"}, []*string{new("heating"), nil}),
+	)
+
+	frames := AddEventEnvelope(data.Frames{frame}, schemas.EventEnvelope{StdDevs: 1, ReferenceEventUUID: "b"})
+	require.Len(t, frames, 1)
+	assert.Equal(t, []string{
+		"Offset", "Temperature (a)", "Temperature (b)", "Temperature (c)", "Phase (a)",
+		"Temperature (mean)", "Temperature (min)", "Temperature (max)", "Temperature (mean - 1 stddev)", "Temperature (mean + 1 stddev)", "Temperature (reference)",
+	}, fieldNames(frame))
+
+	field := func(name string) *data.Field {
+		f, _ := frame.FieldByName(name)
+		require.NotNil(t, f, name)
+		return f
+	}
+	assert.Equal(t, new(12.0), field("Temperature (mean)").At(0))
+	assert.Equal(t, new(21.0), field("Temperature (mean)").At(1))
+	assert.Equal(t, new(10.0), field("Temperature (min)").At(0))
+	assert.Equal(t, new(22.0), field("Temperature (max)").At(1))
+	assert.InDelta(t, 13.633, *field("Temperature (mean + 1 stddev)").At(0).(*float64), 0.001)
+	assert.InDelta(t, 20.0, *field("Temperature (mean - 1 stddev)").At(1).(*float64), 0.001)
+	assert.Equal(t, new(22.0), field("Temperature (reference)").At(1))
+
+	assert.Equal(t, "true", field("Temperature (a)").Labels[OutsideEnvelopeLabel])
+	assert.Equal(t, "false", field("Temperature (b)").Labels[OutsideEnvelopeLabel])
+	assert.Equal(t, "true", field("Temperature (c)").Labels[OutsideEnvelopeLabel])
+	assert.NotContains(t, field("Phase (a)").Labels, OutsideEnvelopeLabel)
+}
+
+func TestAddEventEnvelope_MisalignedOffsets(t *testing.T) {
+	t.Parallel()
+
+	// Every event has its own offsets, so no row holds a value of more than one event
+	column := func(eventUUID string, values ...*float64) *data.Field {
+		return data.NewField("Temperature ("+eventUUID+")", data.Labels{PropertyColumnName: "Temperature", EventUUIDColumnName: eventUUID}, values)
+	}
+	frame := data.NewFrame("Result",
+		data.NewField("Offset", nil, []float64{0, 1, 2, 60, 61, 62}),
+		column("a", new(10.0), nil, nil, new(10.0), nil, nil),
+		column("b", nil, new(10.0), nil, nil, new(10.0), nil),
+		column("c", nil, nil, new(30.0), nil, nil, new(30.0)),
+	)
+
+	AddEventEnvelope(data.Frames{frame}, schemas.EventEnvelope{StdDevs: 1})
+
+	field := func(name string) *data.Field {
+		f, _ := frame.FieldByName(name)
+		require.NotNil(t, f, name)
+		return f
+	}
+	assert.Equal(t, new(10.0), field("Temperature (mean)").At(0), "only a has started at offset 0")
+	assert.InDelta(t, 50.0/3, *field("Temperature (mean)").At(2).(*float64), 0.001)
+	assert.InDelta(t, 20.0, *field("Temperature (mean)").At(4).(*float64), 0.001, "a has ended at offset 61")
+	assert.Equal(t, new(30.0), field("Temperature (max)").At(3))
+
+	assert.Equal(t, "false", field("Temperature (a)").Labels[OutsideEnvelopeLabel])
+	assert.Equal(t, "false", field("Temperature (b)").Labels[OutsideEnvelopeLabel])
+	assert.Equal(t, "true", field("Temperature (c)").Labels[OutsideEnvelopeLabel])
+}
@@ -0,0 +1,303 @@
+package datasource
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/util"
+)
+
+// propertyFilterDatatypeDate is the datatype of property filters that compare the values as timestamps, the historian
+// does not know it so these filters are always evaluated by the datasource
+const propertyFilterDatatypeDate = "date"
+
+// historianPropertyFilterOperatorVersions are the property filter operators the historian evaluates, with the first
+// historian version that supports them. An empty version means every historian supports it, operators missing from
+// the map like BETWEEN and LIKE are always evaluated by the datasource.
+var historianPropertyFilterOperatorVersions = map[string]string{
+	"=":           "",
+	"!=":          "",
+	"<":           "",
+	"<=":          "",
+	">":           "",
+	">=":          "",
+	"~":           "7.2.0",
+	"!~":          "7.2.0",
+	"IN":          "7.2.0",
+	"NOT IN":      "7.2.0",
+	"IS NULL":     "7.2.0",
+	"IS NOT NULL": "7.2.0",
+	"EXISTS":      "7.2.0",
+	"NOT EXISTS":  "7.2.0",
+}
+
+// historianSupportsPropertyFilter returns whether the historian version evaluates the property filter itself
+func historianSupportsPropertyFilter(filter schemas.EventPropertyValueFilter, historianInfo *schemas.HistorianInfo) bool {
+	if filter.Datatype == propertyFilterDatatypeDate {
+		return false
+	}
+
+	minimumVersion, ok := historianPropertyFilterOperatorVersions[filter.Operator]
+	if !ok {
+		return false
+	}
+	return minimumVersion == "" || util.CheckMinimumVersion(historianInfo, minimumVersion, false)
+}
+
+// splitPropertyFilters splits the property filters in the ones the historian evaluates and the ones the datasource
+// evaluates on the returned events. The filters are combined in order, so when one of them is evaluated by the
+// datasource and they are not all combined with AND, the datasource evaluates all of them.
+func splitPropertyFilters(filters []schemas.EventPropertyValueFilter, historianInfo *schemas.HistorianInfo) (historianFilters, localFilters []schemas.EventPropertyValueFilter) {
+	onlyAnd := true
+	for i, filter := range filters {
+		if i > 0 && strings.EqualFold(filter.Condition, "OR") {
+			onlyAnd = false
+		}
+	}
+
+	for _, filter := range filters {
+		if historianSupportsPropertyFilter(filter, historianInfo) {
+			historianFilters = append(historianFilters, filter)
+		} else {
+			localFilters = append(localFilters, filter)
+		}
+	}
+
+	if len(localFilters) > 0 && !onlyAnd {
+		return nil, filters
+	}
+	return historianFilters, localFilters
+}
+
+// filterEventsByProperties returns the events that match the property filters, the filters are combined in order
+// with the condition of each filter after the first one
+func filterEventsByProperties(events []schemas.Event, filters []schemas.EventPropertyValueFilter) ([]schemas.Event, error) {
+	if len(filters) == 0 {
+		return events, nil
+	}
+
+	matchers := make([]func(*schemas.Event) bool, len(filters))
+	for i := range filters {
+		matcher, err := propertyFilterMatcher(filters[i])
+		if err != nil {
+			return nil, err
+		}
+		matchers[i] = matcher
+	}
+
+	filtered := make([]schemas.Event, 0, len(events))
+	for i := range events {
+		matches := matchers[0](&events[i])
+		for j := 1; j < len(filters); j++ {
+			if strings.EqualFold(filters[j].Condition, "OR") {
+				matches = matches || matchers[j](&events[i])
+			} else {
+				matches = matches && matchers[j](&events[i])
+			}
+		}
+		if matches {
+			filtered = append(filtered, events[i])
+		}
+	}
+	return filtered, nil
+}
+
+// propertyFilterMatcher returns a function that tells if an event matches the property filter
+func propertyFilterMatcher(filter schemas.EventPropertyValueFilter) (func(*schemas.Event) bool, error) {
+	property := func(event *schemas.Event) (interface{}, bool) {
+		if filter.Parent {
+			event = event.Parent
+		}
+		if event == nil || event.Properties == nil {
+			return nil, false
+		}
+		value, ok := event.Properties.Properties[filter.Property]
+		return value, ok
+	}
+	compare := func(event *schemas.Event, filterValue interface{}) (int, bool) {
+		value, ok := property(event)
+		if !ok || value == nil {
+			return 0, false
+		}
+		return comparePropertyValues(filter.Datatype, value, filterValue)
+	}
+	value := func(i int) (interface{}, error) {
+		if len(filter.Value) <= i {
+			return nil, fmt.Errorf("property filter %s %s needs %d values", filter.Property, filter.Operator, i+1)
+		}
+		return filter.Value[i], nil
+	}
+
+	switch strings.ToUpper(filter.Operator) {
+	case "EXISTS", "NOT EXISTS":
+		exists := strings.ToUpper(filter.Operator) == "EXISTS"
+		return func(event *schemas.Event) bool {
+			_, ok := property(event)
+			return ok == exists
+		}, nil
+	case "IS NULL", "IS NOT NULL":
+		isNull := strings.ToUpper(filter.Operator) == "IS NULL"
+		return func(event *schemas.Event) bool {
+			value, _ := property(event)
+			return (value == nil) == isNull
+		}, nil
+	case "IN", "NOT IN", "=", "!=":
+		in := filter.Operator == "IN" || filter.Operator == "="
+		return func(event *schemas.Event) bool {
+			for _, filterValue := range filter.Value {
+				if result, ok := compare(event, filterValue); ok && result == 0 {
+					return in
+				}
+			}
+			return !in
+		}, nil
+	case "<", "<=", ">", ">=":
+		filterValue, err := value(0)
+		if err != nil {
+			return nil, err
+		}
+		return func(event *schemas.Event) bool {
+			result, ok := compare(event, filterValue)
+			if !ok {
+				return false
+			}
+			switch filter.Operator {
+			case "<":
+				return result < 0
+			case "<=":
+				return result <= 0
+			case ">":
+				return result > 0
+			default:
+				return result >= 0
+			}
+		}, nil
+	case "BETWEEN", "NOT BETWEEN":
+		low, err := value(0)
+		if err != nil {
+			return nil, err
+		}
+		high, err := value(1)
+		if err != nil {
+			return nil, err
+		}
+		between := strings.ToUpper(filter.Operator) == "BETWEEN"
+		return func(event *schemas.Event) bool {
+			lowResult, lowOK := compare(event, low)
+			highResult, highOK := compare(event, high)
+			if !lowOK || !highOK {
+				return false
+			}
+			return (lowResult >= 0 && highResult <= 0) == between
+		}, nil
+	case "~", "!~", "LIKE", "NOT LIKE":
+		filterValue, err := value(0)
+		if err != nil {
+			return nil, err
+		}
+		pattern, _ := toString(filterValue)
+		operator := strings.ToUpper(filter.Operator)
+		if operator == "LIKE" || operator == "NOT LIKE" {
+			pattern = likeToRegex(pattern)
+		} else if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			pattern = pattern[1 : len(pattern)-1]
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern for property filter %s: %w", filter.Property, err)
+		}
+		match := operator == "~" || operator == "LIKE"
+		return func(event *schemas.Event) bool {
+			value, ok := property(event)
+			if !ok || value == nil {
+				return false
+			}
+			stringValue, ok := toString(value)
+			return ok && re.MatchString(stringValue) == match
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported property filter operator %s", filter.Operator)
+	}
+}
+
+// comparePropertyValues compares an event property value to a filter value as the datatype of the filter, it
+// returns false when the values can not be compared
+func comparePropertyValues(datatype string, value, filterValue interface{}) (int, bool) {
+	switch datatype {
+	case string(schemas.EventTypePropertyDatatypeNumber):
+		a, okA := toFloat64(value)
+		b, okB := toFloat64(filterValue)
+		if !okA || !okB {
+			return 0, false
+		}
+		switch {
+		case a < b:
+			return -1, true
+		case a > b:
+			return 1, true
+		default:
+			return 0, true
+		}
+	case string(schemas.EventTypePropertyDatatypeBool):
+		a, okA := toBool(value)
+		b, okB := toBool(filterValue)
+		if !okA || !okB {
+			return 0, false
+		}
+		if a == b {
+			return 0, true
+		}
+		if !a {
+			return -1, true
+		}
+		return 1, true
+	case propertyFilterDatatypeDate:
+		a, okA := toTime(value)
+		b, okB := toTime(filterValue)
+		if !okA || !okB {
+			return 0, false
+		}
+		return a.Compare(b), true
+	default:
+		a, okA := toString(value)
+		b, okB := toString(filterValue)
+		if !okA || !okB {
+			return 0, false
+		}
+		return strings.Compare(a, b), true
+	}
+}
+
+// toTime parses an RFC 3339 timestamp or a unix timestamp in milliseconds, like the ones of Grafana's ${__from}
+func toTime(v interface{}) (time.Time, bool) {
+	if s, ok := v.(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t, true
+		}
+	}
+	if ms, ok := toFloat64(v); ok {
+		return time.UnixMilli(int64(ms)), true
+	}
+	return time.Time{}, false
+}
+
+// likeToRegex converts a LIKE pattern, in which % matches any text and _ any character, to an anchored regular expression
+func likeToRegex(pattern string) string {
+	var builder strings.Builder
+	builder.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			builder.WriteString(".*")
+		case '_':
+			builder.WriteString(".")
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	builder.WriteString("$")
+	return builder.String()
+}
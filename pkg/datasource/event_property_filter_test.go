@@ -0,0 +1,124 @@
+package datasource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterEventsByProperties(t *testing.T) {
+	t.Parallel()
+
+	event := func(properties schemas.Attributes) schemas.Event {
+		return schemas.Event{UUID: uuid.New(), StartTime: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Properties: &schemas.EventProperties{Properties: properties}}
+	}
+	events := []schemas.Event{
+		event(schemas.Attributes{"Batch": "B-100", "Amount": 5.0, "Released": "2026-01-02T00:00:00Z"}),
+		event(schemas.Attributes{"Batch": "B-200", "Amount": 15.0, "Released": "2026-02-02T00:00:00Z"}),
+		event(schemas.Attributes{"Batch": "X-300", "Amount": 25.0}),
+	}
+	parent := event(schemas.Attributes{"Campaign": "C1"})
+	events[2].Parent = &parent
+
+	tests := []struct {
+		name    string
+		filters []schemas.EventPropertyValueFilter
+		want    []int
+	}{
+		{
+			name:    "between",
+			filters: []schemas.EventPropertyValueFilter{{Property: "Amount", Datatype: "number", Operator: "BETWEEN", Value: []interface{}{5.0, 15.0}}},
+			want:    []int{0, 1},
+		},
+		{
+			name:    "not between",
+			filters: []schemas.EventPropertyValueFilter{{Property: "Amount", Datatype: "number", Operator: "NOT BETWEEN", Value: []interface{}{"6", "30"}}},
+			want:    []int{0},
+		},
+		{
+			name:    "regex",
+			filters: []schemas.EventPropertyValueFilter{{Property: "Batch", Datatype: "string", Operator: "~", Value: []interface{}{"/^B-[12]00$/"}}},
+			want:    []int{0, 1},
+		},
+		{
+			name:    "like",
+			filters: []schemas.EventPropertyValueFilter{{Property: "Batch", Datatype: "string", Operator: "NOT LIKE", Value: []interface{}{"B-%"}}},
+			want:    []int{2},
+		},
+		{
+			name:    "date",
+			filters: []schemas.EventPropertyValueFilter{{Property: "Released", Datatype: "date", Operator: ">", Value: []interface{}{"2026-01-15T00:00:00Z"}}},
+			want:    []int{1},
+		},
+		{
+			name:    "in",
+			filters: []schemas.EventPropertyValueFilter{{Property: "Batch", Datatype: "string", Operator: "IN", Value: []interface{}{"B-200", "X-300"}}},
+			want:    []int{1, 2},
+		},
+		{
+			name:    "not exists",
+			filters: []schemas.EventPropertyValueFilter{{Property: "Released", Operator: "NOT EXISTS"}},
+			want:    []int{2},
+		},
+		{
+			name:    "parent",
+			filters: []schemas.EventPropertyValueFilter{{Property: "Campaign", Datatype: "string", Operator: "=", Value: []interface{}{"C1"}, Parent: true}},
+			want:    []int{2},
+		},
+		{
+			name: "conditions",
+			filters: []schemas.EventPropertyValueFilter{
+				{Property: "Amount", Datatype: "number", Operator: "<", Value: []interface{}{10.0}},
+				{Property: "Batch", Datatype: "string", Operator: "LIKE", Value: []interface{}{"X%"}, Condition: "OR"},
+			},
+			want: []int{0, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			filtered, err := filterEventsByProperties(events, tt.filters)
+			require.NoError(t, err)
+			want := make([]schemas.Event, len(tt.want))
+			for i, index := range tt.want {
+				want[i] = events[index]
+			}
+			assert.Equal(t, want, filtered)
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+		_, err := filterEventsByProperties(events, []schemas.EventPropertyValueFilter{{Property: "Batch", Operator: "~", Value: []interface{}{"("}}})
+		assert.Error(t, err)
+		_, err = filterEventsByProperties(events, []schemas.EventPropertyValueFilter{{Property: "Amount", Operator: "BETWEEN", Value: []interface{}{1.0}}})
+		assert.Error(t, err)
+	})
+}
+
+func TestSplitPropertyFilters(t *testing.T) {
+	t.Parallel()
+
+	equal := schemas.EventPropertyValueFilter{Property: "Batch", Operator: "="}
+	regex := schemas.EventPropertyValueFilter{Property: "Batch", Operator: "~", Condition: "AND"}
+	between := schemas.EventPropertyValueFilter{Property: "Amount", Operator: "BETWEEN", Condition: "AND"}
+
+	historianFilters, localFilters := splitPropertyFilters([]schemas.EventPropertyValueFilter{equal, regex, between}, &schemas.HistorianInfo{Version: "v7.2.0"})
+	assert.Equal(t, []schemas.EventPropertyValueFilter{equal, regex}, historianFilters)
+	assert.Equal(t, []schemas.EventPropertyValueFilter{between}, localFilters)
+
+	historianFilters, localFilters = splitPropertyFilters([]schemas.EventPropertyValueFilter{equal, regex}, &schemas.HistorianInfo{Version: "v7.1.0"})
+	assert.Equal(t, []schemas.EventPropertyValueFilter{equal}, historianFilters)
+	assert.Equal(t, []schemas.EventPropertyValueFilter{regex}, localFilters)
+
+	or := between
+	or.Condition = "OR"
+	historianFilters, localFilters = splitPropertyFilters([]schemas.EventPropertyValueFilter{equal, or}, &schemas.HistorianInfo{Version: "v7.2.0"})
+	assert.Empty(t, historianFilters)
+	assert.Equal(t, []schemas.EventPropertyValueFilter{equal, or}, localFilters)
+}
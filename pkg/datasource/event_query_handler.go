@@ -4,21 +4,48 @@ import (
 	"context"
 	"fmt"
 	"maps"
-	"math"
 	"net/url"
 	"slices"
 	"time"
 
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/api"
 	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
 	"github.com/factrylabs/factry-historian-datasource.git/pkg/util"
 	"github.com/google/uuid"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
 )
 
+// maxEventQueryEvents is the maximum number of events an event query returns, also when the query has a higher or no limit
+const maxEventQueryEvents = 100000
+
+// eventAssetPropertyConcurrency is the maximum number of asset property queries that run at the same time for an event query
+const eventAssetPropertyConcurrency = 10
+
+// assetPropertyColumn identifies the column of an asset property in the event table. The aggregation is kept apart
+// from the name, so the min of Temperature does not share a column with a property named "Temperature (min)".
+type assetPropertyColumn struct {
+	Name        string
+	Aggregation string
+}
+
+// field returns an empty field for the column, aggregated columns carry the aggregation as label
+func (c assetPropertyColumn) field(fieldType data.FieldType) *data.Field {
+	field := data.NewFieldFromFieldType(fieldType, 0)
+	field.Name = c.Name
+	if c.Aggregation != "" {
+		field.Labels = data.Labels{"aggregation": c.Aggregation}
+		field.Config = &data.FieldConfig{DisplayNameFromDS: fmt.Sprintf("%s (%s)", c.Name, c.Aggregation)}
+	}
+	return field
+}
+
 func (ds *HistorianDataSource) handleEventQuery(ctx context.Context, eventQuery schemas.EventQuery, timeRange backend.TimeRange, interval time.Duration, seriesLimit int, historianInfo *schemas.HistorianInfo) (data.Frames, error) {
-	assets, err := ds.API.GetFilteredAssets(ctx, eventQuery.Assets, historianInfo)
+	hierarchyOptions := api.AssetHierarchyOptions{Recursive: eventQuery.Recursive, MaxDepth: eventQuery.MaxDepth}
+	assets, err := ds.API.GetFilteredAssetsWithDescendants(ctx, eventQuery.Assets, hierarchyOptions, historianInfo)
 	if err != nil {
 		return nil, err
 	}
@@ -37,9 +64,9 @@ func (ds *HistorianDataSource) handleEventQuery(ctx context.Context, eventQuery
 		return data.Frames{}, nil
 	}
 
-	limit := math.MaxInt
+	limit := maxEventQueryEvents
 	if eventQuery.Limit > 0 {
-		limit = eventQuery.Limit
+		limit = min(eventQuery.Limit, maxEventQueryEvents)
 	}
 
 	var startTime = &timeRange.From
@@ -50,41 +77,115 @@ func (ds *HistorianDataSource) handleEventQuery(ctx context.Context, eventQuery
 		stopTime = eventQuery.TimeRange.To
 	}
 
+	// Property filters the historian does not support are evaluated on the returned events, so the limit is applied
+	// after them
+	propertyFilters := api.ExpandMultiValuePropertyFilters(eventQuery.PropertyFilter)
+	historianFilters, localFilters := splitPropertyFilters(propertyFilters, historianInfo)
+	// One event more than the limit is requested to know if the result has to be truncated
+	historianLimit := limit + 1
+	if len(localFilters) > 0 {
+		historianLimit = maxEventQueryEvents + 1
+	}
+
 	filter := schemas.EventFilter{
 		StartTime:         startTime,
 		StopTime:          stopTime,
 		AssetUUIDs:        slices.AppendSeq(make([]uuid.UUID, 0, len(assets)), maps.Keys(assets)),
 		EventTypeUUIDs:    slices.AppendSeq(make([]uuid.UUID, 0, len(eventTypes)), maps.Keys(eventTypes)),
 		PreloadProperties: true,
-		Limit:             limit,
-		PropertyFilter:    eventQuery.PropertyFilter,
+		Limit:             historianLimit,
+		PropertyFilter:    historianFilters,
 		Status:            eventQuery.Statuses,
 		Ascending:         eventQuery.Ascending,
 	}
 
 	events, err := ds.API.EventQuery(ctx, filter)
+	if errors.Is(err, api.ErrValidation) && len(historianFilters) > 0 {
+		log.DefaultLogger.Debug("Historian rejected the property filters, evaluating them in the datasource", "error", err)
+		filter.PropertyFilter, filter.Limit, localFilters = nil, maxEventQueryEvents+1, propertyFilters
+		events, err = ds.API.EventQuery(ctx, filter)
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	// The historian matched more events than the safety cap
+	truncated := len(events) > maxEventQueryEvents
+	if truncated {
+		events = events[:maxEventQueryEvents]
+	}
+
+	if len(localFilters) > 0 {
+		events, err = filterEventsByProperties(events, localFilters)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The events are complete when the limit of the query is reached, the safety cap only matters without one
+	if limit < maxEventQueryEvents && len(events) >= limit {
+		truncated = false
+	}
+	if len(events) > limit {
+		events = events[:limit]
+	}
+
+	ancestorDepth := 0
+	if eventQuery.IncludeParentInfo {
+		ancestorDepth = max(eventQuery.ParentDepth, 1)
+	}
+	// Summaries grouped by an ancestor column need the ancestor info as well
+	if eventQuery.Type == schemas.EventQueryTypeSummary {
+		for _, key := range eventQuery.GroupBy {
+			ancestorDepth = max(ancestorDepth, groupByAncestorDepth(key))
+		}
+	}
+
+	if err := ds.loadEventAncestors(ctx, events, ancestorDepth, util.ByUUID(allEventTypes)); err != nil {
+		return nil, err
+	}
+
+	var childEvents []schemas.Event
+	var childEventTypes map[uuid.UUID]schemas.EventType
+	if eventQuery.Type == string(schemas.EventTypePropertyTypeSimple) && eventQuery.ChildEvents != nil {
+		childEventTypes, err = ds.API.GetFilteredEventTypes(ctx, eventQuery.ChildEvents.EventTypes, historianInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		childEvents, err = ds.queryChildEvents(ctx, events, childEventTypes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// get all unique event types from the events
 	eventTypeUUIDs := map[uuid.UUID]struct{}{}
 	missingParentAssetUUIDs := map[uuid.UUID]struct{}{}
 	for i := range events {
 		eventTypeUUIDs[events[i].EventTypeUUID] = struct{}{}
-		if eventQuery.IncludeParentInfo && events[i].Parent != nil {
-			eventTypeUUIDs[events[i].Parent.EventTypeUUID] = struct{}{}
-			parentAssetUUID := events[i].Parent.AssetUUID
-			if _, ok := assets[parentAssetUUID]; !ok {
-				missingParentAssetUUIDs[parentAssetUUID] = struct{}{}
+		for _, ancestor := range eventAncestors(&events[i], ancestorDepth) {
+			if ancestor == nil {
+				break
+			}
+			eventTypeUUIDs[ancestor.EventTypeUUID] = struct{}{}
+			if _, ok := assets[ancestor.AssetUUID]; !ok {
+				missingParentAssetUUIDs[ancestor.AssetUUID] = struct{}{}
 			}
 		}
 	}
+	for i := range childEvents {
+		eventTypeUUIDs[childEvents[i].EventTypeUUID] = struct{}{}
+		if _, ok := assets[childEvents[i].AssetUUID]; !ok {
+			missingParentAssetUUIDs[childEvents[i].AssetUUID] = struct{}{}
+		}
+	}
 
 	// Parent events often live on assets that are not part of the user's selected
 	// asset filter (e.g. user picks leaf assets, parent event lives on the parent
 	// asset). Fetch those assets so the data-frame builders can populate
-	// Parent_Asset and Parent_AssetPath instead of leaving them empty.
+	// Parent_Asset and Parent_AssetPath, and those of the other ancestors and the child events, instead of leaving
+	// them empty.
 	parentAssets := map[uuid.UUID]schemas.Asset{}
 	if len(missingParentAssetUUIDs) > 0 {
 		missingAssetStrings := make([]string, 0, len(missingParentAssetUUIDs))
@@ -98,6 +199,7 @@ func (ds *HistorianDataSource) handleEventQuery(ctx context.Context, eventQuery
 	}
 
 	var eventTypeProperties []schemas.EventTypeProperty
+	onlySimpleProperties := slices.Contains([]string{string(schemas.EventTypePropertyTypeSimple), schemas.EventQueryTypeSummary, schemas.EventQueryTypeActive, schemas.EventQueryTypeAnnotation}, eventQuery.Type)
 	if util.CheckMinimumVersion(historianInfo, "6.4.0", false) {
 		eventTypeQuery := url.Values{}
 		i := 0
@@ -105,8 +207,8 @@ func (ds *HistorianDataSource) handleEventQuery(ctx context.Context, eventQuery
 			eventTypeQuery.Add(fmt.Sprintf("EventTypeUUIDs[%d]", i), eventTypeUUID.String())
 			i++
 		}
-		if eventQuery.Type == string(schemas.EventTypePropertyTypeSimple) {
-			eventTypeQuery.Add("Types[0]", eventQuery.Type)
+		if onlySimpleProperties {
+			eventTypeQuery.Add("Types[0]", string(schemas.EventTypePropertyTypeSimple))
 		}
 		eventTypeProperties, err = ds.API.GetEventTypeProperties(ctx, eventTypeQuery.Encode())
 		if err != nil {
@@ -122,7 +224,7 @@ func (ds *HistorianDataSource) handleEventQuery(ctx context.Context, eventQuery
 			if _, ok := eventTypeUUIDs[eventTypeProperty.EventTypeUUID]; !ok {
 				continue
 			}
-			if eventQuery.Type == string(schemas.EventTypePropertyTypeSimple) && eventTypeProperty.Type != schemas.EventTypePropertyTypeSimple {
+			if onlySimpleProperties && eventTypeProperty.Type != schemas.EventTypePropertyTypeSimple {
 				continue
 			}
 			eventTypeProperties = append(eventTypeProperties, eventTypeProperty)
@@ -139,7 +241,7 @@ func (ds *HistorianDataSource) handleEventQuery(ctx context.Context, eventQuery
 	if eventQuery.QueryAssetProperties && eventQuery.Options != nil {
 		assetMeasurementQueryAssets := assets
 		if len(eventQuery.OverrideAssets) > 0 {
-			assetMeasurementQueryAssets, err = ds.API.GetFilteredAssets(ctx, eventQuery.OverrideAssets, historianInfo)
+			assetMeasurementQueryAssets, err = ds.API.GetFilteredAssetsWithDescendants(ctx, eventQuery.OverrideAssets, hierarchyOptions, historianInfo)
 			if err != nil {
 				return nil, err
 			}
@@ -155,15 +257,52 @@ func (ds *HistorianDataSource) handleEventQuery(ctx context.Context, eventQuery
 			return nil, err
 		}
 
+		// Simple queries can request several aggregations per asset property, each is queried separately and becomes a
+		// separate column
+		aggregations := []*schemas.Aggregation{nil}
+		if eventQuery.Type == string(schemas.EventTypePropertyTypeSimple) && len(eventQuery.AssetPropertyAggregations) > 0 {
+			aggregations = make([]*schemas.Aggregation, len(eventQuery.AssetPropertyAggregations))
+			for i := range eventQuery.AssetPropertyAggregations {
+				aggregations[i] = &eventQuery.AssetPropertyAggregations[i]
+			}
+		}
+
+		// Query the asset properties of the events concurrently, every event and aggregation has its own result slot
+		results := make([]data.Frames, len(events)*len(aggregations))
+		errGroup, groupCtx := errgroup.WithContext(ctx)
+		errGroup.SetLimit(eventAssetPropertyConcurrency)
 		for i := range events {
-			var err error
-			frames, err := ds.handleEventAssetMeasurementQuery(ctx, eventQuery.Type, events[i], assetMeasurementQuery, assetMeasurementQueryAssets, assetProperties, timeRange, interval, seriesLimit)
-			if err != nil {
-				return nil, err
+			for j, aggregation := range aggregations {
+				// Every query gets its own aggregation, the period is set per event
+				query := assetMeasurementQuery
+				if aggregation != nil {
+					query.Options.Aggregation = new(*aggregation)
+				} else if query.Options.Aggregation != nil {
+					query.Options.Aggregation = new(*query.Options.Aggregation)
+				}
+
+				errGroup.Go(func() error {
+					frames, err := ds.handleEventAssetMeasurementQuery(groupCtx, eventQuery.Type, events[i], query, assetMeasurementQueryAssets, assetProperties, timeRange, interval, seriesLimit)
+					if err != nil {
+						return err
+					}
+
+					setAssetPropertyAggregation(frames, aggregation)
+					results[i*len(aggregations)+j] = frames
+					return nil
+				})
 			}
+		}
+
+		if err := errGroup.Wait(); err != nil {
+			return nil, err
+		}
 
-			if len(frames) > 0 {
-				eventAssetPropertyFrames[events[i].UUID] = frames
+		for i := range events {
+			for j := range aggregations {
+				if frames := results[i*len(aggregations)+j]; len(frames) > 0 {
+					eventAssetPropertyFrames[events[i].UUID] = append(eventAssetPropertyFrames[events[i].UUID], frames...)
+				}
 			}
 		}
 	}
@@ -179,19 +318,226 @@ func (ds *HistorianDataSource) handleEventQuery(ctx context.Context, eventQuery
 	assetsForFrames := slices.AppendSeq(make([]schemas.Asset, 0, len(assets)+len(parentAssets)), maps.Values(assets))
 	assetsForFrames = slices.AppendSeq(assetsForFrames, maps.Values(parentAssets))
 
+	var frames data.Frames
 	switch eventQuery.Type {
 	case string(schemas.EventTypePropertyTypeSimple):
 		assetPropertyFieldTypes := getAssetPropertyFieldTypes(eventAssetPropertyFrames, multipleAssetsSelected)
-		return EventQueryResultToDataFrame(eventQuery.IncludeParentInfo, multipleAssetsSelected, assetsForFrames, events, allEventTypes, eventTypeProperties, selectedPropertiesSet, assetPropertyFieldTypes, eventAssetPropertyFrames)
-	case string(schemas.EventTypePropertyTypePeriodic):
-		return EventQueryResultToTrendDataFrame(eventQuery.IncludeParentInfo, assetsForFrames, events, util.ByUUID(allEventTypes), eventTypePropertiesByEventType, selectedPropertiesSet, eventAssetPropertyFrames, false)
-	case string(schemas.EventTypePropertyTypePeriodicWithDimension):
-		return EventQueryResultToTrendDataFrame(eventQuery.IncludeParentInfo, assetsForFrames, events, util.ByUUID(allEventTypes), eventTypePropertiesByEventType, selectedPropertiesSet, eventAssetPropertyFrames, true)
+		frames, err = EventQueryResultToDataFrame(ancestorDepth, multipleAssetsSelected, assetsForFrames, events, allEventTypes, eventTypeProperties, selectedPropertiesSet, assetPropertyFieldTypes, eventAssetPropertyFrames)
+		if err != nil || eventQuery.ChildEvents == nil {
+			break
+		}
+		if eventQuery.ChildEvents.Aggregate {
+			frames = AddChildEventColumns(frames, childEvents, childEventTypes)
+			break
+		}
+
+		// The child events are returned as separate frames per event type, linked to their parent by ParentEventUUID
+		var childFrames data.Frames
+		childFrames, err = EventQueryResultToDataFrame(0, false, assetsForFrames, childEvents, allEventTypes, eventTypeProperties, map[string]struct{}{}, map[assetPropertyColumn]data.FieldType{}, map[uuid.UUID]data.Frames{})
+		frames = append(frames, childFrames...)
+	case string(schemas.EventTypePropertyTypePeriodic), string(schemas.EventTypePropertyTypePeriodicWithDimension):
+		if eventQuery.WallClockTime {
+			frames, err = EventQueryResultToTrendDataFrame(ancestorDepth, assetsForFrames, events, util.ByUUID(allEventTypes), eventTypePropertiesByEventType, selectedPropertiesSet, eventAssetPropertyFrames, false)
+			if err == nil {
+				frames = TrendDataFrameToTimeSeries(frames, events)
+			}
+			break
+		}
+		byDimension := eventQuery.Type == string(schemas.EventTypePropertyTypePeriodicWithDimension)
+		frames, err = EventQueryResultToTrendDataFrame(ancestorDepth, assetsForFrames, events, util.ByUUID(allEventTypes), eventTypePropertiesByEventType, selectedPropertiesSet, eventAssetPropertyFrames, byDimension)
+		if err == nil && eventQuery.Envelope != nil {
+			frames = AddEventEnvelope(frames, *eventQuery.Envelope)
+		}
+	case schemas.EventQueryTypeSummary:
+		frames, err = EventQueryResultToSummaryDataFrame(assetsForFrames, events, util.ByUUID(allEventTypes), eventTypeProperties, selectedPropertiesSet, eventQuery.GroupBy)
+	case schemas.EventQueryTypeActive:
+		property := ""
+		if len(eventQuery.Properties) > 0 {
+			property = eventQuery.Properties[0]
+		}
+		from, to := timeRange.From, timeRange.To
+		if startTime != nil {
+			from = *startTime
+		}
+		if stopTime != nil {
+			to = *stopTime
+		}
+		frames, err = EventQueryResultToActiveDataFrame(assetsForFrames, events, util.ByUUID(allEventTypes), property, from, to, interval)
+	case schemas.EventQueryTypeAnnotation:
+		frames, err = EventQueryResultToAnnotationDataFrame(assetsForFrames, events, util.ByUUID(allEventTypes), eventQuery.Annotation, eventQuery.Properties, time.Now())
 	default:
 		return nil, fmt.Errorf("unsupported event query type %s", eventQuery.Type)
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	if truncated {
+		addTruncatedEventsNotice(frames, maxEventQueryEvents, eventQuery.Limit > 0)
+	}
+	return frames, nil
 }
 
+// addTruncatedEventsNotice adds a warning to the first frame that only the first events of the query are returned,
+// a limit is only suggested when the query has none
+func addTruncatedEventsNotice(frames data.Frames, maxEvents int, limitSet bool) {
+	if len(frames) == 0 {
+		return
+	}
+
+	if frames[0].Meta == nil {
+		frames[0].Meta = &data.FrameMeta{}
+	}
+	text := fmt.Sprintf("The query matched more than %d events, only the first %d are shown. Narrow the time range or the filters, or set a limit.", maxEvents, maxEvents)
+	if limitSet {
+		text = fmt.Sprintf("The query matched more than %d events, only the first %d are shown as no query returns more. Narrow the time range or the filters.", maxEvents, maxEvents)
+	}
+	frames[0].Meta.Notices = append(frames[0].Meta.Notices, data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text:     text,
+	})
+}
+
+// loadEventAncestors makes sure the ancestors of the events are loaded up to the given depth, one level at a time.
+// The historian only returns the parent of an event, the ancestors above it are queried by the parent event type of
+// their children within the time range of the children, as a parent event spans its children.
+func (ds *HistorianDataSource) loadEventAncestors(ctx context.Context, events []schemas.Event, depth int, eventTypes map[uuid.UUID]schemas.EventType) error {
+	level := make([]*schemas.Event, 0, len(events))
+	for i := range events {
+		level = append(level, &events[i])
+	}
+
+	for range depth {
+		nextLevel := []*schemas.Event{}
+		missingParents := map[uuid.UUID][]*schemas.Event{}
+		children := []schemas.Event{}
+		for _, event := range level {
+			if event.Parent != nil {
+				nextLevel = append(nextLevel, event.Parent)
+			} else if event.ParentUUID != nil {
+				missingParents[*event.ParentUUID] = append(missingParents[*event.ParentUUID], event)
+				children = append(children, *event)
+			}
+		}
+
+		if len(missingParents) > 0 {
+			filter := eventsTimeRangeFilter(children, time.Now())
+			filter.EventTypeUUIDs = parentEventTypeUUIDs(children, eventTypes)
+			filter.PreloadProperties = true
+			parents, err := ds.API.EventQuery(ctx, filter)
+			if err != nil {
+				return err
+			}
+
+			// Other events of the parent event types in the time range are left out
+			for i := range parents {
+				parentChildren, ok := missingParents[parents[i].UUID]
+				if !ok {
+					continue
+				}
+				delete(missingParents, parents[i].UUID)
+				for _, child := range parentChildren {
+					child.Parent = &parents[i]
+				}
+				nextLevel = append(nextLevel, &parents[i])
+			}
+		}
+
+		if len(nextLevel) == 0 {
+			return nil
+		}
+		level = nextLevel
+	}
+
+	return nil
+}
+
+// eventsTimeRangeFilter returns an event filter for the time range from the first start to the last stop of the
+// events, open events are taken to stop at now. The filter is limited to the maximum number of events of a query.
+func eventsTimeRangeFilter(events []schemas.Event, now time.Time) schemas.EventFilter {
+	var startTime, stopTime time.Time
+	for i, event := range events {
+		eventStopTime := now
+		if event.StopTime != nil {
+			eventStopTime = *event.StopTime
+		}
+		if i == 0 || event.StartTime.Before(startTime) {
+			startTime = event.StartTime
+		}
+		if i == 0 || eventStopTime.After(stopTime) {
+			stopTime = eventStopTime
+		}
+	}
+
+	return schemas.EventFilter{
+		StartTime: &startTime,
+		StopTime:  &stopTime,
+		Limit:     maxEventQueryEvents,
+		Ascending: true,
+	}
+}
+
+// parentEventTypeUUIDs returns the parent event types of the event types of the events, or nil when the parent type
+// of one of them is unknown so the events are not filtered on their type
+func parentEventTypeUUIDs(events []schemas.Event, eventTypes map[uuid.UUID]schemas.EventType) []uuid.UUID {
+	parentTypes := map[uuid.UUID]struct{}{}
+	for _, event := range events {
+		eventType, ok := eventTypes[event.EventTypeUUID]
+		if !ok || eventType.ParentUUID == nil {
+			return nil
+		}
+		parentTypes[*eventType.ParentUUID] = struct{}{}
+	}
+
+	return slices.AppendSeq(make([]uuid.UUID, 0, len(parentTypes)), maps.Keys(parentTypes))
+}
+
+// queryChildEvents returns the child events of the given event types of the events. The children are queried within
+// the time range of the events, as a parent event spans its children, and the events of the child event types that
+// belong to other parents are left out.
+func (ds *HistorianDataSource) queryChildEvents(ctx context.Context, events []schemas.Event, eventTypes map[uuid.UUID]schemas.EventType) ([]schemas.Event, error) {
+	if len(events) == 0 || len(eventTypes) == 0 {
+		return nil, nil
+	}
+
+	parentUUIDs := make(map[uuid.UUID]struct{}, len(events))
+	for i := range events {
+		parentUUIDs[events[i].UUID] = struct{}{}
+	}
+
+	filter := eventsTimeRangeFilter(events, time.Now())
+	filter.EventTypeUUIDs = slices.AppendSeq(make([]uuid.UUID, 0, len(eventTypes)), maps.Keys(eventTypes))
+	filter.PreloadProperties = true
+	childEvents, err := ds.API.EventQuery(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(childEvents, func(event schemas.Event) bool {
+		if event.ParentUUID == nil {
+			return true
+		}
+		_, ok := parentUUIDs[*event.ParentUUID]
+		return !ok
+	}), nil
+}
+
+// groupByAncestorDepth returns the number of ancestor levels a summary group by key refers to, e.g. 2 for
+// Grandparent_Asset or Parent_Parent_Asset
+func groupByAncestorDepth(key string) int {
+	depth := 0
+	for {
+		level, rest, ok := cutAncestorPrefix(key)
+		if !ok {
+			return depth
+		}
+		depth += level
+		key = rest
+	}
+}
+
+// handleEventAssetMeasurementQuery queries the asset properties during an event, with several aggregations they are
+// all requested in one query
 func (ds *HistorianDataSource) handleEventAssetMeasurementQuery(ctx context.Context, queryType string, event schemas.Event, assetMeasurementQuery schemas.AssetMeasurementQuery, assets map[uuid.UUID]schemas.Asset, assetProperties []schemas.AssetProperty, timeRange backend.TimeRange, interval time.Duration, seriesLimit int) (data.Frames, error) {
 	if assetMeasurementQuery.Options.Aggregation == nil {
 		return nil, errors.New("no aggregation specified")
@@ -247,48 +593,69 @@ func (ds *HistorianDataSource) handleEventAssetMeasurementQuery(ctx context.Cont
 	return sortByStatus(setAssetFrameNames(frames, assets, measurementIndexToPropertyMap, measurementQuery.Options)), nil
 }
 
-func getAssetPropertyFieldTypes(eventAssetPropertyFrames map[uuid.UUID]data.Frames, includeAssetPath bool) map[string]data.FieldType {
-	assetPropertyFieldTypes := map[string]data.FieldType{}
+func getAssetPropertyFieldTypes(eventAssetPropertyFrames map[uuid.UUID]data.Frames, includeAssetPath bool) map[assetPropertyColumn]data.FieldType {
+	assetPropertyFieldTypes := map[assetPropertyColumn]data.FieldType{}
 	for _, frames := range eventAssetPropertyFrames {
 		for _, frame := range frames {
-			name, ok := getAssetPropertyFieldName(frame, includeAssetPath)
+			column, ok := getAssetPropertyColumn(frame, includeAssetPath)
 			if !ok {
 				continue
 			}
 
-			fieldType, ok := assetPropertyFieldTypes[name]
+			fieldType, ok := assetPropertyFieldTypes[column]
 			if !ok {
-				assetPropertyFieldTypes[name] = frame.Fields[1].Type()
+				assetPropertyFieldTypes[column] = frame.Fields[1].Type()
 				continue
 			}
 
 			if fieldType != frame.Fields[1].Type() {
-				assetPropertyFieldTypes[name] = data.FieldTypeNullableString
+				assetPropertyFieldTypes[column] = data.FieldTypeNullableString
 			}
 		}
 	}
 	return assetPropertyFieldTypes
 }
 
-func getAssetPropertyFieldName(frame *data.Frame, includeAssetPath bool) (string, bool) {
+func getAssetPropertyColumn(frame *data.Frame, includeAssetPath bool) (assetPropertyColumn, bool) {
 	custom, ok := frame.Meta.Custom.(map[string]interface{})
 	if !ok {
-		return "", false
+		return assetPropertyColumn{}, false
 	}
 
 	name, ok := custom["AssetProperty"].(string)
 	if !ok {
-		return "", false
+		return assetPropertyColumn{}, false
 	}
 
+	aggregation, _ := custom["Aggregation"].(string)
 	if !includeAssetPath {
-		return name, true
+		return assetPropertyColumn{Name: name, Aggregation: aggregation}, true
 	}
 
 	assetPath, ok := custom["AssetPath"].(string)
 	if !ok {
-		return "", false
+		return assetPropertyColumn{}, false
+	}
+
+	return assetPropertyColumn{Name: fmt.Sprintf("%s.%s", assetPath, name), Aggregation: aggregation}, true
+}
+
+// setAssetPropertyAggregation stores the aggregation in the metadata of the frames so each aggregation gets its own column
+func setAssetPropertyAggregation(frames data.Frames, aggregation *schemas.Aggregation) {
+	if aggregation == nil {
+		return
 	}
 
-	return fmt.Sprintf("%s.%s", assetPath, name), true
+	for _, frame := range frames {
+		if frame.Meta == nil {
+			continue
+		}
+
+		custom, ok := frame.Meta.Custom.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		custom["Aggregation"] = string(aggregation.Name)
+	}
 }
@@ -0,0 +1,210 @@
+package datasource
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/google/uuid"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Column names of the event summary frame
+const (
+	CountColumnName         = "Count"
+	TotalDurationColumnName = "TotalDuration"
+	MeanDurationColumnName  = "MeanDuration"
+	MinDurationColumnName   = "MinDuration"
+	MaxDurationColumnName   = "MaxDuration"
+)
+
+// eventSummaryGroup accumulates the statistics of the events in one group
+type eventSummaryGroup struct {
+	keys           []string
+	count          int64
+	durations      []float64
+	propertySums   map[string]float64
+	propertyCounts map[string]int
+}
+
+// EventQueryResultToSummaryDataFrame converts an event query result to a frame with a row per group of events.
+// The events are grouped by the groupBy keys, which are one of the event columns like Asset, AssetPath, EventType
+// or ParentEventUUID, or the name of a simple property. Keys prefixed with Parent_, Grandparent_ or Ancestor<n>_
+// group by the ancestor event.
+// Every row has the number of events, the total, mean, minimum and maximum duration of the stopped events and
+// the sum and mean of the numeric simple properties.
+func EventQueryResultToSummaryDataFrame(assets []schemas.Asset, events []schemas.Event, eventTypes map[uuid.UUID]schemas.EventType, eventTypeProperties []schemas.EventTypeProperty, selectedProperties map[string]struct{}, groupBy []string) (data.Frames, error) {
+	if len(groupBy) == 0 {
+		groupBy = []string{EventTypeColumnName}
+	}
+
+	uuidToAssetMap := make(map[uuid.UUID]schemas.Asset)
+	for _, asset := range assets {
+		uuidToAssetMap[asset.UUID] = asset
+	}
+
+	numericProperties := []string{}
+	for _, eventTypeProperty := range eventTypeProperties {
+		if eventTypeProperty.Type != schemas.EventTypePropertyTypeSimple || eventTypeProperty.Datatype != schemas.EventTypePropertyDatatypeNumber {
+			continue
+		}
+		if len(selectedProperties) > 0 {
+			if _, ok := selectedProperties[eventTypeProperty.Name]; !ok {
+				if _, ok := selectedProperties[eventTypeProperty.UUID.String()]; !ok {
+					continue
+				}
+			}
+		}
+		if !slices.Contains(numericProperties, eventTypeProperty.Name) {
+			numericProperties = append(numericProperties, eventTypeProperty.Name)
+		}
+	}
+	slices.Sort(numericProperties)
+
+	groups := map[string]*eventSummaryGroup{}
+	for i := range events {
+		keys := make([]string, len(groupBy))
+		for j, key := range groupBy {
+			keys[j] = eventGroupKey(&events[i], key, uuidToAssetMap, eventTypes)
+		}
+
+		groupID := strings.Join(keys, "\x00")
+		group, ok := groups[groupID]
+		if !ok {
+			group = &eventSummaryGroup{
+				keys:           keys,
+				propertySums:   map[string]float64{},
+				propertyCounts: map[string]int{},
+			}
+			groups[groupID] = group
+		}
+
+		group.count++
+		if events[i].StopTime != nil {
+			group.durations = append(group.durations, events[i].StopTime.Sub(events[i].StartTime).Seconds())
+		}
+
+		if events[i].Properties == nil {
+			continue
+		}
+		for _, property := range numericProperties {
+			value, ok := toFloat64(events[i].Properties.Properties[property])
+			if !ok {
+				continue
+			}
+			group.propertySums[property] += value
+			group.propertyCounts[property]++
+		}
+	}
+
+	sortedGroups := make([]*eventSummaryGroup, 0, len(groups))
+	for _, group := range groups {
+		sortedGroups = append(sortedGroups, group)
+	}
+	slices.SortFunc(sortedGroups, func(a, b *eventSummaryGroup) int {
+		return slices.Compare(a.keys, b.keys)
+	})
+
+	fields := make([]*data.Field, 0, len(groupBy)+5+2*len(numericProperties))
+	for j, key := range groupBy {
+		values := make([]string, len(sortedGroups))
+		for i, group := range sortedGroups {
+			values[i] = group.keys[j]
+		}
+		fields = append(fields, data.NewField(key, nil, values))
+	}
+
+	counts := make([]int64, len(sortedGroups))
+	totals := make([]*float64, len(sortedGroups))
+	means := make([]*float64, len(sortedGroups))
+	minimums := make([]*float64, len(sortedGroups))
+	maximums := make([]*float64, len(sortedGroups))
+	for i, group := range sortedGroups {
+		counts[i] = group.count
+		if len(group.durations) == 0 {
+			continue
+		}
+
+		total := 0.0
+		for _, duration := range group.durations {
+			total += duration
+		}
+		totals[i] = new(total)
+		means[i] = new(total / float64(len(group.durations)))
+		minimums[i] = new(slices.Min(group.durations))
+		maximums[i] = new(slices.Max(group.durations))
+	}
+
+	durationConfig := &data.FieldConfig{Unit: "dtdhms"}
+	fields = append(fields,
+		data.NewField(CountColumnName, nil, counts),
+		data.NewField(TotalDurationColumnName, nil, totals).SetConfig(durationConfig),
+		data.NewField(MeanDurationColumnName, nil, means).SetConfig(durationConfig),
+		data.NewField(MinDurationColumnName, nil, minimums).SetConfig(durationConfig),
+		data.NewField(MaxDurationColumnName, nil, maximums).SetConfig(durationConfig),
+	)
+
+	for _, property := range numericProperties {
+		sums := make([]*float64, len(sortedGroups))
+		propertyMeans := make([]*float64, len(sortedGroups))
+		for i, group := range sortedGroups {
+			if group.propertyCounts[property] == 0 {
+				continue
+			}
+			sums[i] = new(group.propertySums[property])
+			propertyMeans[i] = new(group.propertySums[property] / float64(group.propertyCounts[property]))
+		}
+
+		fields = append(fields,
+			data.NewField(fmt.Sprintf("%s (sum)", property), nil, sums),
+			data.NewField(fmt.Sprintf("%s (mean)", property), nil, propertyMeans),
+		)
+	}
+
+	return data.Frames{data.NewFrame("Summary", fields...)}, nil
+}
+
+// eventGroupKey returns the value of the group by key for an event, keys prefixed with Parent_, Grandparent_ or
+// Ancestor<n>_ use the ancestor event
+func eventGroupKey(event *schemas.Event, key string, uuidToAssetMap map[uuid.UUID]schemas.Asset, eventTypes map[uuid.UUID]schemas.EventType) string {
+	if level, ancestorKey, ok := cutAncestorPrefix(key); ok {
+		ancestor := eventAncestors(event, level)[level-1]
+		if ancestor == nil {
+			return ""
+		}
+		return eventGroupKey(ancestor, ancestorKey, uuidToAssetMap, eventTypes)
+	}
+
+	switch key {
+	case AssetColumnName:
+		return uuidToAssetMap[event.AssetUUID].Name
+	case AssetPathColumnName:
+		return getAssetPath(uuidToAssetMap, event.AssetUUID)
+	case AssetUUIDColumnName:
+		return event.AssetUUID.String()
+	case EventTypeColumnName:
+		return eventTypes[event.EventTypeUUID].Name
+	case EventTypeUUIDColumnName:
+		return event.EventTypeUUID.String()
+	case ParentEventUUIDColumnName:
+		if event.ParentUUID == nil {
+			return ""
+		}
+		return event.ParentUUID.String()
+	case EventUUIDColumnName:
+		return event.UUID.String()
+	case StartTimeColumnName:
+		return event.StartTime.Format(time.RFC3339)
+	}
+
+	if event.Properties == nil {
+		return ""
+	}
+	value, ok := event.Properties.Properties[key]
+	if !ok || value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
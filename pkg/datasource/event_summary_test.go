@@ -0,0 +1,91 @@
+package datasource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/google/uuid"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventQueryResultToSummaryDataFrame(t *testing.T) {
+	t.Parallel()
+
+	line1 := schemas.Asset{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Line 1"}}
+	line2 := schemas.Asset{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Line 2"}}
+	downtime := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Downtime"}}
+	batch := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Batch"}}
+	properties := []schemas.EventTypeProperty{
+		{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Scrap"}, Datatype: schemas.EventTypePropertyDatatypeNumber, Type: schemas.EventTypePropertyTypeSimple, EventTypeUUID: downtime.UUID},
+		{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Reason"}, Datatype: schemas.EventTypePropertyDatatypeString, Type: schemas.EventTypePropertyTypeSimple, EventTypeUUID: downtime.UUID},
+	}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	parent := schemas.Event{UUID: uuid.New(), AssetUUID: line1.UUID, EventTypeUUID: batch.UUID, StartTime: start}
+	event := func(asset schemas.Asset, duration time.Duration, reason string, scrap interface{}) schemas.Event {
+		e := schemas.Event{
+			UUID:          uuid.New(),
+			AssetUUID:     asset.UUID,
+			EventTypeUUID: downtime.UUID,
+			StartTime:     start,
+			ParentUUID:    &parent.UUID,
+			Parent:        &parent,
+			Properties:    &schemas.EventProperties{Properties: schemas.Attributes{"Reason": reason, "Scrap": scrap}},
+		}
+		if duration > 0 {
+			e.StopTime = new(start.Add(duration))
+		}
+		return e
+	}
+	events := []schemas.Event{
+		event(line1, time.Minute, "Jam", 2.0),
+		event(line1, 3*time.Minute, "Jam", 4.0),
+		event(line1, 0, "Cleaning", nil),
+		event(line2, 2*time.Minute, "Jam", 1.0),
+	}
+	eventTypes := map[uuid.UUID]schemas.EventType{downtime.UUID: downtime, batch.UUID: batch}
+
+	t.Run("by asset and property", func(t *testing.T) {
+		t.Parallel()
+		frames, err := EventQueryResultToSummaryDataFrame([]schemas.Asset{line1, line2}, events, eventTypes, properties, map[string]struct{}{}, []string{AssetColumnName, "Reason"})
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+
+		frame := frames[0]
+		require.Equal(t, 3, frame.Rows())
+		assert.Equal(t, []string{AssetColumnName, "Reason", CountColumnName, TotalDurationColumnName, MeanDurationColumnName, MinDurationColumnName, MaxDurationColumnName, "Scrap (sum)", "Scrap (mean)"}, fieldNames(frame))
+
+		assert.Equal(t, []interface{}{"Line 1", "Cleaning", int64(1), (*float64)(nil), (*float64)(nil), (*float64)(nil), (*float64)(nil), (*float64)(nil), (*float64)(nil)}, frameRow(frame, 0))
+		assert.Equal(t, []interface{}{"Line 1", "Jam", int64(2), new(240.0), new(120.0), new(60.0), new(180.0), new(6.0), new(3.0)}, frameRow(frame, 1))
+		assert.Equal(t, []interface{}{"Line 2", "Jam", int64(1), new(120.0), new(120.0), new(120.0), new(120.0), new(1.0), new(1.0)}, frameRow(frame, 2))
+	})
+
+	t.Run("by parent event type", func(t *testing.T) {
+		t.Parallel()
+		frames, err := EventQueryResultToSummaryDataFrame(nil, events, eventTypes, properties, map[string]struct{}{"Reason": {}}, []string{parentEventPrefix + EventTypeColumnName})
+		require.NoError(t, err)
+		require.Equal(t, 1, frames[0].Rows())
+		assert.Equal(t, []string{parentEventPrefix + EventTypeColumnName, CountColumnName, TotalDurationColumnName, MeanDurationColumnName, MinDurationColumnName, MaxDurationColumnName}, fieldNames(frames[0]))
+		assert.Equal(t, "Batch", frames[0].Fields[0].At(0))
+		assert.Equal(t, int64(4), frames[0].Fields[1].At(0))
+	})
+
+	t.Run("defaults to event type", func(t *testing.T) {
+		t.Parallel()
+		frames, err := EventQueryResultToSummaryDataFrame(nil, events, eventTypes, nil, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, EventTypeColumnName, frames[0].Fields[0].Name)
+		assert.Equal(t, "Downtime", frames[0].Fields[0].At(0))
+	})
+}
+
+func frameRow(frame *data.Frame, row int) []interface{} {
+	values := make([]interface{}, len(frame.Fields))
+	for i, field := range frame.Fields {
+		values[i] = field.At(row)
+	}
+	return values
+}
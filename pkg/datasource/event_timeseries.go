@@ -0,0 +1,59 @@
+package datasource
+
+import (
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// TrendDataFrameToTimeSeries converts the offset based frames of EventQueryResultToTrendDataFrame to a time series frame
+// per event column, the time of each value is the start time of its event plus the offset. Only frames keyed by a time
+// offset can be converted, the frames should not be built by dimension.
+func TrendDataFrameToTimeSeries(frames data.Frames, events []schemas.Event) data.Frames {
+	startTimes := make(map[string]time.Time, len(events))
+	for i := range events {
+		startTimes[events[i].UUID.String()] = events[i].StartTime
+	}
+
+	result := data.Frames{}
+	for _, frame := range frames {
+		if len(frame.Fields) == 0 || frame.Fields[0].Type() != data.FieldTypeFloat64 {
+			continue
+		}
+
+		offsets := frame.Fields[0]
+		for _, field := range frame.Fields[1:] {
+			startTime, ok := startTimes[field.Labels[EventUUIDColumnName]]
+			if !ok {
+				continue
+			}
+
+			timeField := data.NewField("time", nil, []time.Time{})
+			valueField := data.NewFieldFromFieldType(field.Type(), 0)
+			valueField.Name = field.Name
+			valueField.Labels = field.Labels
+			valueField.Config = field.Config
+			if valueField.Config == nil {
+				valueField.Config = &data.FieldConfig{}
+			}
+			if valueField.Config.DisplayNameFromDS == "" {
+				valueField.Config.DisplayNameFromDS = field.Name
+			}
+
+			for i := 0; i < field.Len(); i++ {
+				if value, ok := field.ConcreteAt(i); !ok || value == nil {
+					continue
+				}
+
+				offset, _ := offsets.At(i).(float64)
+				timeField.Append(startTime.Add(time.Duration(offset * float64(time.Second))))
+				valueField.Append(field.At(i))
+			}
+
+			result = append(result, data.NewFrame(field.Name, timeField, valueField))
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,68 @@
+package datasource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/google/uuid"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrendDataFrameToTimeSeries(t *testing.T) {
+	t.Parallel()
+
+	asset := schemas.Asset{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Reactor"}}
+	batch := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Batch"}}
+	temperature := schemas.EventTypeProperty{
+		BaseModel:     schemas.BaseModel{UUID: uuid.New(), Name: "Temperature"},
+		Datatype:      schemas.EventTypePropertyDatatypeNumber,
+		Type:          schemas.EventTypePropertyTypePeriodic,
+		EventTypeUUID: batch.UUID,
+	}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(startTime time.Time, offsets []float64, values []interface{}) schemas.Event {
+		return schemas.Event{
+			UUID:          uuid.New(),
+			AssetUUID:     asset.UUID,
+			EventTypeUUID: batch.UUID,
+			StartTime:     startTime,
+			Properties: &schemas.EventProperties{Properties: schemas.Attributes{
+				"Temperature": map[string]interface{}{"t": offsets, "v": values},
+			}},
+		}
+	}
+	events := []schemas.Event{
+		event(start, []float64{0, 60}, []interface{}{20.0, 25.0}),
+		event(start.Add(time.Hour), []float64{30}, []interface{}{21.0}),
+	}
+
+	trendFrames, err := EventQueryResultToTrendDataFrame(0, []schemas.Asset{asset}, events, map[uuid.UUID]schemas.EventType{batch.UUID: batch}, map[uuid.UUID][]schemas.EventTypeProperty{batch.UUID: {temperature}}, map[string]struct{}{}, nil, false)
+	require.NoError(t, err)
+
+	frames := TrendDataFrameToTimeSeries(trendFrames, events)
+	require.Len(t, frames, 2)
+
+	byEvent := map[string]*data.Frame{}
+	for _, frame := range frames {
+		require.Len(t, frame.Fields, 2)
+		byEvent[frame.Fields[1].Labels[EventUUIDColumnName]] = frame
+	}
+
+	first := byEvent[events[0].UUID.String()]
+	require.NotNil(t, first)
+	require.Equal(t, 2, first.Rows())
+	assert.Equal(t, start, first.Fields[0].At(0))
+	assert.Equal(t, start.Add(time.Minute), first.Fields[0].At(1))
+	assert.Equal(t, new(25.0), first.Fields[1].At(1))
+	assert.Equal(t, "Temperature", first.Fields[1].Labels[PropertyColumnName])
+
+	second := byEvent[events[1].UUID.String()]
+	require.NotNil(t, second)
+	require.Equal(t, 1, second.Rows())
+	assert.Equal(t, start.Add(time.Hour+30*time.Second), second.Fields[0].At(0))
+	assert.Equal(t, new(21.0), second.Fields[1].At(0))
+}
@@ -28,11 +28,56 @@ const (
 	ParentEventUUIDColumnName = "ParentEventUUID"
 	EventTypeUUIDColumnName   = "EventTypeUUID"
 
-	parentEventPrefix = "Parent_"
+	parentEventPrefix      = "Parent_"
+	grandparentEventPrefix = "Grandparent_"
 )
 
-// EventQueryResultToDataFrame converts a event query result to data frames
-func EventQueryResultToDataFrame(includeParentInfo bool, multipleAssetsSelected bool, assets []schemas.Asset, events []schemas.Event, eventTypes []schemas.EventType, eventTypeProperties []schemas.EventTypeProperty, selectedProperties map[string]struct{}, assetPropertyFieldTypes map[string]data.FieldType, eventAssetPropertyFrames map[uuid.UUID]data.Frames) (data.Frames, error) {
+// ancestorPrefix returns the column prefix of the ancestor of an event at the given level, 1 being the parent
+func ancestorPrefix(level int) string {
+	switch level {
+	case 1:
+		return parentEventPrefix
+	case 2:
+		return grandparentEventPrefix
+	default:
+		return fmt.Sprintf("Ancestor%d_", level)
+	}
+}
+
+// cutAncestorPrefix removes the ancestor prefix from a column name and returns the level of the ancestor
+func cutAncestorPrefix(name string) (int, string, bool) {
+	if rest, ok := strings.CutPrefix(name, parentEventPrefix); ok {
+		return 1, rest, true
+	}
+	if rest, ok := strings.CutPrefix(name, grandparentEventPrefix); ok {
+		return 2, rest, true
+	}
+	if rest, ok := strings.CutPrefix(name, "Ancestor"); ok {
+		digits, rest, found := strings.Cut(rest, "_")
+		if level, err := strconv.Atoi(digits); found && err == nil && level > 0 {
+			return level, rest, true
+		}
+	}
+	return 0, name, false
+}
+
+// eventAncestors returns the ancestors of an event up to the given depth, starting with the parent. Missing ancestors
+// are nil, so the ancestor at level n is always at index n-1.
+func eventAncestors(event *schemas.Event, depth int) []*schemas.Event {
+	ancestors := make([]*schemas.Event, depth)
+	ancestor := event.Parent
+	for level := range depth {
+		if ancestor == nil {
+			break
+		}
+		ancestors[level] = ancestor
+		ancestor = ancestor.Parent
+	}
+	return ancestors
+}
+
+// EventQueryResultToDataFrame converts a event query result to data frames, with columns for the ancestors of the events up to ancestorDepth levels
+func EventQueryResultToDataFrame(ancestorDepth int, multipleAssetsSelected bool, assets []schemas.Asset, events []schemas.Event, eventTypes []schemas.EventType, eventTypeProperties []schemas.EventTypeProperty, selectedProperties map[string]struct{}, assetPropertyFieldTypes map[assetPropertyColumn]data.FieldType, eventAssetPropertyFrames map[uuid.UUID]data.Frames) (data.Frames, error) {
 	dataFrames := data.Frames{}
 	groupedEvents := map[uuid.UUID][]schemas.Event{}
 	eventTypePropertiesForEventType := map[uuid.UUID][]schemas.EventTypeProperty{}
@@ -54,7 +99,7 @@ func EventQueryResultToDataFrame(includeParentInfo bool, multipleAssetsSelected
 	}
 
 	for eventTypeUUID, groupedEvents := range groupedEvents {
-		dataFrames = append(dataFrames, dataFrameForEventType(includeParentInfo, multipleAssetsSelected, assets, eventTypesByUUID[eventTypeUUID], selectedProperties, eventTypesByUUID, groupedEvents, eventTypePropertiesForEventType, assetPropertyFieldTypes, eventAssetPropertyFrames))
+		dataFrames = append(dataFrames, dataFrameForEventType(ancestorDepth, multipleAssetsSelected, assets, eventTypesByUUID[eventTypeUUID], selectedProperties, eventTypesByUUID, groupedEvents, eventTypePropertiesForEventType, assetPropertyFieldTypes, eventAssetPropertyFrames))
 	}
 
 	return dataFrames, nil
@@ -67,8 +112,8 @@ type eventFrameColumn struct {
 	EventUUID uuid.UUID
 }
 
-// EventQueryResultToTrendDataFrame converts a event query result to data frames
-func EventQueryResultToTrendDataFrame(includeParentInfo bool, assets []schemas.Asset, events []schemas.Event, eventTypes map[uuid.UUID]schemas.EventType, eventTypePropertiesForEventType map[uuid.UUID][]schemas.EventTypeProperty, selectedProperties map[string]struct{}, eventAssetPropertyFrames map[uuid.UUID]data.Frames, byDimension bool) (data.Frames, error) {
+// EventQueryResultToTrendDataFrame converts a event query result to data frames, with labels for the ancestors of the events up to ancestorDepth levels
+func EventQueryResultToTrendDataFrame(ancestorDepth int, assets []schemas.Asset, events []schemas.Event, eventTypes map[uuid.UUID]schemas.EventType, eventTypePropertiesForEventType map[uuid.UUID][]schemas.EventTypeProperty, selectedProperties map[string]struct{}, eventAssetPropertyFrames map[uuid.UUID]data.Frames, byDimension bool) (data.Frames, error) {
 	uuidToAssetMap := make(map[uuid.UUID]schemas.Asset)
 	for _, asset := range assets {
 		uuidToAssetMap[asset.UUID] = asset
@@ -151,42 +196,10 @@ func EventQueryResultToTrendDataFrame(includeParentInfo bool, assets []schemas.A
 
 			name := fmt.Sprintf("%s (%s)", periodicEventTypeProperties[j].Name, events[i].UUID)
 
-			// Add parent event details as labels if `includeParentInfo` is true
-			if includeParentInfo && events[i].Parent != nil {
-				parentEvent := *events[i].Parent
-				parentType := eventTypes[parentEvent.EventTypeUUID]
-				parentPrefix := parentEventPrefix
-
-				// Add parent event details
-				labels[parentPrefix+EventUUIDColumnName] = parentEvent.UUID.String()
-				labels[parentPrefix+StartTimeColumnName] = parentEvent.StartTime.Format(time.RFC3339)
-				labels[parentPrefix+StopTimeColumnName] = ""
-				if parentEvent.StopTime != nil {
-					eventLabels[parentPrefix+StopTimeColumnName] = parentEvent.StopTime.Format(time.RFC3339)
-				}
-				labels[parentPrefix+AssetUUIDColumnName] = parentEvent.AssetUUID.String()
-				labels[parentPrefix+AssetColumnName] = uuidToAssetMap[parentEvent.AssetUUID].Name
-				labels[parentPrefix+AssetPathColumnName] = getAssetPath(uuidToAssetMap, parentEvent.AssetUUID)
-				labels[parentPrefix+EventTypeUUIDColumnName] = parentEvent.EventTypeUUID.String()
-				labels[parentPrefix+EventTypeColumnName] = parentType.Name
-
-				// Add parent event properties
-				for _, parentProperty := range eventTypePropertiesForEventType[parentEvent.EventTypeUUID] {
-					if parentProperty.Type == schemas.EventTypePropertyTypePeriodic {
-						continue
-					}
-
-					name := parentPrefix + parentProperty.Name
-					if parentEvent.Properties == nil || parentEvent.Properties.Properties == nil {
-						labels[name] = ""
-						continue
-					}
-
-					if value, ok := parentEvent.Properties.Properties[parentProperty.Name]; ok {
-						labels[name] = fmt.Sprintf("%v", value)
-					} else {
-						labels[name] = ""
-					}
+			// Add the details of the ancestor events as labels
+			for level, ancestor := range eventAncestors(&events[i], ancestorDepth) {
+				if ancestor != nil {
+					addAncestorLabels(labels, ancestorPrefix(level+1), ancestor, uuidToAssetMap, eventTypes, eventTypePropertiesForEventType)
 				}
 			}
 
@@ -345,6 +358,39 @@ func EventQueryResultToTrendDataFrame(includeParentInfo bool, assets []schemas.A
 	return resultFrames, nil
 }
 
+// addAncestorLabels adds the details and simple properties of an ancestor event as labels with the given prefix
+func addAncestorLabels(labels data.Labels, prefix string, ancestor *schemas.Event, uuidToAssetMap map[uuid.UUID]schemas.Asset, eventTypes map[uuid.UUID]schemas.EventType, eventTypePropertiesForEventType map[uuid.UUID][]schemas.EventTypeProperty) {
+	labels[prefix+EventUUIDColumnName] = ancestor.UUID.String()
+	labels[prefix+StartTimeColumnName] = ancestor.StartTime.Format(time.RFC3339)
+	labels[prefix+StopTimeColumnName] = ""
+	if ancestor.StopTime != nil {
+		labels[prefix+StopTimeColumnName] = ancestor.StopTime.Format(time.RFC3339)
+	}
+	labels[prefix+AssetUUIDColumnName] = ancestor.AssetUUID.String()
+	labels[prefix+AssetColumnName] = uuidToAssetMap[ancestor.AssetUUID].Name
+	labels[prefix+AssetPathColumnName] = getAssetPath(uuidToAssetMap, ancestor.AssetUUID)
+	labels[prefix+EventTypeUUIDColumnName] = ancestor.EventTypeUUID.String()
+	labels[prefix+EventTypeColumnName] = eventTypes[ancestor.EventTypeUUID].Name
+
+	for _, property := range eventTypePropertiesForEventType[ancestor.EventTypeUUID] {
+		if property.Type == schemas.EventTypePropertyTypePeriodic {
+			continue
+		}
+
+		name := prefix + property.Name
+		if ancestor.Properties == nil || ancestor.Properties.Properties == nil {
+			labels[name] = ""
+			continue
+		}
+
+		if value, ok := ancestor.Properties.Properties[property.Name]; ok {
+			labels[name] = fmt.Sprintf("%v", value)
+		} else {
+			labels[name] = ""
+		}
+	}
+}
+
 func buildSimpleFieldsForEvent(prefix string, eventTypeProperties []schemas.EventTypeProperty, selectedProperties map[string]struct{}) []*data.Field {
 	fields := []*data.Field{
 		data.NewField(prefix+EventUUIDColumnName, nil, []*string{}),
@@ -432,7 +478,7 @@ func fillFields(prefix string, fieldByColumn map[string]*data.Field, event *sche
 	}
 }
 
-func dataFrameForEventType(includeParentInfo bool, multipleAssetsSelected bool, assets []schemas.Asset, eventType schemas.EventType, selectedProperties map[string]struct{}, eventTypes map[uuid.UUID]schemas.EventType, events []schemas.Event, eventTypePropertiesForEventType map[uuid.UUID][]schemas.EventTypeProperty, assetPropertyFieldTypes map[string]data.FieldType, eventAssetPropertyFrames map[uuid.UUID]data.Frames) *data.Frame {
+func dataFrameForEventType(ancestorDepth int, multipleAssetsSelected bool, assets []schemas.Asset, eventType schemas.EventType, selectedProperties map[string]struct{}, eventTypes map[uuid.UUID]schemas.EventType, events []schemas.Event, eventTypePropertiesForEventType map[uuid.UUID][]schemas.EventTypeProperty, assetPropertyFieldTypes map[assetPropertyColumn]data.FieldType, eventAssetPropertyFrames map[uuid.UUID]data.Frames) *data.Frame {
 	uuidToAssetMap := make(map[uuid.UUID]schemas.Asset)
 	for _, asset := range assets {
 		uuidToAssetMap[asset.UUID] = asset
@@ -446,16 +492,21 @@ func dataFrameForEventType(includeParentInfo bool, multipleAssetsSelected bool,
 		fieldByColumn[field.Name] = field
 	}
 
-	for assetProperty := range assetPropertyFieldTypes {
-		switch assetPropertyFieldTypes[assetProperty] {
-		case data.FieldTypeNullableFloat64:
-			fieldByColumn[assetProperty] = data.NewField(assetProperty, nil, []*float64{})
-		case data.FieldTypeNullableBool:
-			fieldByColumn[assetProperty] = data.NewField(assetProperty, nil, []*bool{})
-		case data.FieldTypeNullableString:
-			fieldByColumn[assetProperty] = data.NewField(assetProperty, nil, []*string{})
+	assetPropertyFields := map[assetPropertyColumn]*data.Field{}
+	for assetProperty, fieldType := range assetPropertyFieldTypes {
+		switch fieldType {
+		case data.FieldTypeNullableFloat64, data.FieldTypeNullableBool, data.FieldTypeNullableString:
+		default:
+			continue
+		}
+
+		field := assetProperty.field(fieldType)
+		assetPropertyFields[assetProperty] = field
+		// A column without aggregation replaces the event property with the same name
+		if assetProperty.Aggregation == "" {
+			fieldByColumn[assetProperty.Name] = field
 		}
-		fields = append(fields, fieldByColumn[assetProperty])
+		fields = append(fields, field)
 	}
 
 	for _, eventTypeProperty := range eventTypeProperties {
@@ -491,47 +542,44 @@ func dataFrameForEventType(includeParentInfo bool, multipleAssetsSelected bool,
 		fieldByColumn[eventTypeProperty.Name] = field
 	}
 
-	parentFields := []*data.Field{}
-	parentFieldsAdded := make(map[string]bool) // Track added fields for parent event types
+	// The fields of an ancestor level are the union of the fields of the event types of the ancestors at that level
+	ancestorFields := make([][]*data.Field, ancestorDepth)
+	ancestorEventTypesAdded := make([]map[uuid.UUID]bool, ancestorDepth)
+	for level := range ancestorEventTypesAdded {
+		ancestorEventTypesAdded[level] = map[uuid.UUID]bool{}
+	}
 
 	for i := range events {
-		if events[i].ParentUUID != nil {
-			if includeParentInfo {
-				parentEvent := *events[i].Parent
-				_, parentEventTypeExists := eventTypes[parentEvent.EventTypeUUID]
-				if !parentEventTypeExists {
+		for level, ancestor := range eventAncestors(&events[i], ancestorDepth) {
+			if ancestor == nil || ancestorEventTypesAdded[level][ancestor.EventTypeUUID] {
+				continue
+			}
+			if _, ok := eventTypes[ancestor.EventTypeUUID]; !ok {
+				continue
+			}
+
+			ancestorEventTypesAdded[level][ancestor.EventTypeUUID] = true
+			for _, ancestorField := range buildSimpleFieldsForEvent(ancestorPrefix(level+1), eventTypePropertiesForEventType[ancestor.EventTypeUUID], selectedProperties) {
+				if _, ok := fieldByColumn[ancestorField.Name]; ok {
 					continue
 				}
 
-				parentPrefix := parentEventPrefix
-				if !parentFieldsAdded[parentPrefix] {
-					parentFieldsAdded[parentPrefix] = true
-
-					parentFieldsForEventType := buildSimpleFieldsForEvent(parentPrefix, eventTypePropertiesForEventType[parentEvent.EventTypeUUID], selectedProperties)
-					for _, parentField := range parentFieldsForEventType {
-						fieldByColumn[parentField.Name] = parentField
-						parentFields = append(parentFields, parentField)
-					}
-				}
+				fieldByColumn[ancestorField.Name] = ancestorField
+				ancestorFields[level] = append(ancestorFields[level], ancestorField)
 			}
 		}
 
 		fillFields("", fieldByColumn, &events[i], uuidToAssetMap, eventType, eventTypeProperties)
 		assetPropertyFrames := eventAssetPropertyFrames[events[i].UUID]
-		for assetProperty := range assetPropertyFieldTypes {
+		for assetProperty, field := range assetPropertyFields {
 			found := false
-			field := fieldByColumn[assetProperty]
 			for _, assetPropertyFrame := range assetPropertyFrames {
-				// custom := assetPropertyFrame.Meta.Custom.(map[string]interface{})
-				// assetPath := custom["AssetPath"].(string)
-				// name := custom["AssetProperty"].(string)
-				// fullName := fmt.Sprintf("%s.%s", assetPath, name)
-				name, ok := getAssetPropertyFieldName(assetPropertyFrame, multipleAssetsSelected)
+				column, ok := getAssetPropertyColumn(assetPropertyFrame, multipleAssetsSelected)
 				if !ok {
 					continue
 				}
 
-				if assetProperty != name {
+				if assetProperty != column {
 					continue
 				}
 
@@ -567,50 +615,28 @@ func dataFrameForEventType(includeParentInfo bool, multipleAssetsSelected bool,
 		}
 	}
 
-	if includeParentInfo {
-		// Populate parent data or append nil for rows without a parent
-		for i := range events {
-			if events[i].Parent != nil {
-				if _, ok := eventTypes[events[i].Parent.EventTypeUUID]; ok {
-					parentEvent := *events[i].Parent
-					parentEventType := eventTypes[parentEvent.EventTypeUUID]
-					parentPrefix := parentEventPrefix
-
-					fillFields(parentPrefix, fieldByColumn, &parentEvent, uuidToAssetMap, parentEventType, eventTypePropertiesForEventType[parentEvent.EventTypeUUID])
-
-					// Append nil for other parent-related fields if there are multiple parent event types
-					for otherParentPrefix := range parentFieldsAdded {
-						if otherParentPrefix == parentPrefix {
-							continue
-						}
-
-						for _, field := range fieldByColumn {
-							// skip if field is not a parent-related field
-							if !strings.HasPrefix(field.Name, otherParentPrefix) {
-								continue
-							}
-
-							addValueToField(field, nil)
-						}
-					}
+	// Populate the ancestor data or append nil for rows without an ancestor at that level
+	for i := range events {
+		for level, ancestor := range eventAncestors(&events[i], ancestorDepth) {
+			if ancestor != nil {
+				if ancestorEventType, ok := eventTypes[ancestor.EventTypeUUID]; ok {
+					fillFields(ancestorPrefix(level+1), fieldByColumn, ancestor, uuidToAssetMap, ancestorEventType, eventTypePropertiesForEventType[ancestor.EventTypeUUID])
 				}
-				continue
 			}
 
-			// Append nil for all parent-related fields if no parent exists
-			for parentPrefix := range parentFieldsAdded {
-				for _, parentField := range fieldByColumn {
-					if !strings.HasPrefix(parentField.Name, parentPrefix) {
-						continue
-					}
-
-					addValueToField(parentField, nil)
+			for _, ancestorField := range ancestorFields[level] {
+				if ancestorField.Len() <= i {
+					addValueToField(ancestorField, nil)
 				}
 			}
 		}
+	}
 
-		fields = append(parentFields, fields...)
+	ancestorFieldsFirst := []*data.Field{}
+	for _, levelFields := range ancestorFields {
+		ancestorFieldsFirst = append(ancestorFieldsFirst, levelFields...)
 	}
+	fields = append(ancestorFieldsFirst, fields...)
 
 	return data.NewFrame(eventType.Name, fields...)
 }
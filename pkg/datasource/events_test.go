@@ -7,16 +7,22 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/factrylabs/factry-historian-datasource.git/pkg/api"
+	arrow_pb "github.com/factrylabs/factry-historian-datasource.git/pkg/proto"
 	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/go-playground/form"
 	"github.com/google/uuid"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
 )
 
 // TestEventQueryResultToDataFrame_ParentAssetEnrichment is a builder-level contract test:
@@ -58,14 +64,14 @@ func TestEventQueryResultToDataFrame_ParentAssetEnrichment(t *testing.T) {
 	}
 
 	frames, err := EventQueryResultToDataFrame(
-		true,
+		1,
 		false,
 		[]schemas.Asset{childAsset, parentAsset},
 		[]schemas.Event{childEvent},
 		[]schemas.EventType{childEventType, parentEventType},
 		nil,
 		map[string]struct{}{},
-		map[string]data.FieldType{},
+		map[assetPropertyColumn]data.FieldType{},
 		map[uuid.UUID]data.Frames{},
 	)
 	require.NoError(t, err)
@@ -80,6 +86,127 @@ func TestEventQueryResultToDataFrame_ParentAssetEnrichment(t *testing.T) {
 	assert.Equal(t, parentAsset.UUID.String(), gotUUID)
 }
 
+// TestEventQueryResultToDataFrame_AssetPropertyAggregations checks that every aggregation
+// of an asset property becomes a separate column in the event table, also when another
+// property is named like an aggregated column.
+func TestEventQueryResultToDataFrame_AssetPropertyAggregations(t *testing.T) {
+	t.Parallel()
+
+	asset := schemas.Asset{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "reactor"}}
+	eventType := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Batch"}}
+	event := schemas.Event{UUID: uuid.New(), AssetUUID: asset.UUID, EventTypeUUID: eventType.UUID, StartTime: time.Date(2026, 4, 30, 12, 0, 0, 0, time.UTC)}
+
+	assetPropertyFrame := func(name string, aggregation *schemas.Aggregation, value float64) data.Frames {
+		frame := data.NewFrame("", data.NewField("time", nil, []time.Time{event.StartTime}), data.NewField("value", nil, []*float64{&value}))
+		frame.Meta = &data.FrameMeta{Custom: map[string]interface{}{"AssetProperty": name}}
+		frames := data.Frames{frame}
+		setAssetPropertyAggregation(frames, aggregation)
+		return frames
+	}
+	eventAssetPropertyFrames := map[uuid.UUID]data.Frames{
+		event.UUID: slices.Concat(
+			assetPropertyFrame("Temperature", &schemas.Aggregation{Name: schemas.Min}, 20),
+			assetPropertyFrame("Temperature", &schemas.Aggregation{Name: schemas.Max}, 80),
+			assetPropertyFrame("Temperature (min)", nil, 5),
+		),
+	}
+
+	assetPropertyFieldTypes := getAssetPropertyFieldTypes(eventAssetPropertyFrames, false)
+	assert.Equal(t, map[assetPropertyColumn]data.FieldType{
+		{Name: "Temperature", Aggregation: "min"}: data.FieldTypeNullableFloat64,
+		{Name: "Temperature", Aggregation: "max"}: data.FieldTypeNullableFloat64,
+		{Name: "Temperature (min)"}:               data.FieldTypeNullableFloat64,
+	}, assetPropertyFieldTypes)
+
+	frames, err := EventQueryResultToDataFrame(0, false, []schemas.Asset{asset}, []schemas.Event{event}, []schemas.EventType{eventType}, nil, map[string]struct{}{}, assetPropertyFieldTypes, eventAssetPropertyFrames)
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+
+	values := map[string]float64{}
+	for _, field := range frames[0].Fields {
+		if field.Name != "Temperature" && field.Name != "Temperature (min)" {
+			continue
+		}
+		values[field.Name+" "+field.Labels["aggregation"]] = *field.At(0).(*float64)
+		if aggregation := field.Labels["aggregation"]; aggregation != "" {
+			assert.Equal(t, "Temperature ("+aggregation+")", field.Config.DisplayNameFromDS)
+		}
+	}
+	assert.Equal(t, map[string]float64{"Temperature min": 20, "Temperature max": 80, "Temperature (min) ": 5}, values)
+}
+
+// TestHandleEventQuery_AssetPropertyAggregationQueries checks that every aggregation of the asset
+// properties is requested in its own query over the event and ends up in its own column.
+func TestHandleEventQuery_AssetPropertyAggregationQueries(t *testing.T) {
+	t.Parallel()
+
+	asset := schemas.Asset{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "reactor"}, AssetPath: `\\site\\reactor`}
+	eventType := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Batch"}}
+	measurementUUID := uuid.New()
+	assetProperty := schemas.AssetProperty{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Temperature"}, AssetUUID: asset.UUID, MeasurementUUID: measurementUUID}
+	startTime := time.Date(2026, 4, 30, 12, 0, 0, 0, time.UTC)
+	stopTime := startTime.Add(time.Hour)
+	event := schemas.Event{UUID: uuid.New(), AssetUUID: asset.UUID, EventTypeUUID: eventType.UUID, StartTime: startTime, StopTime: &stopTime}
+	values := map[schemas.AggregationType]float64{schemas.Min: 20, schemas.Max: 80}
+
+	var mu sync.Mutex
+	var queries []schemas.Query
+	server := newFakeHistorianServer(t, fakeHistorianData{
+		assetsByPath:    map[string]schemas.Asset{asset.AssetPath: asset},
+		assetsByUUID:    map[string]schemas.Asset{asset.UUID.String(): asset},
+		eventTypesByKey: map[string]schemas.EventType{eventType.Name: eventType},
+		allEventTypes:   []schemas.EventType{eventType},
+		events:          []schemas.Event{event},
+		assetProperties: []schemas.AssetProperty{assetProperty},
+		timeseries: func(w http.ResponseWriter, r *http.Request) {
+			query := schemas.Query{}
+			if err := json.NewDecoder(r.Body).Decode(&query); err != nil || query.Aggregation == nil {
+				t.Errorf("decoding aggregated query: %v", err)
+				http.Error(w, "invalid query", http.StatusBadRequest)
+				return
+			}
+			mu.Lock()
+			queries = append(queries, query)
+			mu.Unlock()
+
+			writeFrames(t, w, data.Frames{seriesFrame(measurementUUID.String(), query.Start, values[query.Aggregation.Name])})
+		},
+	})
+	t.Cleanup(server.Close)
+
+	apiClient, err := api.NewAPIWithToken(server.URL, "test-token", "test-org")
+	require.NoError(t, err)
+	ds := &HistorianDataSource{API: apiClient}
+
+	eventQuery := schemas.EventQuery{
+		Type:                      string(schemas.EventTypePropertyTypeSimple),
+		Assets:                    []string{asset.AssetPath},
+		EventTypes:                []string{eventType.Name},
+		QueryAssetProperties:      true,
+		Options:                   &schemas.MeasurementQueryOptions{Aggregation: &schemas.Aggregation{Name: schemas.Mean}},
+		AssetPropertyAggregations: []schemas.Aggregation{{Name: schemas.Min}, {Name: schemas.Max}},
+	}
+	timeRange := backend.TimeRange{From: startTime.Add(-time.Hour), To: startTime.Add(2 * time.Hour)}
+
+	frames, err := ds.handleEventQuery(context.Background(), eventQuery, timeRange, time.Minute, 1000, &schemas.HistorianInfo{Version: "v7.0.0"})
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+
+	columns := map[string]float64{}
+	for _, field := range frames[0].Fields {
+		if field.Name == "Temperature" {
+			columns[field.Labels["aggregation"]] = *field.At(0).(*float64)
+		}
+	}
+	assert.Equal(t, map[string]float64{"min": 20, "max": 80}, columns)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, queries, 2, "a query per aggregation")
+	aggregations := []schemas.Aggregation{*queries[0].Aggregation, *queries[1].Aggregation}
+	assert.ElementsMatch(t, []schemas.Aggregation{{Name: schemas.Min, Period: "1h0m0s"}, {Name: schemas.Max, Period: "1h0m0s"}}, aggregations)
+}
+
 // TestHandleEventQuery_PopulatesParentAssetOutsideSelection is the regression test for
 // ticket 34763: when the user selects a leaf asset but enables "Include parent event",
 // the parent event's asset is not in the selected asset filter. The handler must still
@@ -158,6 +285,308 @@ func TestHandleEventQuery_PopulatesParentAssetOutsideSelection(t *testing.T) {
 	assert.Equal(t, parentAsset.UUID.String(), gotUUID)
 }
 
+// TestEventQueryResultToDataFrame_AncestorDepth checks that every ancestor level gets its own
+// set of columns and that events without an ancestor at a level get empty values.
+func TestEventQueryResultToDataFrame_AncestorDepth(t *testing.T) {
+	t.Parallel()
+
+	asset := schemas.Asset{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "reactor"}, AssetPath: `\\site\\reactor`}
+	campaignType := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Campaign"}}
+	batchType := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Batch"}}
+	phaseType := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Phase"}}
+
+	startTime := time.Date(2026, 4, 30, 12, 0, 0, 0, time.UTC)
+	campaign := schemas.Event{UUID: uuid.New(), AssetUUID: asset.UUID, EventTypeUUID: campaignType.UUID, StartTime: startTime}
+	batch := schemas.Event{UUID: uuid.New(), AssetUUID: asset.UUID, EventTypeUUID: batchType.UUID, StartTime: startTime, ParentUUID: &campaign.UUID, Parent: &campaign}
+	orphanBatch := schemas.Event{UUID: uuid.New(), AssetUUID: asset.UUID, EventTypeUUID: batchType.UUID, StartTime: startTime}
+	events := []schemas.Event{
+		{UUID: uuid.New(), AssetUUID: asset.UUID, EventTypeUUID: phaseType.UUID, StartTime: startTime, ParentUUID: &batch.UUID, Parent: &batch},
+		{UUID: uuid.New(), AssetUUID: asset.UUID, EventTypeUUID: phaseType.UUID, StartTime: startTime, ParentUUID: &orphanBatch.UUID, Parent: &orphanBatch},
+		{UUID: uuid.New(), AssetUUID: asset.UUID, EventTypeUUID: phaseType.UUID, StartTime: startTime},
+	}
+
+	frames, err := EventQueryResultToDataFrame(3, false, []schemas.Asset{asset}, events, []schemas.EventType{campaignType, batchType, phaseType}, nil, map[string]struct{}{}, map[assetPropertyColumn]data.FieldType{}, map[uuid.UUID]data.Frames{})
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+
+	rows, err := frames[0].RowLen()
+	require.NoError(t, err, "all fields must have the same length")
+	require.Equal(t, len(events), rows)
+
+	values := func(name string) []*string {
+		field, _ := frames[0].FieldByName(name)
+		require.NotNil(t, field, name)
+		out := make([]*string, field.Len())
+		for i := range out {
+			out[i] = field.At(i).(*string)
+		}
+		return out
+	}
+	assert.Equal(t, []*string{new("Batch"), new("Batch"), nil}, values(parentEventPrefix+EventTypeColumnName))
+	assert.Equal(t, []*string{new("Campaign"), nil, nil}, values(grandparentEventPrefix+EventTypeColumnName))
+	assert.Equal(t, []*string{new("Phase"), new("Phase"), new("Phase")}, values(EventTypeColumnName))
+	_, index := frames[0].FieldByName("Ancestor3_" + EventTypeColumnName)
+	assert.Equal(t, -1, index, "levels without any ancestor have no columns")
+}
+
+// TestHandleEventQuery_FetchesMissingAncestors checks that the ancestors above the preloaded
+// parent are queried by their event type within the time range of their children, up to the
+// requested parent depth, leaving out other events of the parent event types.
+func TestHandleEventQuery_FetchesMissingAncestors(t *testing.T) {
+	t.Parallel()
+
+	asset := schemas.Asset{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "reactor"}, AssetPath: `\\site\\reactor`}
+	campaignType := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Campaign"}}
+	batchType := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Batch"}, ParentUUID: &campaignType.UUID}
+	phaseType := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Phase"}, ParentUUID: &batchType.UUID}
+	stepType := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Step"}, ParentUUID: &phaseType.UUID}
+
+	startTime := time.Date(2026, 4, 30, 12, 0, 0, 0, time.UTC)
+	campaign := schemas.Event{UUID: uuid.New(), AssetUUID: asset.UUID, EventTypeUUID: campaignType.UUID, StartTime: startTime}
+	batch := schemas.Event{UUID: uuid.New(), AssetUUID: asset.UUID, EventTypeUUID: batchType.UUID, StartTime: startTime, ParentUUID: &campaign.UUID}
+	phaseStopTime := startTime.Add(time.Hour)
+	phase := schemas.Event{UUID: uuid.New(), AssetUUID: asset.UUID, EventTypeUUID: phaseType.UUID, StartTime: startTime, StopTime: &phaseStopTime, ParentUUID: &batch.UUID}
+	step := schemas.Event{UUID: uuid.New(), AssetUUID: asset.UUID, EventTypeUUID: stepType.UUID, StartTime: startTime, ParentUUID: &phase.UUID, Parent: &phase}
+	otherCampaign := schemas.Event{UUID: uuid.New(), AssetUUID: asset.UUID, EventTypeUUID: campaignType.UUID, StartTime: startTime}
+
+	var mu sync.Mutex
+	var filters []schemas.EventFilter
+	server := newFakeHistorianServer(t, fakeHistorianData{
+		assetsByPath:    map[string]schemas.Asset{asset.AssetPath: asset},
+		assetsByUUID:    map[string]schemas.Asset{asset.UUID.String(): asset},
+		eventTypesByKey: map[string]schemas.EventType{stepType.Name: stepType},
+		allEventTypes:   []schemas.EventType{campaignType, batchType, phaseType, stepType},
+		events:          []schemas.Event{step},
+		ancestorEvents:  []schemas.Event{otherCampaign, campaign, batch},
+		onEventQuery: func(filter schemas.EventFilter) {
+			mu.Lock()
+			defer mu.Unlock()
+			filters = append(filters, filter)
+		},
+	})
+	t.Cleanup(server.Close)
+
+	apiClient, err := api.NewAPIWithToken(server.URL, "test-token", "test-org")
+	require.NoError(t, err)
+	ds := &HistorianDataSource{API: apiClient}
+
+	eventQuery := schemas.EventQuery{
+		Type:              string(schemas.EventTypePropertyTypeSimple),
+		Assets:            []string{asset.AssetPath},
+		EventTypes:        []string{stepType.Name},
+		IncludeParentInfo: true,
+		ParentDepth:       3,
+	}
+	timeRange := backend.TimeRange{From: startTime.Add(-time.Hour), To: startTime.Add(24 * time.Hour)}
+
+	frames, err := ds.handleEventQuery(context.Background(), eventQuery, timeRange, time.Minute, 1000, &schemas.HistorianInfo{Version: "v7.0.0"})
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+
+	assert.Equal(t, "Phase", concreteString(t, frames[0], parentEventPrefix+EventTypeColumnName))
+	assert.Equal(t, "Batch", concreteString(t, frames[0], grandparentEventPrefix+EventTypeColumnName))
+	assert.Equal(t, "Campaign", concreteString(t, frames[0], "Ancestor3_"+EventTypeColumnName))
+	assert.Equal(t, campaign.UUID.String(), concreteString(t, frames[0], "Ancestor3_"+EventUUIDColumnName))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, filters, 3, "one query for the events and one for every missing ancestor level")
+	for i, parentType := range []schemas.EventType{batchType, campaignType} {
+		filter := filters[i+1]
+		assert.Equal(t, []uuid.UUID{parentType.UUID}, filter.EventTypeUUIDs)
+		require.NotNil(t, filter.StartTime)
+		require.NotNil(t, filter.StopTime)
+		assert.True(t, filter.StartTime.Equal(startTime))
+		assert.Positive(t, filter.Limit)
+	}
+	assert.True(t, filters[1].StopTime.Equal(phaseStopTime), "the batch is queried within the time range of the phase")
+}
+
+// TestHandleEventQuery_ChildEvents checks that the child events of the events are returned as
+// a separate frame linked by ParentEventUUID, leaving out children of other events, and that
+// the children are queried within the time range of their parents.
+func TestHandleEventQuery_ChildEvents(t *testing.T) {
+	t.Parallel()
+
+	asset := schemas.Asset{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "reactor"}, AssetPath: `\\site\\reactor`}
+	batchType := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Batch"}}
+	phaseType := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Phase"}}
+
+	startTime := time.Date(2026, 4, 30, 12, 0, 0, 0, time.UTC)
+	batchStopTime := startTime.Add(time.Hour)
+	batch := schemas.Event{UUID: uuid.New(), AssetUUID: asset.UUID, EventTypeUUID: batchType.UUID, StartTime: startTime, StopTime: &batchStopTime}
+	otherBatchUUID := uuid.New()
+	phase := schemas.Event{UUID: uuid.New(), AssetUUID: asset.UUID, EventTypeUUID: phaseType.UUID, StartTime: startTime, ParentUUID: &batch.UUID}
+	otherPhase := schemas.Event{UUID: uuid.New(), AssetUUID: asset.UUID, EventTypeUUID: phaseType.UUID, StartTime: startTime, ParentUUID: &otherBatchUUID}
+
+	var mu sync.Mutex
+	var filters []schemas.EventFilter
+
+	server := newFakeHistorianServer(t, fakeHistorianData{
+		assetsByPath:    map[string]schemas.Asset{asset.AssetPath: asset},
+		assetsByUUID:    map[string]schemas.Asset{asset.UUID.String(): asset},
+		eventTypesByKey: map[string]schemas.EventType{batchType.Name: batchType, phaseType.Name: phaseType},
+		allEventTypes:   []schemas.EventType{batchType, phaseType},
+		events:          []schemas.Event{batch},
+		childEvents:     []schemas.Event{phase, otherPhase},
+		onEventQuery: func(filter schemas.EventFilter) {
+			mu.Lock()
+			defer mu.Unlock()
+			filters = append(filters, filter)
+		},
+	})
+	t.Cleanup(server.Close)
+
+	apiClient, err := api.NewAPIWithToken(server.URL, "test-token", "test-org")
+	require.NoError(t, err)
+	ds := &HistorianDataSource{API: apiClient}
+
+	eventQuery := schemas.EventQuery{
+		Type:        string(schemas.EventTypePropertyTypeSimple),
+		Assets:      []string{asset.AssetPath},
+		EventTypes:  []string{batchType.Name},
+		ChildEvents: &schemas.EventChildren{EventTypes: []string{phaseType.Name}},
+	}
+	timeRange := backend.TimeRange{From: startTime.Add(-time.Hour), To: startTime.Add(24 * time.Hour)}
+
+	frames, err := ds.handleEventQuery(context.Background(), eventQuery, timeRange, time.Minute, 1000, &schemas.HistorianInfo{Version: "v7.0.0"})
+	require.NoError(t, err)
+	require.Len(t, frames, 2)
+	assert.Equal(t, batchType.Name, frames[0].Name)
+	assert.Equal(t, phaseType.Name, frames[1].Name)
+	require.Equal(t, 1, frames[1].Rows())
+
+	parentUUIDs, _ := frames[1].FieldByName(ParentEventUUIDColumnName)
+	require.NotNil(t, parentUUIDs)
+	assert.Equal(t, batch.UUID.String(), parentUUIDs.At(0))
+	assert.Equal(t, phase.UUID.String(), concreteString(t, frames[1], EventUUIDColumnName))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, filters, 2)
+	childFilter := filters[1]
+	assert.Equal(t, []uuid.UUID{phaseType.UUID}, childFilter.EventTypeUUIDs)
+	require.NotNil(t, childFilter.StartTime)
+	require.NotNil(t, childFilter.StopTime)
+	assert.True(t, childFilter.StartTime.Equal(startTime), "the children are queried within the time range of their parents")
+	assert.True(t, childFilter.StopTime.Equal(batchStopTime))
+	assert.Positive(t, childFilter.Limit)
+}
+
+// TestAddTruncatedEventsNotice checks that truncated event results carry a warning on the first frame.
+func TestAddTruncatedEventsNotice(t *testing.T) {
+	t.Parallel()
+
+	frames := data.Frames{data.NewFrame("Batch"), data.NewFrame("Phase")}
+	addTruncatedEventsNotice(frames, 10, false)
+	require.NotNil(t, frames[0].Meta)
+	require.Len(t, frames[0].Meta.Notices, 1)
+	assert.Equal(t, data.NoticeSeverityWarning, frames[0].Meta.Notices[0].Severity)
+	assert.Contains(t, frames[0].Meta.Notices[0].Text, "more than 10 events")
+	assert.Contains(t, frames[0].Meta.Notices[0].Text, "set a limit")
+	assert.Nil(t, frames[1].Meta)
+
+	limited := data.Frames{data.NewFrame("Batch")}
+	addTruncatedEventsNotice(limited, 10, true)
+	require.Len(t, limited[0].Meta.Notices, 1)
+	assert.Contains(t, limited[0].Meta.Notices[0].Text, "more than 10 events")
+	assert.NotContains(t, limited[0].Meta.Notices[0].Text, "limit", "a query with a limit must not be told to set one")
+
+	addTruncatedEventsNotice(data.Frames{}, 10, false)
+}
+
+// TestHandleEventQuery_AssetPropertiesConcurrently checks that the asset properties of many
+// events are queried concurrently and that every result ends up in the row of its event.
+func TestHandleEventQuery_AssetPropertiesConcurrently(t *testing.T) {
+	t.Parallel()
+
+	asset := schemas.Asset{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "reactor"}, AssetPath: `\\site\\reactor`}
+	eventType := schemas.EventType{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Batch"}}
+	measurementUUID := uuid.New()
+	assetProperty := schemas.AssetProperty{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "Temperature"}, AssetUUID: asset.UUID, MeasurementUUID: measurementUUID}
+
+	startTime := time.Date(2026, 4, 30, 12, 0, 0, 0, time.UTC)
+	events := make([]schemas.Event, 40)
+	for i := range events {
+		stopTime := startTime.Add(time.Duration(i)*time.Hour + time.Minute)
+		events[i] = schemas.Event{UUID: uuid.New(), AssetUUID: asset.UUID, EventTypeUUID: eventType.UUID, StartTime: startTime.Add(time.Duration(i) * time.Hour), StopTime: &stopTime}
+	}
+
+	var inFlight, maxInFlight atomic.Int32
+	server := newFakeHistorianServer(t, fakeHistorianData{
+		assetsByPath:    map[string]schemas.Asset{asset.AssetPath: asset},
+		assetsByUUID:    map[string]schemas.Asset{asset.UUID.String(): asset},
+		eventTypesByKey: map[string]schemas.EventType{eventType.Name: eventType},
+		allEventTypes:   []schemas.EventType{eventType},
+		events:          events,
+		assetProperties: []schemas.AssetProperty{assetProperty},
+		timeseries: func(w http.ResponseWriter, r *http.Request) {
+			current := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				highest := maxInFlight.Load()
+				if current <= highest || maxInFlight.CompareAndSwap(highest, current) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+
+			query := schemas.Query{}
+			if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+				panic(err)
+			}
+			// The value is the hour of the event start so every row can be matched to its event
+			value := query.Start.Sub(startTime).Hours()
+			frame := data.NewFrame("",
+				data.NewField("time", nil, []time.Time{query.Start}),
+				data.NewField(valueFieldName, nil, []*float64{&value}),
+			)
+			frame.Meta = &data.FrameMeta{Custom: map[string]interface{}{"MeasurementUUID": measurementUUID.String()}}
+			encoded, err := data.Frames{frame}.MarshalArrow()
+			if err != nil {
+				panic(err)
+			}
+			body, err := proto.Marshal(&arrow_pb.DataResponse{Frames: encoded})
+			if err != nil {
+				panic(err)
+			}
+			_, _ = w.Write(body)
+		},
+	})
+	t.Cleanup(server.Close)
+
+	apiClient, err := api.NewAPIWithToken(server.URL, "test-token", "test-org")
+	require.NoError(t, err)
+	ds := &HistorianDataSource{API: apiClient}
+
+	eventQuery := schemas.EventQuery{
+		Type:                 string(schemas.EventTypePropertyTypeSimple),
+		Assets:               []string{asset.AssetPath},
+		EventTypes:           []string{eventType.Name},
+		QueryAssetProperties: true,
+		Options:              &schemas.MeasurementQueryOptions{Aggregation: &schemas.Aggregation{Name: schemas.Mean}},
+	}
+	timeRange := backend.TimeRange{From: startTime.Add(-time.Hour), To: startTime.Add(48 * time.Hour)}
+
+	frames, err := ds.handleEventQuery(context.Background(), eventQuery, timeRange, time.Minute, 1000, &schemas.HistorianInfo{Version: "v7.0.0"})
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+
+	eventUUIDs, _ := frames[0].FieldByName(EventUUIDColumnName)
+	temperatures, _ := frames[0].FieldByName("Temperature")
+	require.NotNil(t, eventUUIDs)
+	require.NotNil(t, temperatures)
+	require.Equal(t, len(events), temperatures.Len())
+	for i := range events {
+		eventUUID := *eventUUIDs.At(i).(*string)
+		index := slices.IndexFunc(events, func(event schemas.Event) bool { return event.UUID.String() == eventUUID })
+		require.NotEqual(t, -1, index)
+		assert.Equal(t, float64(index), *temperatures.At(i).(*float64))
+	}
+	assert.Greater(t, maxInFlight.Load(), int32(1), "asset properties must be queried concurrently")
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(eventAssetPropertyConcurrency))
+}
+
 // fakeHistorianData is a minimal in-memory representation of a Historian server's state,
 // keyed by the query parameters the datasource uses to look things up.
 type fakeHistorianData struct {
@@ -166,6 +595,11 @@ type fakeHistorianData struct {
 	eventTypesByKey map[string]schemas.EventType
 	allEventTypes   []schemas.EventType
 	events          []schemas.Event
+	ancestorEvents  []schemas.Event
+	childEvents     []schemas.Event
+	assetProperties []schemas.AssetProperty
+	timeseries      http.HandlerFunc
+	onEventQuery    func(schemas.EventFilter)
 }
 
 // newFakeHistorianServer spins up an httptest.Server that serves only the endpoints the
@@ -214,14 +648,35 @@ func newFakeHistorianServer(t *testing.T, fixture fakeHistorianData) *httptest.S
 		writeJSON(w, fixture.allEventTypes)
 	})
 
-	mux.HandleFunc("/api/events", func(w http.ResponseWriter, _ *http.Request) {
-		writeJSON(w, fixture.events)
+	mux.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
+		filter := schemas.EventFilter{}
+		if err := form.NewDecoder().Decode(&filter, r.URL.Query()); err != nil {
+			panic(err)
+		}
+		if fixture.onEventQuery != nil {
+			fixture.onEventQuery(filter)
+		}
+		matched := []schemas.Event{}
+		for _, event := range slices.Concat(fixture.events, fixture.ancestorEvents, fixture.childEvents) {
+			if len(filter.EventTypeUUIDs) == 0 || slices.Contains(filter.EventTypeUUIDs, event.EventTypeUUID) {
+				matched = append(matched, event)
+			}
+		}
+		writeJSON(w, matched)
 	})
 
 	mux.HandleFunc("/api/event-type-properties", func(w http.ResponseWriter, _ *http.Request) {
 		writeJSON(w, []schemas.EventTypeProperty{})
 	})
 
+	mux.HandleFunc("/api/asset-properties", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, fixture.assetProperties)
+	})
+
+	if fixture.timeseries != nil {
+		mux.HandleFunc("/api/timeseries/query", fixture.timeseries)
+	}
+
 	return httptest.NewServer(mux)
 }
 
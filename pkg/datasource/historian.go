@@ -17,6 +17,7 @@ var (
 	_ backend.QueryDataHandler      = (*HistorianDataSource)(nil)
 	_ backend.CheckHealthHandler    = (*HistorianDataSource)(nil)
 	_ backend.CallResourceHandler   = (*HistorianDataSource)(nil)
+	_ backend.StreamHandler         = (*HistorianDataSource)(nil)
 	_ instancemgmt.InstanceDisposer = (*HistorianDataSource)(nil)
 )
 
@@ -33,10 +34,15 @@ type HistorianDataSource struct {
 	API             *api.API
 	Decoder         *form.Decoder
 	resourceHandler backend.CallResourceHandler
+	queryCache      *queryCache
 
 	infoMu     sync.Mutex
 	info       *schemas.HistorianInfo
 	infoExpiry time.Time
+
+	// disposed is closed when the instance is disposed, stopping all running streams
+	disposed    chan struct{}
+	disposeOnce sync.Once
 }
 
 // getHistorianInfo returns the historian info, refreshing the cached value when
@@ -57,6 +63,18 @@ func (ds *HistorianDataSource) getHistorianInfo(ctx context.Context) (*schemas.H
 	return ds.info, nil
 }
 
+// flushCache drops the cached metadata, query results and historian info
+func (ds *HistorianDataSource) flushCache() {
+	ds.API.FlushCache()
+	if ds.queryCache != nil {
+		ds.queryCache.flush()
+	}
+
+	ds.infoMu.Lock()
+	defer ds.infoMu.Unlock()
+	ds.info = nil
+}
+
 // NewDataSource creates a new data source instance
 func NewDataSource(_ context.Context, s backend.DataSourceInstanceSettings) (instancemgmt.Instance, error) {
 	settings, err := LoadSettings(s)
@@ -65,17 +83,30 @@ func NewDataSource(_ context.Context, s backend.DataSourceInstanceSettings) (ins
 	}
 
 	historianDataSource := &HistorianDataSource{
-		Decoder: form.NewDecoder(),
+		Decoder:  form.NewDecoder(),
+		disposed: make(chan struct{}),
+	}
+	apiOptions, err := settings.APIOptions()
+	if err != nil {
+		return nil, err
 	}
-	historianDataSource.API, err = api.NewAPIWithToken(settings.URL, settings.Token, settings.Organization)
+
+	historianDataSource.API, err = api.NewAPI(apiOptions)
 	if err != nil {
 		return nil, err
 	}
 
+	historianDataSource.queryCache = newQueryCache(int64(settings.QueryCacheSizeMB) << 20)
 	historianDataSource.resourceHandler = historianDataSource.initializeResourceRoutes()
 
 	return historianDataSource, nil
 }
 
 // Dispose here tells plugin SDK that plugin wants to clean up resources when a new instance is created.
-func (*HistorianDataSource) Dispose() {}
+func (ds *HistorianDataSource) Dispose() {
+	ds.disposeOnce.Do(func() {
+		if ds.disposed != nil {
+			close(ds.disposed)
+		}
+	})
+}
@@ -0,0 +1,495 @@
+package datasource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/api"
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/util"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// historianAggregationVersions are the aggregations the datasource can compute from the raw points, with the first
+// historian version that supports them. An empty version means every historian supports it, aggregations
+// missing from the map are always computed by the datasource.
+var historianAggregationVersions = map[schemas.AggregationType]string{
+	schemas.TWA:      "7.3.0",
+	schemas.Integral: "7.3.0",
+}
+
+// isLocalAggregation returns whether the datasource can compute the aggregation from the raw points
+func isLocalAggregation(aggregation schemas.AggregationType) bool {
+	switch aggregation {
+	case schemas.TWA, schemas.Integral, schemas.DurationInState, schemas.PercentGood,
+		schemas.StateDuration, schemas.StateCount, schemas.StateAtStart:
+		return true
+	default:
+		return false
+	}
+}
+
+// aggregatedMeasurementQuery runs the query, aggregations the historian does not support are computed from the raw points.
+// It returns whether the datasource computed the aggregation, those results already start from the last known point.
+func (ds *HistorianDataSource) aggregatedMeasurementQuery(ctx context.Context, query schemas.Query, stats *queryCacheStats) (data.Frames, bool, error) {
+	if query.Aggregation == nil || !isLocalAggregation(query.Aggregation.Name) {
+		frames, err := ds.measurementQuery(ctx, query, stats)
+		return frames, false, err
+	}
+
+	supported, err := ds.historianSupportsAggregation(ctx, query.Aggregation.Name)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if supported {
+		frames, err := ds.measurementQuery(ctx, query, stats)
+		if !errors.Is(err, api.ErrValidation) {
+			return frames, false, err
+		}
+		log.DefaultLogger.Debug("Historian rejected the aggregation, computing it from the raw points", "aggregation", query.Aggregation.Name, "error", err)
+	}
+
+	frames, err := ds.localAggregationQuery(ctx, query, stats)
+	return frames, true, err
+}
+
+// historianSupportsAggregation returns whether the historian version computes the aggregation itself
+func (ds *HistorianDataSource) historianSupportsAggregation(ctx context.Context, aggregation schemas.AggregationType) (bool, error) {
+	minimumVersion, ok := historianAggregationVersions[aggregation]
+	if !ok {
+		return false, nil
+	}
+	if minimumVersion == "" {
+		return true, nil
+	}
+
+	historianInfo, err := ds.getHistorianInfo(ctx)
+	if err != nil {
+		return false, err
+	}
+	return util.CheckMinimumVersion(historianInfo, minimumVersion, true), nil
+}
+
+// localAggregationQuery fetches the raw points and the last known point before the start of the query
+// and aggregates them per period
+func (ds *HistorianDataSource) localAggregationQuery(ctx context.Context, query schemas.Query, stats *queryCacheStats) (data.Frames, error) {
+	aggregation := *query.Aggregation
+	period := time.Duration(0)
+	if aggregation.Period != "" {
+		parsedPeriod, err := time.ParseDuration(aggregation.Period)
+		if err != nil || parsedPeriod <= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrorMessageInvalidAggregationPeriod, aggregation.Period)
+		}
+		period = parsedPeriod
+	}
+
+	rawQuery := query
+	rawQuery.Aggregation = nil
+	rawQuery.Desc = false
+	rawQuery.Limit = 0
+	if aggregation.Name == schemas.PercentGood && !slices.Contains(query.GroupBy, "status") {
+		rawQuery.GroupBy = append(slices.Clone(query.GroupBy), "status")
+	}
+
+	frames, err := ds.measurementQuery(ctx, rawQuery, stats)
+	if err != nil {
+		return nil, err
+	}
+
+	start := query.Start
+	lastPointQuery := rawQuery
+	lastPointQuery.Start = time.Time{}.Add(time.Millisecond)
+	lastPointQuery.End = &start
+	lastPointQuery.Aggregation = &schemas.Aggregation{Name: schemas.Last}
+	lastKnownFrames, err := ds.measurementQuery(ctx, lastPointQuery, stats)
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now()
+	if query.End != nil && query.End.Before(end) {
+		end = *query.End
+	}
+
+	return aggregateFramesLocally(append(lastKnownFrames, frames...), aggregation, query.Start, end, period)
+}
+
+// stepPoint is a point of a series, its value holds until the next point
+type stepPoint struct {
+	time   time.Time
+	value  interface{}
+	status string
+}
+
+// localSeries collects the points of one series from the raw and last known point frames
+type localSeries struct {
+	frame  *data.Frame
+	points []stepPoint
+}
+
+// aggregateFramesLocally aggregates the series in the frames per period between start and end, or over the whole
+// range when period is 0. Every value holds until the next point, so a series without points in a window is
+// aggregated from its previous value. Percent good combines the frames of a series that only differ in status,
+// state duration and state count return a frame per state with the state as label.
+func aggregateFramesLocally(frames data.Frames, aggregation schemas.Aggregation, start, end time.Time, period time.Duration) (data.Frames, error) {
+	if aggregation.Name == schemas.DurationInState && len(aggregation.Arguments) == 0 {
+		return nil, fmt.Errorf("%w: %s expects the state as argument", ErrorMessageMissingAggregationArgument, aggregation.Name)
+	}
+
+	unit := time.Second
+	if aggregation.Name == schemas.Integral && len(aggregation.Arguments) > 0 {
+		parsedUnit, err := time.ParseDuration(fmt.Sprint(aggregation.Arguments[0]))
+		if err != nil || parsedUnit <= 0 {
+			return nil, fmt.Errorf("%w: %v", ErrorMessageInvalidAggregationPeriod, aggregation.Arguments[0])
+		}
+		unit = parsedUnit
+	}
+
+	seriesByID := map[string]*localSeries{}
+	seriesIDs := []string{}
+	for _, frame := range frames {
+		timeField, _ := frame.FieldByName("time")
+		valueField, _ := frame.FieldByName(valueFieldName)
+		if timeField == nil || valueField == nil {
+			continue
+		}
+
+		status, _ := getLabelsFromFrame(frame)["status"].(string)
+		seriesID := getFrameID(frame)
+		if aggregation.Name == schemas.PercentGood {
+			seriesID = getMeasurementUUIDFromFrame(frame) + getFrameSuffix(frameWithLabel(frame, "status", nil), false, false)
+		}
+
+		series, ok := seriesByID[seriesID]
+		if !ok {
+			series = &localSeries{frame: frame}
+			seriesByID[seriesID] = series
+			seriesIDs = append(seriesIDs, seriesID)
+		}
+
+		for i := 0; i < valueField.Len(); i++ {
+			timestamp, ok := timeField.ConcreteAt(i)
+			if !ok {
+				continue
+			}
+			value, _ := valueField.ConcreteAt(i)
+			series.points = append(series.points, stepPoint{time: timestamp.(time.Time), value: value, status: status})
+		}
+	}
+
+	windows := aggregationWindows(start, end, period)
+	result := make(data.Frames, 0, len(seriesIDs))
+	for _, seriesID := range seriesIDs {
+		series := seriesByID[seriesID]
+		slices.SortStableFunc(series.points, func(a, b stepPoint) int {
+			return a.time.Compare(b.time)
+		})
+
+		switch aggregation.Name {
+		case schemas.StateDuration, schemas.StateCount:
+			result = append(result, stateFrames(series, windows, aggregation)...)
+		case schemas.StateAtStart:
+			result = append(result, stateAtStartFrame(series, windows, aggregation.Fill))
+		default:
+			timestamps := make([]time.Time, 0, len(windows))
+			values := make([]*float64, 0, len(windows))
+			var previous *float64
+			for _, window := range windows {
+				value := aggregateWindow(series.points, window.from, window.to, aggregation, unit)
+				if value != nil {
+					previous = value
+				}
+				if value, ok := fillValue(value, previous, aggregation.Fill); ok {
+					timestamps = append(timestamps, window.at)
+					values = append(values, value)
+				}
+			}
+
+			source := series.frame
+			if aggregation.Name == schemas.PercentGood {
+				source = frameWithLabel(source, "status", nil)
+			}
+			result = append(result, localAggregationFrame(source, timestamps, data.NewField(valueFieldName, nil, values)))
+		}
+	}
+
+	return result, nil
+}
+
+// aggregationWindow is the time range of one aggregated value, at is the timestamp of the value
+type aggregationWindow struct {
+	at, from, to time.Time
+}
+
+// aggregationWindows splits the range between start and end in periods aligned like the historian aligns them, so the
+// timestamps match the aggregations of the historian. The first window only covers its period from start, the last
+// window ends at end.
+func aggregationWindows(start, end time.Time, period time.Duration) []aggregationWindow {
+	windows := []aggregationWindow{}
+	at := start
+	if period > 0 {
+		at = start.Truncate(period)
+	}
+	for from := start; from.Before(end); {
+		to := end
+		if period > 0 && at.Add(period).Before(end) {
+			to = at.Add(period)
+		}
+		windows = append(windows, aggregationWindow{at: at, from: from, to: to})
+		from, at = to, to
+	}
+	return windows
+}
+
+// fillValue applies the fill type to a window without a value, ok is false when the window is left out
+func fillValue(value, previous *float64, fill schemas.FillType) (*float64, bool) {
+	if value != nil {
+		return value, true
+	}
+
+	switch fill {
+	case schemas.None:
+		return nil, false
+	case schemas.Zero:
+		return new(0.0), true
+	case schemas.Previous:
+		return previous, true
+	default:
+		return nil, true
+	}
+}
+
+// walkWindow calls visit for every value that holds between from and to, with the duration it holds for.
+// The value at the start of the window is carried over from the last point before it, entered is false for it.
+func walkWindow(points []stepPoint, from, to time.Time, visit func(point stepPoint, duration time.Duration, entered bool)) {
+	i := sort.Search(len(points), func(i int) bool {
+		return points[i].time.After(from)
+	})
+	var current *stepPoint
+	if i > 0 {
+		current = &points[i-1]
+	}
+
+	entered := false
+	cursor := from
+	for ; i < len(points) && points[i].time.Before(to); i++ {
+		if current != nil {
+			visit(*current, points[i].time.Sub(cursor), entered)
+		}
+		current = &points[i]
+		cursor = points[i].time
+		entered = true
+	}
+	if current != nil {
+		visit(*current, to.Sub(cursor), entered)
+	}
+}
+
+// aggregateWindow aggregates the points between from and to, nil when no value is known in the window
+func aggregateWindow(points []stepPoint, from, to time.Time, aggregation schemas.Aggregation, unit time.Duration) *float64 {
+	var known, matched time.Duration
+	weighted := 0.0
+	walkWindow(points, from, to, func(point stepPoint, duration time.Duration, _ bool) {
+		switch aggregation.Name {
+		case schemas.TWA, schemas.Integral:
+			if value, ok := toFloat64(point.value); ok {
+				known += duration
+				weighted += value * duration.Seconds()
+			}
+		case schemas.DurationInState:
+			if point.value != nil {
+				known += duration
+				if valuesEqual(point.value, aggregation.Arguments[0]) {
+					matched += duration
+				}
+			}
+		case schemas.PercentGood:
+			known += duration
+			if point.status == "Good" {
+				matched += duration
+			}
+		}
+	})
+
+	if known == 0 {
+		return nil
+	}
+
+	var value float64
+	switch aggregation.Name {
+	case schemas.TWA:
+		value = weighted / known.Seconds()
+	case schemas.Integral:
+		value = weighted / unit.Seconds()
+	case schemas.DurationInState:
+		value = matched.Seconds()
+	case schemas.PercentGood:
+		value = 100 * matched.Seconds() / known.Seconds()
+	}
+	return &value
+}
+
+// stateFrames returns a frame per state of the series with the seconds spent in, or the number of times the
+// series entered, the state per window. A window in which the series has a value but never is in a state gives 0.
+func stateFrames(series *localSeries, windows []aggregationWindow, aggregation schemas.Aggregation) data.Frames {
+	perWindow := make([]map[string]float64, len(windows))
+	states := map[string]struct{}{}
+	for i, window := range windows {
+		previousState, hasPreviousState := "", false
+		walkWindow(series.points, window.from, window.to, func(point stepPoint, duration time.Duration, entered bool) {
+			state, ok := toString(point.value)
+			if !ok {
+				hasPreviousState = false
+				return
+			}
+			if perWindow[i] == nil {
+				perWindow[i] = map[string]float64{}
+			}
+			states[state] = struct{}{}
+
+			switch aggregation.Name {
+			case schemas.StateDuration:
+				perWindow[i][state] += duration.Seconds()
+			case schemas.StateCount:
+				if entered && (!hasPreviousState || state != previousState) {
+					perWindow[i][state]++
+				}
+			}
+			previousState, hasPreviousState = state, true
+		})
+	}
+
+	frames := make(data.Frames, 0, len(states))
+	for _, state := range slices.Sorted(maps.Keys(states)) {
+		timestamps := make([]time.Time, 0, len(windows))
+		values := make([]*float64, 0, len(windows))
+		var previous *float64
+		for i, window := range windows {
+			var value *float64
+			if perWindow[i] != nil {
+				value = new(perWindow[i][state])
+				previous = value
+			}
+			if value, ok := fillValue(value, previous, aggregation.Fill); ok {
+				timestamps = append(timestamps, window.at)
+				values = append(values, value)
+			}
+		}
+
+		source := frameWithLabel(series.frame, "state", state)
+		frames = append(frames, localAggregationFrame(source, timestamps, data.NewField(valueFieldName, nil, values)))
+	}
+	return frames
+}
+
+// stateAtStartFrame returns a frame with the value of the series at the start of every window, it keeps the
+// type of the series
+func stateAtStartFrame(series *localSeries, windows []aggregationWindow, fill schemas.FillType) *data.Frame {
+	valueType := data.FieldTypeNullableString
+	if sourceValueField, _ := series.frame.FieldByName(valueFieldName); sourceValueField != nil {
+		valueType = sourceValueField.Type().NullableType()
+	}
+
+	timestamps := make([]time.Time, 0, len(windows))
+	valueField := data.NewFieldFromFieldType(valueType, 0)
+	valueField.Name = valueFieldName
+	var previous interface{}
+	for _, window := range windows {
+		// The value at the start of the window is the last point at or before it
+		i := sort.Search(len(series.points), func(i int) bool {
+			return series.points[i].time.After(window.from)
+		})
+
+		var value interface{}
+		if i > 0 {
+			value = series.points[i-1].value
+		}
+		switch {
+		case value != nil:
+			previous = value
+		case fill == schemas.None:
+			continue
+		case fill == schemas.Previous:
+			value = previous
+		}
+
+		timestamps = append(timestamps, window.at)
+		addValueToField(valueField, value)
+	}
+
+	return localAggregationFrame(series.frame, timestamps, valueField)
+}
+
+// valuesEqual compares a value with a state argument, numbers and bools compare numerically
+func valuesEqual(value, state interface{}) bool {
+	if valueFloat, ok := toFloat64(value); ok {
+		if stateFloat, ok := toFloat64(state); ok {
+			return valueFloat == stateFloat
+		}
+	}
+	return fmt.Sprint(value) == fmt.Sprint(state)
+}
+
+// localAggregationFrame returns a frame shaped like the frames of an aggregated historian query
+func localAggregationFrame(source *data.Frame, timestamps []time.Time, valueField *data.Field) *data.Frame {
+	if sourceValueField, _ := source.FieldByName(valueFieldName); sourceValueField != nil {
+		valueField.Labels = sourceValueField.Labels
+		valueField.Config = sourceValueField.Config
+	}
+
+	frame := data.NewFrame(source.Name, data.NewField("time", nil, timestamps), valueField)
+	if source.Meta != nil {
+		meta := *source.Meta
+		frame.Meta = &meta
+	}
+	return frame
+}
+
+// frameWithLabel returns a shallow copy of the frame with the label set to value, or removed when value is nil
+func frameWithLabel(frame *data.Frame, key string, value interface{}) *data.Frame {
+	copied := *frame
+	if frame.Meta != nil {
+		if custom, ok := frame.Meta.Custom.(map[string]interface{}); ok {
+			custom = maps.Clone(custom)
+			labels, _ := custom["Labels"].(map[string]interface{})
+			labels = maps.Clone(labels)
+			if labels == nil {
+				labels = map[string]interface{}{}
+			}
+			if value == nil {
+				delete(labels, key)
+			} else {
+				labels[key] = value
+			}
+			custom["Labels"] = labels
+
+			meta := *frame.Meta
+			meta.Custom = custom
+			copied.Meta = &meta
+		}
+	}
+
+	// The historian can also set the labels on the value field
+	copied.Fields = slices.Clone(frame.Fields)
+	for i, field := range copied.Fields {
+		if field.Name != valueFieldName || field.Labels == nil {
+			continue
+		}
+		fieldCopy := *field
+		fieldCopy.Labels = maps.Clone(field.Labels)
+		if value == nil {
+			delete(fieldCopy.Labels, key)
+		} else {
+			fieldCopy.Labels[key] = fmt.Sprint(value)
+		}
+		copied.Fields[i] = &fieldCopy
+	}
+	return &copied
+}
@@ -0,0 +1,230 @@
+package datasource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeStepSeries returns a frame with a point at every offset in seconds from time.Unix(0, 0)
+func makeStepSeries(t *testing.T, offsets []int64, values interface{}, status string) *data.Frame {
+	t.Helper()
+	timestamps := make([]time.Time, len(offsets))
+	for i, offset := range offsets {
+		timestamps[i] = time.Unix(offset, 0)
+	}
+	frame := makeFrame(t, data.NewField(valueFieldName, nil, values), "")
+	frame.Fields[0] = data.NewField("time", nil, timestamps)
+	frame.Meta.Custom.(map[string]interface{})["Labels"] = map[string]interface{}{"status": status}
+	return frame
+}
+
+func localValues(t *testing.T, frames data.Frames) []*float64 {
+	t.Helper()
+	require.Len(t, frames, 1)
+	valueField, _ := frames[0].FieldByName(valueFieldName)
+	require.NotNil(t, valueField)
+	values := make([]*float64, valueField.Len())
+	for i := range values {
+		values[i] = valueField.At(i).(*float64)
+	}
+	return values
+}
+
+func TestAggregateFramesLocally(t *testing.T) {
+	t.Parallel()
+
+	// The value is 10 from the last known point at -5s, 20 from 5s and 40 from 15s
+	numeric := func() data.Frames {
+		return data.Frames{
+			makeStepSeries(t, []int64{-5}, []float64{10}, "Good"),
+			makeStepSeries(t, []int64{5, 15}, []float64{20, 40}, "Good"),
+		}
+	}
+	start, end := time.Unix(0, 0), time.Unix(20, 0)
+
+	testCases := []struct {
+		name        string
+		frames      data.Frames
+		aggregation schemas.Aggregation
+		period      time.Duration
+		expected    []*float64
+	}{
+		{
+			name:        "twa per period",
+			frames:      numeric(),
+			aggregation: schemas.Aggregation{Name: schemas.TWA},
+			period:      10 * time.Second,
+			expected:    []*float64{new(15.0), new(30.0)},
+		},
+		{
+			name:        "twa over the range",
+			frames:      numeric(),
+			aggregation: schemas.Aggregation{Name: schemas.TWA},
+			expected:    []*float64{new(22.5)},
+		},
+		{
+			name:        "integral",
+			frames:      numeric(),
+			aggregation: schemas.Aggregation{Name: schemas.Integral},
+			period:      10 * time.Second,
+			expected:    []*float64{new(150.0), new(300.0)},
+		},
+		{
+			name:        "integral per minute",
+			frames:      numeric(),
+			aggregation: schemas.Aggregation{Name: schemas.Integral, Arguments: []interface{}{"1m"}},
+			expected:    []*float64{new(7.5)},
+		},
+		{
+			name: "duration in state",
+			frames: data.Frames{
+				makeStepSeries(t, []int64{0, 4, 12}, []string{"Running", "Stopped", "Running"}, "Good"),
+			},
+			aggregation: schemas.Aggregation{Name: schemas.DurationInState, Arguments: []interface{}{"Running"}},
+			period:      10 * time.Second,
+			expected:    []*float64{new(4.0), new(8.0)},
+		},
+		{
+			name: "percent good",
+			frames: data.Frames{
+				makeStepSeries(t, []int64{0, 10}, []float64{1, 3}, "Good"),
+				makeStepSeries(t, []int64{5}, []float64{2}, "Bad"),
+			},
+			aggregation: schemas.Aggregation{Name: schemas.PercentGood},
+			expected:    []*float64{new(75.0)},
+		},
+		{
+			name:        "no value before the first point",
+			frames:      data.Frames{makeStepSeries(t, []int64{15}, []float64{40}, "Good")},
+			aggregation: schemas.Aggregation{Name: schemas.TWA, Fill: schemas.Null},
+			period:      10 * time.Second,
+			expected:    []*float64{nil, new(40.0)},
+		},
+		{
+			name:        "fill zero",
+			frames:      data.Frames{makeStepSeries(t, []int64{15}, []float64{40}, "Good")},
+			aggregation: schemas.Aggregation{Name: schemas.TWA, Fill: schemas.Zero},
+			period:      10 * time.Second,
+			expected:    []*float64{new(0.0), new(40.0)},
+		},
+		{
+			name:        "fill none",
+			frames:      data.Frames{makeStepSeries(t, []int64{15}, []float64{40}, "Good")},
+			aggregation: schemas.Aggregation{Name: schemas.TWA, Fill: schemas.None},
+			period:      10 * time.Second,
+			expected:    []*float64{new(40.0)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			frames, err := aggregateFramesLocally(tc.frames, tc.aggregation, start, end, tc.period)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, localValues(t, frames))
+		})
+	}
+}
+
+func TestAggregateFramesLocally_AlignedWindows(t *testing.T) {
+	t.Parallel()
+
+	// The windows are aligned on the period like the historian aligns them, the first one only covers the range from 7s
+	frames := data.Frames{makeStepSeries(t, []int64{-5, 15}, []float64{10, 20}, "Good")}
+	result, err := aggregateFramesLocally(frames, schemas.Aggregation{Name: schemas.TWA}, time.Unix(7, 0), time.Unix(30, 0), 10*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []*float64{new(10.0), new(15.0), new(20.0)}, localValues(t, result))
+
+	timeField, _ := result[0].FieldByName("time")
+	require.NotNil(t, timeField)
+	assert.Equal(t, []time.Time{time.Unix(0, 0), time.Unix(10, 0), time.Unix(20, 0)}, []time.Time{timeField.At(0).(time.Time), timeField.At(1).(time.Time), timeField.At(2).(time.Time)})
+}
+
+func TestAggregateFramesLocally_PercentGoodDropsStatus(t *testing.T) {
+	t.Parallel()
+
+	good := makeStepSeries(t, []int64{0}, []float64{1}, "Good")
+	bad := makeStepSeries(t, []int64{5}, []float64{2}, "Bad")
+	frames, err := aggregateFramesLocally(data.Frames{good, bad}, schemas.Aggregation{Name: schemas.PercentGood}, time.Unix(0, 0), time.Unix(10, 0), 0)
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	assert.Empty(t, getLabelsFromFrame(frames[0]))
+	assert.Equal(t, "Good", getLabelsFromFrame(good)["status"], "source frames are not modified")
+}
+
+func TestAggregateFramesLocally_MissingState(t *testing.T) {
+	t.Parallel()
+
+	_, err := aggregateFramesLocally(nil, schemas.Aggregation{Name: schemas.DurationInState}, time.Unix(0, 0), time.Unix(10, 0), 0)
+	assert.ErrorIs(t, err, ErrorMessageMissingAggregationArgument)
+}
+
+func TestAggregateFramesLocally_States(t *testing.T) {
+	t.Parallel()
+
+	// Running from -5s, Stopped from 4s, Running from 12s and Stopped again from 14s
+	states := func() data.Frames {
+		return data.Frames{
+			makeStepSeries(t, []int64{-5}, []string{"Running"}, "Good"),
+			makeStepSeries(t, []int64{4, 12, 14}, []string{"Stopped", "Running", "Stopped"}, "Good"),
+		}
+	}
+	start, end := time.Unix(0, 0), time.Unix(20, 0)
+
+	testCases := []struct {
+		name        string
+		aggregation schemas.AggregationType
+		expected    map[string][]*float64
+	}{
+		{
+			name:        "state duration",
+			aggregation: schemas.StateDuration,
+			expected: map[string][]*float64{
+				"Running": {new(4.0), new(2.0)},
+				"Stopped": {new(6.0), new(8.0)},
+			},
+		},
+		{
+			name:        "state count",
+			aggregation: schemas.StateCount,
+			expected: map[string][]*float64{
+				"Running": {new(0.0), new(1.0)},
+				"Stopped": {new(1.0), new(1.0)},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			frames, err := aggregateFramesLocally(states(), schemas.Aggregation{Name: tc.aggregation}, start, end, 10*time.Second)
+			require.NoError(t, err)
+			require.Len(t, frames, len(tc.expected))
+			for _, frame := range frames {
+				state, _ := getLabelsFromFrame(frame)["state"].(string)
+				assert.Equal(t, tc.expected[state], localValues(t, data.Frames{frame}), state)
+				assert.Equal(t, "Good", getLabelsFromFrame(frame)["status"])
+			}
+		})
+	}
+}
+
+func TestAggregateFramesLocally_StateAtStart(t *testing.T) {
+	t.Parallel()
+
+	frames, err := aggregateFramesLocally(data.Frames{
+		makeStepSeries(t, []int64{5, 12}, []*bool{new(true), new(false)}, "Good"),
+	}, schemas.Aggregation{Name: schemas.StateAtStart}, time.Unix(0, 0), time.Unix(30, 0), 10*time.Second)
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+
+	valueField, _ := frames[0].FieldByName(valueFieldName)
+	require.NotNil(t, valueField)
+	assert.Equal(t, data.FieldTypeNullableBool, valueField.Type())
+	assert.Equal(t, []*bool{nil, new(true), new(false)}, []*bool{valueField.At(0).(*bool), valueField.At(1).(*bool), valueField.At(2).(*bool)})
+}
@@ -0,0 +1,386 @@
+package datasource
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
+)
+
+// Query cache consts
+const (
+	// queryCacheSettleDelay is how far behind now data is considered final, points arriving
+	// later than this are missed until the cached entry is evicted or flushed
+	queryCacheSettleDelay = time.Minute
+	// queryCacheRawAlignment aligns the cached part of non-aggregated queries
+	queryCacheRawAlignment = time.Minute
+	// queryCacheChunksPerRange is the minimum number of chunks the time range of a query is split in
+	queryCacheChunksPerRange = 4
+	// queryCacheConcurrency is the maximum number of chunk queries that run at the same time for a query
+	queryCacheConcurrency = 4
+)
+
+// queryCacheChunkSpans are the spans of the chunks the cached part of a query is split in. A query uses the largest
+// span that fits its time range queryCacheChunksPerRange times, so a sliding time range keeps hitting the same chunks.
+var queryCacheChunkSpans = []time.Duration{time.Minute, 10 * time.Minute, time.Hour, 6 * time.Hour, 24 * time.Hour, 7 * 24 * time.Hour}
+
+// queryCache is an LRU cache of measurement query results bounded by a memory budget.
+// Frames are stored arrow encoded, which gives an accurate size and hands every caller its own copy.
+type queryCache struct {
+	maxBytes int64
+	group    singleflight.Group
+
+	mu        sync.Mutex
+	usedBytes int64
+	lru       *list.List
+	entries   map[string]*list.Element
+}
+
+type queryCacheEntry struct {
+	key    string
+	frames [][]byte
+	size   int64
+}
+
+// queryCacheStats counts the cache lookups done for a single query
+type queryCacheStats struct {
+	hits   int
+	misses int
+}
+
+// queryCachePiece is a part of the time range of a query, cached pieces go through the query cache
+type queryCachePiece struct {
+	query  schemas.Query
+	cached bool
+}
+
+func newQueryCache(maxBytes int64) *queryCache {
+	if maxBytes <= 0 {
+		return nil
+	}
+
+	return &queryCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func (c *queryCache) get(key string) (data.Frames, bool) {
+	c.mu.Lock()
+	element, ok := c.entries[key]
+	if !ok {
+		c.mu.Unlock()
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	encoded := element.Value.(*queryCacheEntry).frames
+	c.mu.Unlock()
+
+	frames, err := data.UnmarshalArrowFrames(encoded)
+	if err != nil {
+		return nil, false
+	}
+	return frames, true
+}
+
+func (c *queryCache) set(key string, encoded [][]byte) {
+	size := int64(0)
+	for _, frame := range encoded {
+		size += int64(len(frame))
+	}
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	for c.usedBytes+size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+
+	c.entries[key] = c.lru.PushFront(&queryCacheEntry{key: key, frames: encoded, size: size})
+	c.usedBytes += size
+}
+
+func (c *queryCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*queryCacheEntry)
+	delete(c.entries, entry.key)
+	c.usedBytes -= entry.size
+}
+
+func (c *queryCache) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.entries = map[string]*list.Element{}
+	c.usedBytes = 0
+}
+
+// queryCacheKey returns the cache key of a query, independent of the order of its measurements and group by tags
+func queryCacheKey(query schemas.Query) (string, error) {
+	query.MeasurementUUIDs = slices.Sorted(slices.Values(query.MeasurementUUIDs))
+	query.GroupBy = slices.Sorted(slices.Values(query.GroupBy))
+	query.Start = query.Start.UTC()
+	if query.End != nil {
+		end := query.End.UTC()
+		query.End = &end
+	}
+
+	// encoding/json sorts the keys of the tags map
+	body, err := json.Marshal(query)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// queryCacheBoundary returns the time up to which the query result is final and can be cached.
+// It is aligned on the aggregation period, so the cached windows are complete when the period is
+// aligned like the historian aligns it, see canSplitQuery.
+func queryCacheBoundary(query schemas.Query, now time.Time) time.Time {
+	return now.Add(-queryCacheSettleDelay).Truncate(queryCacheAlignment(query))
+}
+
+// queryCacheAlignment returns the aggregation period of the query, or queryCacheRawAlignment without one
+func queryCacheAlignment(query schemas.Query) time.Duration {
+	if query.Aggregation != nil {
+		if period, err := time.ParseDuration(query.Aggregation.Period); err == nil && period > 0 {
+			return period
+		}
+	}
+	return queryCacheRawAlignment
+}
+
+// queryCacheChunkSpan returns the span of the cached chunks for a time range, the largest span that is a multiple of
+// the alignment and fits the time range queryCacheChunksPerRange times, or the smallest multiple when none fits. Every
+// chunk holds complete aggregation periods.
+func queryCacheChunkSpan(alignment, timeRange time.Duration) time.Duration {
+	span := time.Duration(0)
+	for _, chunkSpan := range queryCacheChunkSpans {
+		if chunkSpan%alignment != 0 {
+			continue
+		}
+		if span == 0 || chunkSpan*queryCacheChunksPerRange <= timeRange {
+			span = chunkSpan
+		}
+	}
+	return span
+}
+
+// canSplitQuery returns whether the result of the query can be built from two adjacent time windows
+func canSplitQuery(query schemas.Query) bool {
+	if query.Limit > 0 || query.Offset > 0 || query.Desc {
+		return false
+	}
+
+	if query.Aggregation == nil {
+		return true
+	}
+
+	// Aggregations over the whole range and fills that depend on neighbouring windows need the full range. The historian
+	// aligns aggregation windows on multiples of the period since the Unix epoch, while chunks are aligned on multiples
+	// of their span since the zero time of time.Truncate. Both agree for periods that divide a day, other periods and
+	// calendar periods like months would put chunk boundaries inside windows.
+	if period, err := time.ParseDuration(query.Aggregation.Period); err != nil || period <= 0 || (24*time.Hour)%period != 0 {
+		return false
+	}
+
+	switch query.Aggregation.Fill {
+	case "", schemas.None, schemas.Null, schemas.Zero:
+		return true
+	default:
+		return false
+	}
+}
+
+// measurementQuery runs a measurement query, serving the part of the time range that is fully
+// in the past from the query cache when it is enabled. That part is split in chunks aligned on
+// a span that depends on the length of the time range, so a sliding time range keeps hitting the
+// same chunks. The most recent part is always fetched.
+func (ds *HistorianDataSource) measurementQuery(ctx context.Context, query schemas.Query, stats *queryCacheStats) (data.Frames, error) {
+	if ds.queryCache == nil {
+		return ds.API.MeasurementQuery(ctx, query)
+	}
+
+	now := time.Now()
+	end := now
+	if query.End != nil && query.End.Before(now) {
+		end = *query.End
+	}
+
+	boundary := queryCacheBoundary(query, now)
+	closed := !end.After(boundary)
+	switch {
+	case !boundary.After(query.Start):
+		return ds.API.MeasurementQuery(ctx, query)
+	case !canSplitQuery(query) && closed:
+		return ds.cachedMeasurementQuery(ctx, query, stats)
+	case !canSplitQuery(query):
+		return ds.API.MeasurementQuery(ctx, query)
+	}
+
+	span := queryCacheChunkSpan(queryCacheAlignment(query), end.Sub(query.Start))
+	chunksStart := query.Start.Truncate(span)
+	if chunksStart.Before(query.Start) {
+		chunksStart = chunksStart.Add(span)
+	}
+	chunksEnd := boundary.Truncate(span)
+	if end.Before(boundary) {
+		chunksEnd = end.Truncate(span)
+	}
+	if !chunksEnd.After(chunksStart) {
+		if closed {
+			return ds.cachedMeasurementQuery(ctx, query, stats)
+		}
+		return ds.API.MeasurementQuery(ctx, query)
+	}
+
+	// The head before the first chunk and the tail after the last one depend on the exact time range, they are only
+	// cached when the whole range is in the past
+	pieces := []queryCachePiece{}
+	if query.Start.Before(chunksStart) {
+		head := query
+		head.End = &chunksStart
+		pieces = append(pieces, queryCachePiece{query: head, cached: closed})
+	}
+	for chunkStart := chunksStart; chunkStart.Before(chunksEnd); chunkStart = chunkStart.Add(span) {
+		chunk := query
+		chunk.Start = chunkStart
+		chunk.End = new(chunkStart.Add(span))
+		pieces = append(pieces, queryCachePiece{query: chunk, cached: true})
+	}
+	tail := query
+	tail.Start = chunksEnd
+	pieces = append(pieces, queryCachePiece{query: tail, cached: closed})
+
+	results := make([]data.Frames, len(pieces))
+	pieceStats := make([]queryCacheStats, len(pieces))
+	errGroup, groupCtx := errgroup.WithContext(ctx)
+	errGroup.SetLimit(queryCacheConcurrency)
+	for i, piece := range pieces {
+		errGroup.Go(func() error {
+			var frames data.Frames
+			var err error
+			if piece.cached {
+				frames, err = ds.cachedMeasurementQuery(groupCtx, piece.query, &pieceStats[i])
+			} else {
+				frames, err = ds.API.MeasurementQuery(groupCtx, piece.query)
+			}
+			if err != nil {
+				return err
+			}
+
+			// The historian includes the end of a query, the next piece returns the points on it
+			if i < len(pieces)-1 {
+				frames = framesBefore(frames, *piece.query.End)
+			}
+			results[i] = frames
+			return nil
+		})
+	}
+	if err := errGroup.Wait(); err != nil {
+		return nil, err
+	}
+
+	merged := data.Frames{}
+	for i := range results {
+		merged = mergeFrames(merged, results[i])
+		stats.hits += pieceStats[i].hits
+		stats.misses += pieceStats[i].misses
+	}
+	return merged, nil
+}
+
+// framesBefore drops the rows at or after end from frames sorted on time
+func framesBefore(frames data.Frames, end time.Time) data.Frames {
+	for _, frame := range frames {
+		timeField, _ := frame.FieldByName("time")
+		if timeField == nil {
+			continue
+		}
+
+		for i := frame.Rows() - 1; i >= 0; i-- {
+			timestamp, ok := timeField.ConcreteAt(i)
+			if !ok || timestamp.(time.Time).Before(end) {
+				break
+			}
+			frame.DeleteRow(i)
+		}
+	}
+	return frames
+}
+
+// cachedMeasurementQuery returns the cached result of the query, concurrent misses share one request
+func (ds *HistorianDataSource) cachedMeasurementQuery(ctx context.Context, query schemas.Query, stats *queryCacheStats) (data.Frames, error) {
+	key, err := queryCacheKey(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if frames, ok := ds.queryCache.get(key); ok {
+		stats.hits++
+		return frames, nil
+	}
+	stats.misses++
+
+	// The shared request is detached from the cancellation of the caller that started it
+	resultChan := ds.queryCache.group.DoChan(key, func() (interface{}, error) {
+		frames, err := ds.API.MeasurementQuery(context.WithoutCancel(ctx), query)
+		if err != nil {
+			return nil, err
+		}
+
+		encoded, err := frames.MarshalArrow()
+		if err != nil {
+			return nil, err
+		}
+
+		ds.queryCache.set(key, encoded)
+		return encoded, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-resultChan:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return data.UnmarshalArrowFrames(result.Val.([][]byte))
+	}
+}
+
+// addQueryCacheStats adds the query cache hits and misses to the frame stats
+func addQueryCacheStats(frames data.Frames, stats queryCacheStats) {
+	if stats.hits == 0 && stats.misses == 0 {
+		return
+	}
+
+	for _, frame := range frames {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		frame.Meta.Stats = append(frame.Meta.Stats,
+			data.QueryStat{FieldConfig: data.FieldConfig{DisplayName: "Query cache hits"}, Value: float64(stats.hits)},
+			data.QueryStat{FieldConfig: data.FieldConfig{DisplayName: "Query cache misses"}, Value: float64(stats.misses)},
+		)
+	}
+}
@@ -0,0 +1,324 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/api"
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeTimeseriesServer serves /api/timeseries/query with a row at the start and one at the end of every query,
+// the historian includes both, and records the queries it received.
+func newFakeTimeseriesServer(t *testing.T) (*httptest.Server, func() []schemas.Query) {
+	t.Helper()
+	var (
+		mu      sync.Mutex
+		queries []schemas.Query
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := schemas.Query{}
+		if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+			t.Errorf("decoding query: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		queries = append(queries, query)
+		mu.Unlock()
+
+		timestamps := []time.Time{query.Start}
+		if query.End != nil && query.End.After(query.Start) {
+			timestamps = append(timestamps, *query.End)
+		}
+		frame := data.NewFrame("",
+			data.NewField("time", nil, timestamps),
+			data.NewField(valueFieldName, nil, make([]*float64, len(timestamps))),
+		)
+		frame.Meta = &data.FrameMeta{Custom: map[string]interface{}{"MeasurementUUID": "m1"}}
+		writeFrames(t, w, data.Frames{frame})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []schemas.Query {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]schemas.Query(nil), queries...)
+	}
+}
+
+// newFakeAggregatingServer serves /api/timeseries/query for a series with a point every minute, summed per period in
+// windows aligned on the Unix epoch like the historian does, and counts the queries it received.
+func newFakeAggregatingServer(t *testing.T) (*httptest.Server, func() int) {
+	t.Helper()
+	var queries atomic.Int32
+	epoch := time.Unix(0, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := schemas.Query{}
+		if err := json.NewDecoder(r.Body).Decode(&query); err != nil || query.Aggregation == nil || query.End == nil {
+			t.Errorf("decoding aggregated query: %v", err)
+			http.Error(w, "invalid query", http.StatusBadRequest)
+			return
+		}
+		period, err := time.ParseDuration(query.Aggregation.Period)
+		if err != nil {
+			t.Errorf("parsing period: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		queries.Add(1)
+
+		timestamps := []time.Time{}
+		sums := []*float64{}
+		first := query.Start.Truncate(time.Minute)
+		if first.Before(query.Start) {
+			first = first.Add(time.Minute)
+		}
+		for point := first; !point.After(*query.End); point = point.Add(time.Minute) {
+			window := epoch.Add(point.Sub(epoch) / period * period)
+			if len(timestamps) == 0 || !timestamps[len(timestamps)-1].Equal(window) {
+				timestamps = append(timestamps, window)
+				sums = append(sums, new(0.0))
+			}
+			*sums[len(sums)-1] += float64(point.Unix() / 60 % 17)
+		}
+
+		frame := data.NewFrame("", data.NewField("time", nil, timestamps), data.NewField(valueFieldName, nil, sums))
+		frame.Meta = &data.FrameMeta{Custom: map[string]interface{}{"MeasurementUUID": "m1"}}
+		writeFrames(t, w, data.Frames{frame})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() int { return int(queries.Load()) }
+}
+
+// frameTimes returns the timestamps of the only frame
+func frameTimes(t *testing.T, frames data.Frames) []time.Time {
+	t.Helper()
+	require.Len(t, frames, 1)
+	timestamps := make([]time.Time, frames[0].Rows())
+	for i := range timestamps {
+		timestamps[i] = frames[0].Fields[0].At(i).(time.Time).UTC()
+	}
+	return timestamps
+}
+
+func TestQueryCacheKey(t *testing.T) {
+	t.Parallel()
+
+	end := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	a := schemas.Query{MeasurementUUIDs: []string{"b", "a"}, Start: end.Add(-time.Hour), End: &end, Tags: map[string]string{"x": "1", "y": "2"}}
+	b := schemas.Query{MeasurementUUIDs: []string{"a", "b"}, Start: end.Add(-time.Hour).In(time.FixedZone("CET", 3600)), End: &end, Tags: map[string]string{"y": "2", "x": "1"}}
+	keyA, err := queryCacheKey(a)
+	require.NoError(t, err)
+	keyB, err := queryCacheKey(b)
+	require.NoError(t, err)
+	assert.Equal(t, keyA, keyB)
+	assert.Equal(t, []string{"b", "a"}, a.MeasurementUUIDs, "the key must not reorder the query itself")
+
+	b.Tags["x"] = "2"
+	keyB, err = queryCacheKey(b)
+	require.NoError(t, err)
+	assert.NotEqual(t, keyA, keyB)
+}
+
+func TestQueryCacheEviction(t *testing.T) {
+	t.Parallel()
+
+	cache := newQueryCache(10)
+	cache.set("a", [][]byte{[]byte("12345")})
+	cache.set("b", [][]byte{[]byte("12345")})
+	_, _ = cache.get("a")
+	cache.set("c", [][]byte{[]byte("12345")})
+
+	assert.Contains(t, cache.entries, "a", "recently used entries must be kept")
+	assert.NotContains(t, cache.entries, "b", "the least recently used entry must be evicted")
+	assert.Contains(t, cache.entries, "c")
+	assert.Equal(t, int64(10), cache.usedBytes)
+
+	cache.set("d", [][]byte{[]byte("too large for the budget")})
+	assert.NotContains(t, cache.entries, "d")
+	assert.Nil(t, newQueryCache(0), "a zero budget disables the cache")
+}
+
+func TestMeasurementQueryCache(t *testing.T) {
+	t.Parallel()
+
+	t.Run("past windows are served from the cache", func(t *testing.T) {
+		t.Parallel()
+		srv, queries := newFakeTimeseriesServer(t)
+		apiClient, err := api.NewAPIWithToken(srv.URL, "tok", "org")
+		require.NoError(t, err)
+		ds := &HistorianDataSource{API: apiClient, queryCache: newQueryCache(1 << 20)}
+
+		end := time.Now().Add(-time.Hour).Truncate(time.Second)
+		query := schemas.Query{MeasurementUUIDs: []string{"m1"}, Start: end.Add(-time.Hour), End: &end}
+
+		stats := queryCacheStats{}
+		frames, err := ds.measurementQuery(context.Background(), query, &stats)
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		frames[0].Name = "changed"
+		fetched := len(queries())
+		assert.Equal(t, queryCacheStats{misses: fetched}, stats)
+
+		frames, err = ds.measurementQuery(context.Background(), query, &stats)
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		assert.Empty(t, frames[0].Name, "hits must not share frames with earlier callers")
+		assert.Equal(t, queryCacheStats{hits: fetched, misses: fetched}, stats)
+		assert.Len(t, queries(), fetched)
+	})
+
+	t.Run("a sliding time range hits the same chunks", func(t *testing.T) {
+		t.Parallel()
+		srv, queries := newFakeTimeseriesServer(t)
+		apiClient, err := api.NewAPIWithToken(srv.URL, "tok", "org")
+		require.NoError(t, err)
+		ds := &HistorianDataSource{API: apiClient, queryCache: newQueryCache(1 << 20)}
+
+		// The start is a minute past a chunk boundary, so sliding it does not cross one
+		end := time.Now()
+		query := schemas.Query{MeasurementUUIDs: []string{"m1"}, Start: end.Add(-time.Hour).Truncate(10 * time.Minute).Add(time.Minute), End: &end}
+
+		stats := queryCacheStats{}
+		_, err = ds.measurementQuery(context.Background(), query, &stats)
+		require.NoError(t, err)
+		chunks := stats.misses
+		require.Positive(t, chunks)
+		received := queries()
+		require.Len(t, received, chunks+2, "the head and the open tail bypass the cache")
+		for _, piece := range received {
+			if !piece.Start.Equal(query.Start) {
+				assert.True(t, piece.Start.Equal(piece.Start.Truncate(10*time.Minute)), "chunks are aligned on their span")
+			}
+		}
+
+		query.Start = query.Start.Add(10 * time.Second)
+		query.End = new(end.Add(10 * time.Second))
+		_, err = ds.measurementQuery(context.Background(), query, &stats)
+		require.NoError(t, err)
+		assert.Equal(t, queryCacheStats{hits: chunks, misses: chunks}, stats)
+		assert.Len(t, queries(), len(received)+2, "only the head and the tail are fetched again")
+	})
+
+	t.Run("points on a chunk boundary are returned once", func(t *testing.T) {
+		t.Parallel()
+		srv, queries := newFakeTimeseriesServer(t)
+		apiClient, err := api.NewAPIWithToken(srv.URL, "tok", "org")
+		require.NoError(t, err)
+		ds := &HistorianDataSource{API: apiClient, queryCache: newQueryCache(1 << 20)}
+
+		end := time.Now().Add(-time.Hour).Truncate(time.Hour)
+		query := schemas.Query{MeasurementUUIDs: []string{"m1"}, Start: end.Add(-time.Hour), End: &end}
+
+		// An hour is split in chunks of 10 minutes
+		expected := []time.Time{}
+		for timestamp := query.Start; !timestamp.After(end); timestamp = timestamp.Add(10 * time.Minute) {
+			expected = append(expected, timestamp.UTC())
+		}
+		for range 2 {
+			frames, err := ds.measurementQuery(context.Background(), query, &queryCacheStats{})
+			require.NoError(t, err)
+			assert.Equal(t, expected, frameTimes(t, frames), "every boundary point once, in order")
+		}
+		assert.Len(t, queries(), len(expected), "six chunks and the tail")
+	})
+
+	t.Run("the open tail is always fetched", func(t *testing.T) {
+		t.Parallel()
+		srv, queries := newFakeTimeseriesServer(t)
+		apiClient, err := api.NewAPIWithToken(srv.URL, "tok", "org")
+		require.NoError(t, err)
+		ds := &HistorianDataSource{API: apiClient, queryCache: newQueryCache(1 << 20)}
+
+		end := time.Now().Add(-2 * time.Minute).Truncate(time.Minute).Add(2 * time.Minute)
+		query := schemas.Query{MeasurementUUIDs: []string{"m1"}, Start: end.Add(-4 * time.Minute), End: &end}
+
+		stats := queryCacheStats{}
+		for range 2 {
+			frames, err := ds.measurementQuery(context.Background(), query, &stats)
+			require.NoError(t, err)
+			timestamps := frameTimes(t, frames)
+			assert.Equal(t, query.Start.UTC(), timestamps[0])
+			assert.Equal(t, end.UTC(), timestamps[len(timestamps)-1], "the cached and tail rows must be merged")
+		}
+
+		assert.Positive(t, stats.hits)
+		assert.True(t, slices.ContainsFunc(queries(), func(piece schemas.Query) bool {
+			return piece.End != nil && piece.End.Equal(end)
+		}), "the tail runs up to the end of the query")
+	})
+
+	t.Run("limited queries over the tail bypass the cache", func(t *testing.T) {
+		t.Parallel()
+		srv, queries := newFakeTimeseriesServer(t)
+		apiClient, err := api.NewAPIWithToken(srv.URL, "tok", "org")
+		require.NoError(t, err)
+		ds := &HistorianDataSource{API: apiClient, queryCache: newQueryCache(1 << 20)}
+
+		end := time.Now()
+		query := schemas.Query{MeasurementUUIDs: []string{"m1"}, Start: end.Add(-time.Hour), End: &end, Limit: 10}
+
+		stats := queryCacheStats{}
+		_, err = ds.measurementQuery(context.Background(), query, &stats)
+		require.NoError(t, err)
+		assert.Equal(t, queryCacheStats{}, stats)
+		assert.Len(t, queries(), 1)
+	})
+
+	t.Run("chunked aggregations match the uncached result", func(t *testing.T) {
+		t.Parallel()
+
+		// The range starts in the middle of a window and spans several chunks
+		end := time.Now().Add(-3 * time.Hour).Truncate(time.Minute)
+		start := end.Add(-30 * time.Hour).Add(3 * time.Minute)
+		testCases := []struct {
+			period  string
+			chunked bool
+		}{
+			{period: "10m", chunked: true},
+			{period: "1h30m", chunked: true},
+			{period: "7m"},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.period, func(t *testing.T) {
+				t.Parallel()
+				srv, queries := newFakeAggregatingServer(t)
+				apiClient, err := api.NewAPIWithToken(srv.URL, "tok", "org")
+				require.NoError(t, err)
+				query := schemas.Query{MeasurementUUIDs: []string{"m1"}, Start: start, End: &end, Aggregation: &schemas.Aggregation{Name: schemas.Sum, Period: tc.period}}
+
+				uncached, err := (&HistorianDataSource{API: apiClient}).measurementQuery(context.Background(), query, &queryCacheStats{})
+				require.NoError(t, err)
+				require.Equal(t, 1, queries())
+
+				cached, err := (&HistorianDataSource{API: apiClient, queryCache: newQueryCache(1 << 20)}).measurementQuery(context.Background(), query, &queryCacheStats{})
+				require.NoError(t, err)
+				if tc.chunked {
+					assert.Greater(t, queries(), 2, "the range is split in chunks")
+				} else {
+					assert.Equal(t, 2, queries(), "periods that do not divide a day are not split")
+				}
+
+				assert.Equal(t, frameTimes(t, uncached), frameTimes(t, cached))
+				uncachedValues, _ := uncached[0].FieldByName(valueFieldName)
+				cachedValues, _ := cached[0].FieldByName(valueFieldName)
+				require.NotNil(t, uncachedValues)
+				require.NotNil(t, cachedValues)
+				for i := range uncachedValues.Len() {
+					assert.Equal(t, uncachedValues.At(i), cachedValues.At(i), "window %d", i)
+				}
+			})
+		}
+	})
+}
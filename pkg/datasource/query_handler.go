@@ -4,6 +4,7 @@ import (
 	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"maps"
 	"net/url"
@@ -12,12 +13,15 @@ import (
 	"strings"
 	"time"
 
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/api"
 	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
 	"github.com/factrylabs/factry-historian-datasource.git/pkg/util"
 	"github.com/google/uuid"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/grafana/grafana-plugin-sdk-go/experimental/concurrent"
+	"golang.org/x/sync/errgroup"
 )
 
 // QueryTypes are a list of query types
@@ -28,6 +32,9 @@ const (
 	QueryTypeEvent = "EventQuery"
 )
 
+// lastKnownPointConcurrency is the maximum number of last known point queries that run at the same time for a query
+const lastKnownPointConcurrency = 10
+
 // Query is a struct which holds the query
 type Query struct {
 	HistorianInfo *schemas.HistorianInfo `json:"historianInfo,omitempty"`
@@ -42,7 +49,25 @@ func (ds *HistorianDataSource) QueryData(ctx context.Context, req *backend.Query
 	}, 10)
 }
 
+// queryData runs a single query and sets the status and source of a failed query. The panel gets a
+// concise message, the full historian response is logged.
 func (ds *HistorianDataSource) queryData(ctx context.Context, backendQuery backend.DataQuery) backend.DataResponse {
+	response := ds.runQuery(ctx, backendQuery)
+	if response.Error == nil {
+		return response
+	}
+
+	response.Status, response.ErrorSource = errorStatus(response.Error)
+	logArgs := []interface{}{"refId", backendQuery.RefID, "queryType", backendQuery.QueryType, "status", response.Status, "source", response.ErrorSource, "error", response.Error}
+	var httpError *api.HTTPError
+	if errors.As(response.Error, &httpError) {
+		logArgs = append(logArgs, "body", httpError.Body)
+	}
+	log.DefaultLogger.Error("Query failed", logArgs...)
+	return response
+}
+
+func (ds *HistorianDataSource) runQuery(ctx context.Context, backendQuery backend.DataQuery) backend.DataResponse {
 	response := backend.DataResponse{}
 	query := Query{}
 	if err := json.Unmarshal(backendQuery.JSON, &query); err != nil {
@@ -162,7 +187,40 @@ func findDisplayNameFromDS(frame *data.Frame) string {
 }
 
 func (ds *HistorianDataSource) handleAssetMeasurementQuery(ctx context.Context, assetMeasurementQuery schemas.AssetMeasurementQuery, timeRange backend.TimeRange, interval time.Duration, seriesLimit int, historianInfo *schemas.HistorianInfo) (data.Frames, error) {
-	assets, err := ds.API.GetFilteredAssets(ctx, assetMeasurementQuery.Assets, historianInfo)
+	selection, err := ds.resolveAssetMeasurementQuery(ctx, assetMeasurementQuery, seriesLimit, historianInfo)
+	if err != nil || selection == nil {
+		return nil, err
+	}
+
+	frames, err := ds.handleQuery(ctx, historianQuery(selection.measurementQuery, timeRange, interval), selection.measurementQuery.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	frames = selection.setFrameNames(frames)
+	return formatFrames(sortByStatus(frames), selection.measurementQuery.Options)
+}
+
+// assetMeasurementSelection holds the measurements an asset measurement query resolved to
+type assetMeasurementSelection struct {
+	measurementQuery schemas.MeasurementQuery
+	assets           map[uuid.UUID]schemas.Asset
+	properties       []schemas.AssetProperty
+}
+
+// setFrameNames names the frames after the asset properties they belong to
+func (s *assetMeasurementSelection) setFrameNames(frames data.Frames) data.Frames {
+	frames = setAssetFrameNames(frames, s.assets, s.properties, s.measurementQuery.Options)
+	if s.measurementQuery.Options.MetadataAsLabels {
+		setFieldLabels(frames)
+	}
+	return frames
+}
+
+// resolveAssetMeasurementQuery looks up the assets and asset properties of the query, returns nil when nothing matches
+func (ds *HistorianDataSource) resolveAssetMeasurementQuery(ctx context.Context, assetMeasurementQuery schemas.AssetMeasurementQuery, seriesLimit int, historianInfo *schemas.HistorianInfo) (*assetMeasurementSelection, error) {
+	hierarchyOptions := api.AssetHierarchyOptions{Recursive: assetMeasurementQuery.Recursive, MaxDepth: assetMeasurementQuery.MaxDepth}
+	assets, err := ds.API.GetFilteredAssetsWithDescendants(ctx, assetMeasurementQuery.Assets, hierarchyOptions, historianInfo)
 	if err != nil {
 		return nil, err
 	}
@@ -220,21 +278,14 @@ assetLoop:
 		return nil, nil
 	}
 
-	measurementQuery := schemas.MeasurementQuery{
-		Measurements: slices.Collect(maps.Keys(measurementUUIDs)),
-		Options:      assetMeasurementQuery.Options,
-	}
-
-	frames, err := ds.handleQuery(ctx, historianQuery(measurementQuery, timeRange, interval), measurementQuery.Options)
-	if err != nil {
-		return nil, err
-	}
-
-	frames = setAssetFrameNames(frames, assets, measurementIndexToPropertyMap, measurementQuery.Options)
-	if measurementQuery.Options.MetadataAsLabels {
-		setFieldLabels(frames)
-	}
-	return applyFrameFormat(sortByStatus(frames), measurementQuery.Options.FrameFormat), nil
+	return &assetMeasurementSelection{
+		measurementQuery: schemas.MeasurementQuery{
+			Measurements: slices.Collect(maps.Keys(measurementUUIDs)),
+			Options:      assetMeasurementQuery.Options,
+		},
+		assets:     assets,
+		properties: measurementIndexToPropertyMap,
+	}, nil
 }
 
 func (ds *HistorianDataSource) getMeasurements(ctx context.Context, measurementQuery schemas.MeasurementQuery, seriesLimit int) ([]string, error) {
@@ -298,23 +349,32 @@ func (ds *HistorianDataSource) handleMeasurementQuery(ctx context.Context, measu
 	if measurementQuery.Options.MetadataAsLabels {
 		setFieldLabels(frames)
 	}
-	return applyFrameFormat(sortByStatus(frames), measurementQuery.Options.FrameFormat), nil
-}
 
-func (ds *HistorianDataSource) handleQuery(ctx context.Context, query schemas.Query, options schemas.MeasurementQueryOptions) (data.Frames, error) {
-	// Remove empty tags
-	for key, value := range query.Tags {
-		if value == "" {
-			delete(query.Tags, key)
+	if calculation := measurementQuery.Options.Calculation; calculation != nil && calculation.Expression != "" {
+		frames, err = calculateFrames(frames, *calculation, measurementQuery.Options.Aggregation)
+		if err != nil {
+			return nil, err
 		}
 	}
+	return formatFrames(sortByStatus(frames), measurementQuery.Options)
+}
+
+func (ds *HistorianDataSource) handleQuery(ctx context.Context, query schemas.Query, options schemas.MeasurementQueryOptions) (data.Frames, error) {
+	// Remove empty tags, the tags are cloned as the options can be shared by concurrent queries
+	query.Tags = maps.Clone(query.Tags)
+	maps.DeleteFunc(query.Tags, func(_ string, value string) bool {
+		return value == ""
+	})
 
-	result, err := ds.API.MeasurementQuery(ctx, query)
+	cacheStats := queryCacheStats{}
+	result, aggregatedLocally, err := ds.aggregatedMeasurementQuery(ctx, query, &cacheStats)
 	if err != nil {
 		return nil, err
 	}
 
-	if options.IncludeLastKnownPoint || options.FillInitialEmptyValues {
+	// Locally computed aggregations already carry the value from before the start into their first period, merging the
+	// raw last known point would add a raw value to the aggregated frames
+	if (options.IncludeLastKnownPoint || options.FillInitialEmptyValues) && !aggregatedLocally {
 		lastPointQuery := query
 		start := query.Start
 		lastPointQuery.End = &start
@@ -330,19 +390,15 @@ func (ds *HistorianDataSource) handleQuery(ctx context.Context, query schemas.Qu
 			lastPointQuery.Tags["status"] = "Good"
 
 			// If unfiltered query last point for each resulting data frame
-			for _, frame := range result {
-				getLastQueryForFrame := getLastQueryForFrame(frame, query)
-				lastResult, err := ds.API.MeasurementQuery(ctx, getLastQueryForFrame)
-				if err != nil {
-					return nil, err
-				}
-
-				lastKnowPointResults = append(lastKnowPointResults, lastResult...)
+			lastResults, err := ds.lastKnownPointsForFrames(ctx, result, query, &cacheStats)
+			if err != nil {
+				return nil, err
 			}
+			lastKnowPointResults = append(lastKnowPointResults, lastResults...)
 		}
 
 		// OtherFrames
-		lastResult, err := ds.API.MeasurementQuery(ctx, lastPointQuery)
+		lastResult, err := ds.measurementQuery(ctx, lastPointQuery, &cacheStats)
 		if err != nil {
 			return nil, err
 		}
@@ -389,59 +445,148 @@ func (ds *HistorianDataSource) handleQuery(ctx context.Context, query schemas.Qu
 		}
 	}
 
+	addQueryCacheStats(result, cacheStats)
 	return addMetaData(result, options.UseEngineeringSpecs), nil
 }
 
-func getLastQueryForFrame(frame *data.Frame, q schemas.Query) schemas.Query {
-	lastQuery := q
-	start := q.Start
-	lastQuery.MeasurementUUIDs = []string{getMeasurementUUIDFromFrame(frame)}
-	lastQuery.Measurements = nil
-	lastQuery.End = &start
-	lastQuery.Start = time.Time{}.Add(time.Millisecond)
-	lastQuery.Aggregation = &schemas.Aggregation{
-		Name: "last",
+// lastKnownPointsForFrames queries the last point before the start of the query for every frame. When the frames are
+// only split by the group by of the query, the last points of all frames are requested in a single query grouped the
+// same way, as the historian already does for the last known point query with the status filter. Otherwise every frame
+// gets its own query, with a limited number of queries running at the same time. The results keep the order of the
+// frames.
+func (ds *HistorianDataSource) lastKnownPointsForFrames(ctx context.Context, frames data.Frames, query schemas.Query, cacheStats *queryCacheStats) (data.Frames, error) {
+	if len(frames) == 0 {
+		return nil, nil
 	}
 
-	lastQuery.Tags = make(map[string]string)
-	labels := getLabelsFromFrame(frame)
+	if framesGroupedBy(frames, query.GroupBy) {
+		return ds.groupedLastKnownPoints(ctx, frames, query, cacheStats)
+	}
 
-	for label, value := range labels {
-		lastQuery.Tags[label] = fmt.Sprintf("%v", value)
+	results := make([]data.Frames, len(frames))
+	stats := make([]queryCacheStats, len(frames))
+	errGroup, groupCtx := errgroup.WithContext(ctx)
+	errGroup.SetLimit(lastKnownPointConcurrency)
+	for i, frame := range frames {
+		lastQuery := getLastQueryForFrame(frame, query)
+		errGroup.Go(func() error {
+			lastResult, err := ds.measurementQuery(groupCtx, lastQuery, &stats[i])
+			if err != nil {
+				return err
+			}
+
+			results[i] = lastResult
+			return nil
+		})
 	}
 
-	return lastQuery
+	if err := errGroup.Wait(); err != nil {
+		return nil, err
+	}
+
+	lastKnownPoints := data.Frames{}
+	for i := range results {
+		lastKnownPoints = append(lastKnownPoints, results[i]...)
+		cacheStats.hits += stats[i].hits
+		cacheStats.misses += stats[i].misses
+	}
+
+	return lastKnownPoints, nil
 }
 
-func (ds *HistorianDataSource) handleRawQuery(ctx context.Context, rawQuery schemas.RawQuery, timeRange backend.TimeRange, interval time.Duration) (data.Frames, error) {
-	if rawQuery.Query == "" || rawQuery.TimeseriesDatabase == "" {
-		return nil, nil
+// framesGroupedBy returns whether the labels of the frames are all tags of the group by, so a query with the same
+// group by returns the same series
+func framesGroupedBy(frames data.Frames, groupBy []string) bool {
+	for _, frame := range frames {
+		for label := range getLabelsFromFrame(frame) {
+			if !slices.Contains(groupBy, label) {
+				return false
+			}
+		}
 	}
+	return true
+}
 
-	rawQuery.Query = fillQueryVariables(rawQuery.Query, "Influx", timeRange, interval)
+// groupedLastKnownPoints queries the last point before the start of the query for all frames at once, grouped by the
+// group by of the query, and returns the points of the frames in the order of the frames with the labels of the frames
+func (ds *HistorianDataSource) groupedLastKnownPoints(ctx context.Context, frames data.Frames, query schemas.Query, cacheStats *queryCacheStats) (data.Frames, error) {
+	measurementUUIDs := []string{}
+	for _, frame := range frames {
+		if measurementUUID := getMeasurementUUIDFromFrame(frame); !slices.Contains(measurementUUIDs, measurementUUID) {
+			measurementUUIDs = append(measurementUUIDs, measurementUUID)
+		}
+	}
 
-	result, err := ds.API.RawQuery(ctx, rawQuery.TimeseriesDatabase, schemas.RawQuery{Query: rawQuery.Query, Format: schemas.ArrowFormat})
+	lastQuery := getLastQueryForFrame(frames[0], query)
+	lastQuery.MeasurementUUIDs = measurementUUIDs
+	lastQuery.Tags = query.Tags
+	lastResult, err := ds.measurementQuery(ctx, lastQuery, cacheStats)
 	if err != nil {
 		return nil, err
 	}
 
-	setRawFrameNames(result)
-	return result, nil
+	lastByFrame := make(map[string]*data.Frame, len(lastResult))
+	for _, frame := range lastResult {
+		lastByFrame[lastKnownPointKey(frame, query.GroupBy)] = frame
+	}
+
+	lastKnownPoints := data.Frames{}
+	for _, frame := range frames {
+		lastFrame, ok := lastByFrame[lastKnownPointKey(frame, query.GroupBy)]
+		if !ok {
+			continue
+		}
+
+		// The point gets the labels of the frame, so it merges into the frame whatever labels the historian returns
+		frameLabels := getLabelsFromFrame(frame)
+		for label := range getLabelsFromFrame(lastFrame) {
+			if _, ok := frameLabels[label]; !ok {
+				lastFrame = frameWithLabel(lastFrame, label, nil)
+			}
+		}
+		for label, value := range frameLabels {
+			lastFrame = frameWithLabel(lastFrame, label, value)
+		}
+		lastKnownPoints = append(lastKnownPoints, lastFrame)
+	}
+	return lastKnownPoints, nil
 }
 
-func fillQueryVariables(query string, databaseType string, timeRange backend.TimeRange, interval time.Duration) string {
-	timeFilter := ""
-	intervalStr := ""
+// lastKnownPointKey identifies the series of a frame by its measurement and the non-empty labels of the group by tags,
+// a series without a tag can have an empty label or none
+func lastKnownPointKey(frame *data.Frame, groupBy []string) string {
+	labels := []string{}
+	for label, value := range getLabelsFromFrame(frame) {
+		if !slices.Contains(groupBy, label) {
+			continue
+		}
+		if value := fmt.Sprint(value); value != "" && value != "<nil>" {
+			labels = append(labels, label+"="+value)
+		}
+	}
+	slices.Sort(labels)
+	return getMeasurementUUIDFromFrame(frame) + "{" + strings.Join(labels, ",") + "}"
+}
 
-	if databaseType == "Influx" {
-		timeFilter = fmt.Sprintf("time >= %vns AND time < %vns", timeRange.From.UnixNano(), timeRange.To.UnixNano())
-		intervalNano := interval.Nanoseconds()
-		intervalStr = fmt.Sprintf("TIME(%vns, %vns)", intervalNano, timeRange.From.UnixNano()%intervalNano)
+func getLastQueryForFrame(frame *data.Frame, q schemas.Query) schemas.Query {
+	lastQuery := q
+	start := q.Start
+	lastQuery.MeasurementUUIDs = []string{getMeasurementUUIDFromFrame(frame)}
+	lastQuery.Measurements = nil
+	lastQuery.End = &start
+	lastQuery.Start = time.Time{}.Add(time.Millisecond)
+	lastQuery.Aggregation = &schemas.Aggregation{
+		Name: "last",
+	}
+
+	lastQuery.Tags = make(map[string]string)
+	labels := getLabelsFromFrame(frame)
+
+	for label, value := range labels {
+		lastQuery.Tags[label] = fmt.Sprintf("%v", value)
 	}
 
-	query = strings.ReplaceAll(query, "$timeFilter", timeFilter)
-	query = strings.ReplaceAll(query, "$__interval", intervalStr)
-	return query
+	return lastQuery
 }
 
 func historianQuery(query schemas.MeasurementQuery, timeRange backend.TimeRange, interval time.Duration) schemas.Query {
@@ -0,0 +1,271 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/api"
+	arrow_pb "github.com/factrylabs/factry-historian-datasource.git/pkg/proto"
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHandleQuery_LastKnownPointsConcurrently(t *testing.T) {
+	t.Parallel()
+
+	const series = 30
+	var inFlight, maxInFlight atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := schemas.Query{}
+		if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+			t.Errorf("decoding query: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// The frames carry a label the query does not group by, so every frame needs its own last known point query
+		frames := data.Frames{}
+		switch {
+		case query.Aggregation == nil || query.Aggregation.Name != "last":
+			for i := range series {
+				frames = append(frames, labeledFrame(seriesFrame(fmt.Sprintf("m%d", i), query.Start, float64(i)), map[string]interface{}{"unit": "C"}))
+			}
+		case len(query.MeasurementUUIDs) == 1 && query.Tags["unit"] == "C":
+			current := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				highest := maxInFlight.Load()
+				if current <= highest || maxInFlight.CompareAndSwap(highest, current) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			frames = append(frames, labeledFrame(seriesFrame(query.MeasurementUUIDs[0], query.End.Add(-time.Minute), -1), map[string]interface{}{"unit": "C"}))
+		}
+
+		writeFrames(t, w, frames)
+	}))
+	t.Cleanup(srv.Close)
+
+	apiClient, err := api.NewAPIWithToken(srv.URL, "tok", "org")
+	require.NoError(t, err)
+	ds := &HistorianDataSource{API: apiClient}
+
+	measurements := make([]string, series)
+	for i := range measurements {
+		measurements[i] = fmt.Sprintf("m%d", i)
+	}
+	end := time.Date(2026, 1, 1, 1, 0, 0, 0, time.UTC)
+	query := schemas.Query{MeasurementUUIDs: measurements, Start: end.Add(-time.Hour), End: &end}
+
+	frames, err := ds.handleQuery(context.Background(), query, schemas.MeasurementQueryOptions{IncludeLastKnownPoint: true})
+	require.NoError(t, err)
+	require.Len(t, frames, series)
+	seen := map[string]struct{}{}
+	for _, frame := range frames {
+		seen[getMeasurementUUIDFromFrame(frame)] = struct{}{}
+		require.Equal(t, 2, frame.Rows(), "the last known point must be merged into the frame")
+		assert.Equal(t, -1.0, *frame.Fields[1].At(0).(*float64))
+	}
+	assert.Len(t, seen, series)
+	assert.Greater(t, maxInFlight.Load(), int32(1), "last known points must be queried concurrently")
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(lastKnownPointConcurrency))
+}
+
+func TestHandleQuery_GroupedLastKnownPoints(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var lastQueries []schemas.Query
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := schemas.Query{}
+		if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+			t.Errorf("decoding query: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if query.Aggregation == nil {
+			writeFrames(t, w, data.Frames{
+				labeledFrame(seriesFrame("m1", start, 1), map[string]interface{}{"line": "a"}),
+				labeledFrame(seriesFrame("m1", start, 2), map[string]interface{}{"line": "b"}),
+				seriesFrame("m2", start, 3),
+			})
+			return
+		}
+
+		mu.Lock()
+		lastQueries = append(lastQueries, query)
+		mu.Unlock()
+		if len(query.Tags) > 0 {
+			writeFrames(t, w, data.Frames{})
+			return
+		}
+		// The grouped query also returns a group the query result does not have, an empty label for a series without the
+		// tag and a label the query does not group by
+		writeFrames(t, w, data.Frames{
+			labeledFrame(seriesFrame("m2", start.Add(-time.Minute), -3), map[string]interface{}{"line": ""}),
+			labeledFrame(seriesFrame("m1", start.Add(-time.Minute), -2), map[string]interface{}{"line": "b", "unit": "C"}),
+			labeledFrame(seriesFrame("m1", start.Add(-time.Minute), -4), map[string]interface{}{"line": "c"}),
+			labeledFrame(seriesFrame("m1", start.Add(-time.Minute), -1), map[string]interface{}{"line": "a"}),
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	apiClient, err := api.NewAPIWithToken(srv.URL, "tok", "org")
+	require.NoError(t, err)
+	ds := &HistorianDataSource{API: apiClient}
+
+	end := start.Add(time.Hour)
+	query := schemas.Query{MeasurementUUIDs: []string{"m1", "m2"}, Start: start, End: &end, GroupBy: []string{"line"}}
+	frames, err := ds.handleQuery(context.Background(), query, schemas.MeasurementQueryOptions{IncludeLastKnownPoint: true})
+	require.NoError(t, err)
+
+	require.Len(t, lastQueries, 2, "one grouped query for the frames and one for the other series")
+	grouped := lastQueries[0]
+	if len(grouped.Tags) > 0 {
+		grouped = lastQueries[1]
+	}
+	assert.ElementsMatch(t, []string{"m1", "m2"}, grouped.MeasurementUUIDs)
+	assert.Equal(t, []string{"line"}, grouped.GroupBy)
+	assert.Empty(t, grouped.Tags)
+	assert.Equal(t, schemas.Last, grouped.Aggregation.Name)
+
+	require.Len(t, frames, 3)
+	lastValues := map[string]float64{}
+	for _, frame := range frames {
+		require.Equal(t, 2, frame.Rows(), "the last known point must be merged into the frame")
+		lastValues[getFrameID(frame)] = *frame.Fields[1].At(0).(*float64)
+	}
+	assert.Equal(t, map[string]float64{
+		getFrameID(labeledFrame(seriesFrame("m1", start, 0), map[string]interface{}{"line": "a"})): -1,
+		getFrameID(labeledFrame(seriesFrame("m1", start, 0), map[string]interface{}{"line": "b"})): -2,
+		getFrameID(seriesFrame("m2", start, 0)):                                                    -3,
+	}, lastValues)
+}
+
+func TestHandleQuery_LastKnownPointLocalAggregation(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		aggregation schemas.Aggregation
+		lastKnown   *data.Frame
+		raw         *data.Frame
+	}{
+		{
+			name:        "percent good",
+			aggregation: schemas.Aggregation{Name: schemas.PercentGood, Period: "10s"},
+			lastKnown:   makeStepSeries(t, []int64{-5}, []*float64{new(1.0)}, "Good"),
+			raw:         makeStepSeries(t, []int64{4, 12}, []*float64{new(2.0), new(3.0)}, "Good"),
+		},
+		{
+			name:        "state duration",
+			aggregation: schemas.Aggregation{Name: schemas.StateDuration, Period: "10s"},
+			lastKnown:   makeStepSeries(t, []int64{-5}, []string{"Running"}, "Good"),
+			raw:         makeStepSeries(t, []int64{4, 12, 14}, []string{"Stopped", "Running", "Stopped"}, "Good"),
+		},
+		{
+			name:        "state count",
+			aggregation: schemas.Aggregation{Name: schemas.StateCount, Period: "10s"},
+			lastKnown:   makeStepSeries(t, []int64{-5}, []string{"Running"}, "Good"),
+			raw:         makeStepSeries(t, []int64{4, 12, 14}, []string{"Stopped", "Running", "Stopped"}, "Good"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			responses := map[bool][]byte{}
+			for last, frame := range map[bool]*data.Frame{true: tc.lastKnown, false: tc.raw} {
+				encoded, err := data.Frames{frame}.MarshalArrow()
+				require.NoError(t, err)
+				responses[last], err = proto.Marshal(&arrow_pb.DataResponse{Frames: encoded})
+				require.NoError(t, err)
+			}
+
+			var lastQueries atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query := schemas.Query{}
+				if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+					t.Errorf("decoding query: %v", err)
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				if query.Aggregation != nil && query.Aggregation.Name != schemas.Last {
+					t.Errorf("the historian must not be asked for %s", query.Aggregation.Name)
+				}
+				if _, ok := query.Tags["state"]; ok {
+					t.Errorf("the synthetic state label must not become a tag filter: %v", query.Tags)
+				}
+
+				last := query.Aggregation != nil
+				if last {
+					lastQueries.Add(1)
+				}
+				_, _ = w.Write(responses[last])
+			}))
+			t.Cleanup(srv.Close)
+
+			apiClient, err := api.NewAPIWithToken(srv.URL, "tok", "org")
+			require.NoError(t, err)
+			ds := &HistorianDataSource{API: apiClient}
+
+			start, end := time.Unix(0, 0), time.Unix(20, 0)
+			query := schemas.Query{MeasurementUUIDs: []string{"uuid-123"}, Start: start, End: &end, Aggregation: &tc.aggregation}
+			frames, err := ds.handleQuery(context.Background(), query, schemas.MeasurementQueryOptions{IncludeLastKnownPoint: true, FillInitialEmptyValues: true})
+			require.NoError(t, err)
+			require.NotEmpty(t, frames)
+			assert.Equal(t, int32(1), lastQueries.Load(), "only the local aggregation queries the last known point")
+			for _, frame := range frames {
+				require.Equal(t, 2, frame.Rows(), "no raw last known point may be merged into the aggregated frame")
+				assert.Equal(t, start, frame.Fields[0].At(0))
+				assert.Equal(t, data.FieldTypeNullableFloat64, frame.Fields[1].Type())
+			}
+		})
+	}
+}
+
+func writeFrames(t *testing.T, w http.ResponseWriter, frames data.Frames) {
+	encoded, err := frames.MarshalArrow()
+	if err != nil {
+		t.Errorf("encoding frames: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body, err := proto.Marshal(&arrow_pb.DataResponse{Frames: encoded})
+	if err != nil {
+		t.Errorf("encoding response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(body)
+}
+
+// labeledFrame sets the labels of a frame made by seriesFrame
+func labeledFrame(frame *data.Frame, labels map[string]interface{}) *data.Frame {
+	frame.Meta.Custom.(map[string]interface{})["Labels"] = labels
+	return frame
+}
+
+func seriesFrame(measurementUUID string, timestamp time.Time, value float64) *data.Frame {
+	frame := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{timestamp}),
+		data.NewField(valueFieldName, nil, []*float64{&value}),
+	)
+	frame.Meta = &data.FrameMeta{Custom: map[string]interface{}{"MeasurementUUID": measurementUUID}}
+	return frame
+}
@@ -0,0 +1,229 @@
+package datasource
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// timeGroupMacro matches $__timeGroup(column) and $__timeGroup(column, interval)
+var timeGroupMacro = regexp.MustCompile(`\$__timeGroup\(\s*([^,()]+?)\s*(?:,\s*([^()]*?)\s*)?\)`)
+
+// timeFilterMacro matches $timeFilter, $__timeFilter and $__timeFilter(column)
+var timeFilterMacro = regexp.MustCompile(`\$(?:__)?timeFilter(?:\(\s*([^,()]*?)\s*\))?`)
+
+// rawQueryDialect renders the raw query macros in the query language of a time series database
+type rawQueryDialect interface {
+	// timeFilter renders $timeFilter and $__timeFilter(column)
+	timeFilter(column string, timeRange backend.TimeRange) string
+	// timestamp renders $__timeFrom and $__timeTo
+	timestamp(t time.Time) string
+	// duration renders $__rate_interval
+	duration(d time.Duration) string
+	// interval renders $__interval
+	interval(timeRange backend.TimeRange, interval time.Duration) string
+	// timeGroup renders $__timeGroup(column, interval)
+	timeGroup(column string, timeRange backend.TimeRange, interval time.Duration) string
+}
+
+// influxQLDialect renders macros for InfluxDB 1.x
+type influxQLDialect struct{}
+
+// timeFilter ignores the column, InfluxQL always filters on time
+func (influxQLDialect) timeFilter(_ string, timeRange backend.TimeRange) string {
+	return fmt.Sprintf("time >= %vns AND time < %vns", timeRange.From.UnixNano(), timeRange.To.UnixNano())
+}
+
+func (influxQLDialect) timestamp(t time.Time) string {
+	return fmt.Sprintf("%vns", t.UnixNano())
+}
+
+func (influxQLDialect) duration(d time.Duration) string {
+	return fmt.Sprintf("%vms", d.Milliseconds())
+}
+
+// interval renders a complete group by time clause, aligned on the start of the time range
+func (d influxQLDialect) interval(timeRange backend.TimeRange, interval time.Duration) string {
+	return d.timeGroup("time", timeRange, interval)
+}
+
+// timeGroup ignores the column, InfluxQL always groups on time
+func (influxQLDialect) timeGroup(_ string, timeRange backend.TimeRange, interval time.Duration) string {
+	intervalNano := interval.Nanoseconds()
+	return fmt.Sprintf("TIME(%vns, %vns)", intervalNano, timeRange.From.UnixNano()%intervalNano)
+}
+
+// fluxDialect renders macros for InfluxDB 2.x
+type fluxDialect struct{}
+
+// timeFilter ignores the column, range always filters on _time
+func (d fluxDialect) timeFilter(_ string, timeRange backend.TimeRange) string {
+	return fmt.Sprintf("range(start: %s, stop: %s)", d.timestamp(timeRange.From), d.timestamp(timeRange.To))
+}
+
+func (fluxDialect) timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func (fluxDialect) duration(d time.Duration) string {
+	return fmt.Sprintf("%vms", d.Milliseconds())
+}
+
+func (d fluxDialect) interval(_ backend.TimeRange, interval time.Duration) string {
+	return d.duration(interval)
+}
+
+func (d fluxDialect) timeGroup(column string, _ backend.TimeRange, interval time.Duration) string {
+	return fmt.Sprintf("window(every: %s, timeColumn: %q)", d.duration(interval), column)
+}
+
+// timescaleDialect renders macros for TimescaleDB SQL
+type timescaleDialect struct{}
+
+func (d timescaleDialect) timeFilter(column string, timeRange backend.TimeRange) string {
+	return fmt.Sprintf("%[1]s >= %[2]s AND %[1]s < %[3]s", column, d.timestamp(timeRange.From), d.timestamp(timeRange.To))
+}
+
+func (timescaleDialect) timestamp(t time.Time) string {
+	return fmt.Sprintf("'%s'", t.UTC().Format(time.RFC3339Nano))
+}
+
+func (timescaleDialect) duration(d time.Duration) string {
+	return fmt.Sprintf("'%vms'::interval", d.Milliseconds())
+}
+
+func (d timescaleDialect) interval(_ backend.TimeRange, interval time.Duration) string {
+	return d.duration(interval)
+}
+
+func (d timescaleDialect) timeGroup(column string, _ backend.TimeRange, interval time.Duration) string {
+	return fmt.Sprintf("time_bucket(%s, %s)", d.duration(interval), column)
+}
+
+// rawQueryDialectFor returns the dialect of a time series database type, nil when it has none
+func rawQueryDialectFor(databaseType string) rawQueryDialect {
+	switch strings.ToLower(strings.ReplaceAll(databaseType, " ", "")) {
+	case "influx", "influxdb", "influxdb1", "influxql":
+		return influxQLDialect{}
+	case "influx2", "influxdb2", "flux":
+		return fluxDialect{}
+	case "timescale", "timescaledb", "postgres", "postgresql":
+		return timescaleDialect{}
+	default:
+		return nil
+	}
+}
+
+func (ds *HistorianDataSource) handleRawQuery(ctx context.Context, rawQuery schemas.RawQuery, timeRange backend.TimeRange, interval time.Duration) (data.Frames, error) {
+	if rawQuery.Query == "" || rawQuery.TimeseriesDatabase == "" {
+		return nil, nil
+	}
+
+	databaseType, err := ds.getTimeseriesDatabaseType(ctx, rawQuery.TimeseriesDatabase)
+	if err != nil {
+		return nil, err
+	}
+
+	// Historians that don't report the database type only support InfluxDB
+	dialect := rawQueryDialectFor(cmp.Or(databaseType, "influx"))
+	if dialect == nil {
+		return nil, fmt.Errorf("%w: %s", ErrorMessageUnsupportedDatabaseType, databaseType)
+	}
+
+	rawQuery.Query, err = fillQueryVariables(rawQuery.Query, dialect, timeRange, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := ds.API.RawQuery(ctx, rawQuery.TimeseriesDatabase, schemas.RawQuery{Query: rawQuery.Query, Format: schemas.ArrowFormat})
+	if err != nil {
+		return nil, err
+	}
+
+	setRawFrameNames(result)
+	return result, nil
+}
+
+// getTimeseriesDatabaseType returns the type name of the time series database with the given UUID or name
+func (ds *HistorianDataSource) getTimeseriesDatabaseType(ctx context.Context, timeseriesDatabase string) (string, error) {
+	databases, err := ds.API.GetTimeseriesDatabases(ctx, "")
+	if err != nil {
+		return "", err
+	}
+
+	for _, database := range databases {
+		if database.UUID.String() != timeseriesDatabase && database.Name != timeseriesDatabase {
+			continue
+		}
+		if database.TimeseriesDatabaseType == nil {
+			return "", nil
+		}
+		return database.TimeseriesDatabaseType.Name, nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrorMessageUnknownTimeseriesDatabase, timeseriesDatabase)
+}
+
+// fillQueryVariables expands the Grafana macros in a raw query:
+//
+//	$timeFilter, $__timeFilter  the time range condition on the time column
+//	$__timeFilter(col)          the time range condition on col
+//	$__timeFrom, $__timeTo      the start and end of the time range
+//	$__interval                 the interval, InfluxQL renders a complete group by time clause
+//	$__interval_ms              the interval in milliseconds
+//	$__rate_interval            four times the interval, the smallest safe window for rates
+//	$__timeGroup(col, interval) groups on col per interval, interval defaults to $__interval
+func fillQueryVariables(query string, dialect rawQueryDialect, timeRange backend.TimeRange, interval time.Duration) (string, error) {
+	interval = max(interval, time.Millisecond)
+
+	var timeGroupErr error
+	query = timeGroupMacro.ReplaceAllStringFunc(query, func(macro string) string {
+		arguments := timeGroupMacro.FindStringSubmatch(macro)
+		groupInterval, err := parseMacroInterval(arguments[2], interval)
+		if err != nil {
+			timeGroupErr = err
+			return macro
+		}
+		return dialect.timeGroup(arguments[1], timeRange, groupInterval)
+	})
+	if timeGroupErr != nil {
+		return "", timeGroupErr
+	}
+
+	query = timeFilterMacro.ReplaceAllStringFunc(query, func(macro string) string {
+		column := cmp.Or(timeFilterMacro.FindStringSubmatch(macro)[1], "time")
+		return dialect.timeFilter(column, timeRange)
+	})
+
+	// Longer macros go first, so $__interval does not replace the start of $__interval_ms
+	replacer := strings.NewReplacer(
+		"$__timeFrom", dialect.timestamp(timeRange.From),
+		"$__timeTo", dialect.timestamp(timeRange.To),
+		"$__interval_ms", fmt.Sprint(interval.Milliseconds()),
+		"$__interval", dialect.interval(timeRange, interval),
+		"$__rate_interval", dialect.duration(4*interval),
+	)
+	return replacer.Replace(query), nil
+}
+
+// parseMacroInterval parses the interval argument of a macro, empty, auto and $__interval select the query interval
+func parseMacroInterval(value string, interval time.Duration) (time.Duration, error) {
+	value = strings.Trim(value, `'"`)
+	switch value {
+	case "", "auto", "$__interval":
+		return interval, nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		return 0, fmt.Errorf("%w: %s", ErrorMessageInvalidMacroInterval, value)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,179 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/api"
+	arrow_pb "github.com/factrylabs/factry-historian-datasource.git/pkg/proto"
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/google/uuid"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFillQueryVariables(t *testing.T) {
+	t.Parallel()
+
+	timeRange := backend.TimeRange{
+		From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC),
+	}
+
+	testCases := []struct {
+		name     string
+		dialect  rawQueryDialect
+		query    string
+		expected string
+	}{
+		{
+			name:     "InfluxQL time filter and interval",
+			dialect:  influxQLDialect{},
+			query:    `SELECT mean("value") FROM "m" WHERE $timeFilter GROUP BY $__interval`,
+			expected: `SELECT mean("value") FROM "m" WHERE time >= 1704067200000000000ns AND time < 1704070800000000000ns GROUP BY TIME(60000000000ns, 0ns)`,
+		},
+		{
+			name:     "InfluxQL time bounds and interval in milliseconds",
+			dialect:  influxQLDialect{},
+			query:    `WHERE time >= $__timeFrom AND time < $__timeTo LIMIT $__interval_ms`,
+			expected: `WHERE time >= 1704067200000000000ns AND time < 1704070800000000000ns LIMIT 60000`,
+		},
+		{
+			name:     "InfluxQL rate interval and time group",
+			dialect:  influxQLDialect{},
+			query:    `SELECT non_negative_derivative(mean("value"), $__rate_interval) WHERE $__timeFilter GROUP BY $__timeGroup(time, 5m)`,
+			expected: `SELECT non_negative_derivative(mean("value"), 240000ms) WHERE time >= 1704067200000000000ns AND time < 1704070800000000000ns GROUP BY TIME(300000000000ns, 0ns)`,
+		},
+		{
+			name:     "Flux",
+			dialect:  fluxDialect{},
+			query:    `from(bucket: "b") |> $timeFilter |> $__timeGroup(_time, $__interval) |> mean() |> yield(name: "$__timeFrom $__timeTo $__interval_ms $__rate_interval")`,
+			expected: `from(bucket: "b") |> range(start: 2024-01-01T00:00:00Z, stop: 2024-01-01T01:00:00Z) |> window(every: 60000ms, timeColumn: "_time") |> mean() |> yield(name: "2024-01-01T00:00:00Z 2024-01-01T01:00:00Z 60000 240000ms")`,
+		},
+		{
+			name:     "TimescaleDB",
+			dialect:  timescaleDialect{},
+			query:    `SELECT $__timeGroup(time, '5m') AS bucket, avg(value) FROM points WHERE $__timeFilter AND measurement_uuid IS NOT NULL GROUP BY bucket`,
+			expected: `SELECT time_bucket('300000ms'::interval, time) AS bucket, avg(value) FROM points WHERE time >= '2024-01-01T00:00:00Z' AND time < '2024-01-01T01:00:00Z' AND measurement_uuid IS NOT NULL GROUP BY bucket`,
+		},
+		{
+			name:     "TimescaleDB bounds and intervals",
+			dialect:  timescaleDialect{},
+			query:    `WHERE time BETWEEN $__timeFrom AND $__timeTo GROUP BY time_bucket($__interval, time), $__interval_ms, $__rate_interval`,
+			expected: `WHERE time BETWEEN '2024-01-01T00:00:00Z' AND '2024-01-01T01:00:00Z' GROUP BY time_bucket('60000ms'::interval, time), 60000, '240000ms'::interval`,
+		},
+		{
+			name:     "TimescaleDB time filter on a column",
+			dialect:  timescaleDialect{},
+			query:    `SELECT * FROM points WHERE $__timeFilter(my_ts) AND $__timeFilter( ) ORDER BY my_ts`,
+			expected: `SELECT * FROM points WHERE my_ts >= '2024-01-01T00:00:00Z' AND my_ts < '2024-01-01T01:00:00Z' AND time >= '2024-01-01T00:00:00Z' AND time < '2024-01-01T01:00:00Z' ORDER BY my_ts`,
+		},
+		{
+			name:     "InfluxQL time filter with a column",
+			dialect:  influxQLDialect{},
+			query:    `WHERE $__timeFilter(time)`,
+			expected: `WHERE time >= 1704067200000000000ns AND time < 1704070800000000000ns`,
+		},
+		{
+			name:     "Flux time group without interval",
+			dialect:  fluxDialect{},
+			query:    `|> $__timeGroup(_time) |> aggregateWindow(every: $__interval, fn: mean)`,
+			expected: `|> window(every: 60000ms, timeColumn: "_time") |> aggregateWindow(every: 60000ms, fn: mean)`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			query, err := fillQueryVariables(tc.query, tc.dialect, timeRange, time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, query)
+		})
+	}
+
+	t.Run("invalid time group interval", func(t *testing.T) {
+		t.Parallel()
+		_, err := fillQueryVariables(`GROUP BY $__timeGroup(time, often)`, influxQLDialect{}, timeRange, time.Minute)
+		assert.ErrorIs(t, err, ErrorMessageInvalidMacroInterval)
+	})
+
+	t.Run("zero interval", func(t *testing.T) {
+		t.Parallel()
+		query, err := fillQueryVariables(`$__interval_ms`, influxQLDialect{}, timeRange, 0)
+		require.NoError(t, err)
+		assert.Equal(t, "1", query)
+	})
+}
+
+func TestRawQueryDialectFor(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, influxQLDialect{}, rawQueryDialectFor("Influx"))
+	assert.Equal(t, influxQLDialect{}, rawQueryDialectFor("InfluxDB"))
+	assert.Equal(t, fluxDialect{}, rawQueryDialectFor("InfluxDB 2"))
+	assert.Equal(t, timescaleDialect{}, rawQueryDialectFor("TimescaleDB"))
+	assert.Equal(t, timescaleDialect{}, rawQueryDialectFor("PostgreSQL"))
+	assert.Equal(t, timescaleDialect{}, rawQueryDialectFor("postgres"))
+	assert.Nil(t, rawQueryDialectFor("Unknown"))
+}
+
+func TestHandleRawQuery(t *testing.T) {
+	t.Parallel()
+
+	databases := []schemas.TimeseriesDatabase{
+		{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "timescale"}, TimeseriesDatabaseType: &schemas.TimeseriesDatabaseType{Name: "TimescaleDB"}},
+		{BaseModel: schemas.BaseModel{UUID: uuid.New(), Name: "other"}, TimeseriesDatabaseType: &schemas.TimeseriesDatabaseType{Name: "Graphite"}},
+	}
+
+	var rawQueries []string
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/timeseries-databases" {
+			_ = json.NewEncoder(w).Encode(databases)
+			return
+		}
+
+		rawQuery := schemas.RawQuery{}
+		if err := json.NewDecoder(r.Body).Decode(&rawQuery); err != nil {
+			panic(err)
+		}
+		mu.Lock()
+		rawQueries = append(rawQueries, rawQuery.Query)
+		mu.Unlock()
+
+		body, err := proto.Marshal(&arrow_pb.DataResponse{})
+		if err != nil {
+			panic(err)
+		}
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+
+	apiClient, err := api.NewAPIWithToken(srv.URL, "tok", "org")
+	require.NoError(t, err)
+	ds := &HistorianDataSource{API: apiClient}
+
+	timeRange := backend.TimeRange{
+		From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC),
+	}
+
+	_, err = ds.handleRawQuery(context.Background(), schemas.RawQuery{Query: "SELECT * FROM points WHERE $__timeFilter", TimeseriesDatabase: databases[0].UUID.String()}, timeRange, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"SELECT * FROM points WHERE time >= '2024-01-01T00:00:00Z' AND time < '2024-01-01T01:00:00Z'"}, rawQueries)
+
+	_, err = ds.handleRawQuery(context.Background(), schemas.RawQuery{Query: "SELECT 1", TimeseriesDatabase: databases[1].UUID.String()}, timeRange, time.Minute)
+	assert.ErrorIs(t, err, ErrorMessageUnsupportedDatabaseType)
+	assert.ErrorContains(t, err, "Graphite")
+
+	_, err = ds.handleRawQuery(context.Background(), schemas.RawQuery{Query: "SELECT 1", TimeseriesDatabase: uuid.NewString()}, timeRange, time.Minute)
+	assert.ErrorIs(t, err, ErrorMessageUnknownTimeseriesDatabase)
+	assert.Len(t, rawQueries, 1, "rejected queries must not reach the historian")
+}
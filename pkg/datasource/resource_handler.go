@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/api"
 	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
 	"github.com/google/uuid"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
@@ -36,11 +38,37 @@ func GetResourceQuery(body []byte) (*HistorianResourceQuery, error) {
 	return &query, nil
 }
 
+// noCacheParam is the query parameter with which the query editor asks for metadata that bypasses the
+// metadata cache, to show newly created assets, measurements and event types
+const noCacheParam = "noCache"
+
 // CallResource is used to handle resource calls
 func (ds *HistorianDataSource) CallResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	if withoutCache(req) {
+		ctx = api.WithoutCache(ctx)
+	}
 	return ds.resourceHandler.CallResource(ctx, req, sender)
 }
 
+// withoutCache returns whether the resource call asks to bypass the metadata cache and removes the parameter
+// from the request, so it doesn't end up in the filters sent to the historian
+func withoutCache(req *backend.CallResourceRequest) bool {
+	requestURL, err := url.Parse(req.URL)
+	if err != nil {
+		return false
+	}
+
+	query := requestURL.Query()
+	if query.Get(noCacheParam) != "true" {
+		return false
+	}
+
+	query.Del(noCacheParam)
+	requestURL.RawQuery = query.Encode()
+	req.URL = requestURL.String()
+	return true
+}
+
 func (ds *HistorianDataSource) initializeResourceRoutes() backend.CallResourceHandler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /measurements", handleJSON(ds.handleGetMeasurements))
@@ -69,6 +97,8 @@ func (ds *HistorianDataSource) initializeResourceRoutes() backend.CallResourceHa
 
 	mux.HandleFunc("GET /event-property-values/{uuid}", handleJSON(ds.handleGetEventPropertyValues))
 
+	mux.HandleFunc("POST /cache/flush", handleJSON(ds.handleFlushCache))
+
 	mux.HandleFunc("/", handleJSON(ds.fallBackHandler))
 	return httpadapter.New(mux)
 }
@@ -230,6 +260,11 @@ func (ds *HistorianDataSource) handleGetHistorianInfo(_ http.ResponseWriter, req
 	return ds.API.GetInfo(req.Context())
 }
 
+func (ds *HistorianDataSource) handleFlushCache(_ http.ResponseWriter, _ *http.Request) (interface{}, error) {
+	ds.flushCache()
+	return map[string]string{"message": "cache flushed"}, nil
+}
+
 func (ds *HistorianDataSource) handleGetEventPropertyValues(_ http.ResponseWriter, req *http.Request) (interface{}, error) {
 	eventTypeProperty := req.PathValue("uuid")
 	if eventTypeProperty == "" {
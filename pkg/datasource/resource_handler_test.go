@@ -0,0 +1,59 @@
+package datasource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/api"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallResource_MetadataCache(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		queries []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.RawQuery)
+		mu.Unlock()
+		_, _ = w.Write([]byte(`[{"Name":"a1"}]`))
+	}))
+	t.Cleanup(srv.Close)
+
+	apiClient, err := api.NewAPI(api.Options{URL: srv.URL, MetadataCacheTTL: time.Minute})
+	require.NoError(t, err)
+	ds := &HistorianDataSource{API: apiClient}
+	ds.resourceHandler = ds.initializeResourceRoutes()
+
+	callResource := func(url string) {
+		t.Helper()
+		var status int
+		err := ds.CallResource(context.Background(), &backend.CallResourceRequest{Method: http.MethodGet, Path: "assets", URL: url},
+			backend.CallResourceResponseSenderFunc(func(res *backend.CallResourceResponse) error {
+				status = res.Status
+				return nil
+			}))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, status)
+	}
+
+	callResource("assets?Keyword=Line")
+	callResource("assets?Keyword=Line")
+	mu.Lock()
+	assert.Equal(t, []string{"Keyword=Line"}, queries, "lookups without the flag use the cache")
+	mu.Unlock()
+
+	callResource("assets?Keyword=Line&noCache=true")
+	mu.Lock()
+	assert.Equal(t, []string{"Keyword=Line", "Keyword=Line"}, queries, "the flag bypasses the cache and is not sent to the historian")
+	mu.Unlock()
+}
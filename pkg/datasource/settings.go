@@ -3,19 +3,32 @@ package datasource
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/api"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/httpclient"
 )
 
 // Settings - data loaded from grafana settings database
 type Settings struct {
-	URL                string `json:"url,omitempty"`
-	Token              string `json:"-,omitempty"`
-	Organization       string `json:"organization,omitempty"`
-	Timeout            string `json:"timeout,omitempty"`
-	QueryTimeout       string `json:"queryTimeout,omitempty"`
+	URL              string `json:"url,omitempty"`
+	Token            string `json:"-,omitempty"`
+	Organization     string `json:"organization,omitempty"`
+	Timeout          string `json:"timeout,omitempty"`
+	QueryTimeout     string `json:"queryTimeout,omitempty"`
+	MetadataCacheTTL string `json:"metadataCacheTTL,omitempty"`
+	// QueryCacheSizeMB is the memory budget of the query result cache, 0 disables it
+	QueryCacheSizeMB   int    `json:"queryCacheSizeMB,omitempty"`
 	InsecureSkipVerify bool   `json:"tlsSkipVerify,omitempty"`
+	TLSAuth            bool   `json:"tlsAuth,omitempty"`
+	TLSAuthWithCACert  bool   `json:"tlsAuthWithCACert,omitempty"`
+	ServerName         string `json:"serverName,omitempty"`
+	TLSCACert          string `json:"-"`
+	TLSClientCert      string `json:"-"`
+	TLSClientKey       string `json:"-"`
 }
 
 func (settings *Settings) isValid() (err error) {
@@ -31,9 +44,94 @@ func (settings *Settings) isValid() (err error) {
 		return ErrorMessageNoOrganization
 	}
 
+	if _, err := parseDurationSetting(settings.Timeout); err != nil {
+		return fmt.Errorf("timeout %q: %w", settings.Timeout, ErrorMessageInvalidTimeout)
+	}
+
+	if _, err := parseDurationSetting(settings.QueryTimeout); err != nil {
+		return fmt.Errorf("query timeout %q: %w", settings.QueryTimeout, ErrorMessageInvalidTimeout)
+	}
+
+	if _, err := parseDurationSetting(settings.MetadataCacheTTL); err != nil {
+		return fmt.Errorf("metadata cache TTL %q: %w", settings.MetadataCacheTTL, ErrorMessageInvalidCacheTTL)
+	}
+
+	if settings.QueryCacheSizeMB < 0 {
+		return ErrorMessageInvalidQueryCacheSize
+	}
+
+	if settings.TLSAuth && (settings.TLSClientCert == "" || settings.TLSClientKey == "") {
+		return ErrorMessageMissingClientCertificate
+	}
+
 	return nil
 }
 
+// APIOptions returns the options used to create the historian API client
+func (settings *Settings) APIOptions() (api.Options, error) {
+	timeout, err := parseDurationSetting(settings.Timeout)
+	if err != nil {
+		return api.Options{}, err
+	}
+
+	queryTimeout, err := parseDurationSetting(settings.QueryTimeout)
+	if err != nil {
+		return api.Options{}, err
+	}
+
+	metadataCacheTTL, err := parseDurationSetting(settings.MetadataCacheTTL)
+	if err != nil {
+		return api.Options{}, err
+	}
+
+	options := api.Options{
+		URL:              settings.URL,
+		Token:            settings.Token,
+		Organization:     settings.Organization,
+		Timeout:          timeout,
+		QueryTimeout:     queryTimeout,
+		MetadataCacheTTL: metadataCacheTTL,
+	}
+
+	if settings.InsecureSkipVerify || settings.TLSAuth || settings.TLSAuthWithCACert || settings.ServerName != "" {
+		options.TLS = &httpclient.TLSOptions{
+			InsecureSkipVerify: settings.InsecureSkipVerify,
+			ServerName:         settings.ServerName,
+		}
+		if settings.TLSAuthWithCACert {
+			options.TLS.CACertificate = settings.TLSCACert
+		}
+		if settings.TLSAuth {
+			options.TLS.ClientCertificate = settings.TLSClientCert
+			options.TLS.ClientKey = settings.TLSClientKey
+		}
+	}
+
+	return options, nil
+}
+
+// parseDurationSetting parses a duration setting, either a number of seconds or a duration string like "90s"
+func parseDurationSetting(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, ErrorMessageInvalidDuration
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if duration < 0 {
+		return 0, ErrorMessageInvalidDuration
+	}
+
+	return duration, nil
+}
+
 // LoadSettings will read and validate Settings from the DataSourceConfig
 func LoadSettings(config backend.DataSourceInstanceSettings) (settings Settings, err error) {
 	if err := json.Unmarshal(config.JSONData, &settings); err != nil {
@@ -46,6 +144,12 @@ func LoadSettings(config backend.DataSourceInstanceSettings) (settings Settings,
 	if strings.TrimSpace(settings.QueryTimeout) == "" {
 		settings.QueryTimeout = "60"
 	}
+	if strings.TrimSpace(settings.MetadataCacheTTL) == "" {
+		settings.MetadataCacheTTL = "60"
+	}
 	settings.Token = config.DecryptedSecureJSONData["token"]
+	settings.TLSCACert = config.DecryptedSecureJSONData["tlsCACert"]
+	settings.TLSClientCert = config.DecryptedSecureJSONData["tlsClientCert"]
+	settings.TLSClientKey = config.DecryptedSecureJSONData["tlsClientKey"]
 	return settings, settings.isValid()
 }
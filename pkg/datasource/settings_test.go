@@ -0,0 +1,65 @@
+package datasource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSettingsAPIOptions(t *testing.T) {
+	t.Parallel()
+
+	config := backend.DataSourceInstanceSettings{
+		JSONData: []byte(`{"url":"https://historian","organization":"org","timeout":"5","queryTimeout":"2m","tlsSkipVerify":true,"tlsAuth":true,"tlsAuthWithCACert":true}`),
+		DecryptedSecureJSONData: map[string]string{
+			"token":         "tok",
+			"tlsCACert":     "ca",
+			"tlsClientCert": "cert",
+			"tlsClientKey":  "key",
+		},
+	}
+
+	settings, err := LoadSettings(config)
+	require.NoError(t, err)
+
+	options, err := settings.APIOptions()
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, options.Timeout)
+	assert.Equal(t, 2*time.Minute, options.QueryTimeout)
+	require.NotNil(t, options.TLS)
+	assert.True(t, options.TLS.InsecureSkipVerify)
+	assert.Equal(t, "ca", options.TLS.CACertificate)
+	assert.Equal(t, "cert", options.TLS.ClientCertificate)
+	assert.Equal(t, "key", options.TLS.ClientKey)
+}
+
+func TestLoadSettingsDefaultsAndValidation(t *testing.T) {
+	t.Parallel()
+
+	settings, err := LoadSettings(backend.DataSourceInstanceSettings{
+		JSONData:                []byte(`{"url":"http://historian","organization":"org"}`),
+		DecryptedSecureJSONData: map[string]string{"token": "tok"},
+	})
+	require.NoError(t, err)
+	options, err := settings.APIOptions()
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Second, options.Timeout)
+	assert.Equal(t, 60*time.Second, options.QueryTimeout)
+	assert.Equal(t, 60*time.Second, options.MetadataCacheTTL)
+	assert.Nil(t, options.TLS)
+
+	_, err = LoadSettings(backend.DataSourceInstanceSettings{
+		JSONData:                []byte(`{"url":"http://historian","organization":"org","timeout":"soon"}`),
+		DecryptedSecureJSONData: map[string]string{"token": "tok"},
+	})
+	assert.ErrorIs(t, err, ErrorMessageInvalidTimeout)
+
+	_, err = LoadSettings(backend.DataSourceInstanceSettings{
+		JSONData:                []byte(`{"url":"http://historian","organization":"org","tlsAuth":true}`),
+		DecryptedSecureJSONData: map[string]string{"token": "tok"},
+	})
+	assert.ErrorIs(t, err, ErrorMessageMissingClientCertificate)
+}
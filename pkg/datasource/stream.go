@@ -0,0 +1,323 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/schemas"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Stream consts
+const (
+	defaultStreamInterval = 5 * time.Second
+	minimumStreamInterval = time.Second
+	streamFrameName       = "stream"
+)
+
+// StreamQuery is the payload of a live stream subscription. The stream path is
+// "<query type>/<id>", where the query type is MeasurementQuery or AssetMeasurementQuery.
+type StreamQuery struct {
+	Query
+	// Interval between two pushes, e.g. "5s"
+	Interval string `json:"interval,omitempty"`
+}
+
+// measurementStream keeps the state of a single live stream
+type measurementStream struct {
+	measurementQuery schemas.MeasurementQuery
+	// assetSelection is set for asset measurement queries and used to name the frames
+	assetSelection *assetMeasurementSelection
+	interval       time.Duration
+	// cursor is the end of the last queried window
+	cursor time.Time
+	// lastSent is the timestamp of the newest point pushed per series
+	lastSent map[string]time.Time
+	// series are the value fields pushed so far, in order of appearance so the schema stays stable
+	series []streamSeries
+}
+
+// streamSeries describes one value field of the pushed frames
+type streamSeries struct {
+	key       string
+	name      string
+	fieldType data.FieldType
+	labels    data.Labels
+	config    *data.FieldConfig
+}
+
+// SubscribeStream validates a subscription to a live measurement stream
+func (*HistorianDataSource) SubscribeStream(_ context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+	if _, _, err := parseStreamRequest(req.Path, req.Data); err != nil {
+		log.DefaultLogger.Warn("Rejected stream subscription", "path", req.Path, "error", err)
+		return &backend.SubscribeStreamResponse{
+			Status: backend.SubscribeStreamStatusNotFound,
+		}, nil
+	}
+
+	return &backend.SubscribeStreamResponse{
+		Status: backend.SubscribeStreamStatusOK,
+	}, nil
+}
+
+// PublishStream rejects publications, streams are read-only
+func (*HistorianDataSource) PublishStream(_ context.Context, _ *backend.PublishStreamRequest) (*backend.PublishStreamResponse, error) {
+	return &backend.PublishStreamResponse{
+		Status: backend.PublishStreamStatusPermissionDenied,
+	}, nil
+}
+
+// RunStream polls the historian and pushes the points that arrived since the previous push.
+// Grafana cancels the context once the last subscriber leaves the channel.
+func (ds *HistorianDataSource) RunStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
+	stream, err := ds.newMeasurementStream(ctx, req.Path, req.Data)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(stream.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ds.disposed:
+			return nil
+		case now := <-ticker.C:
+			frame, err := ds.pollStream(ctx, stream, now)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				log.DefaultLogger.Error("Failed to poll stream", "path", req.Path, "error", err)
+				continue
+			}
+
+			if frame == nil {
+				continue
+			}
+
+			if err := sender.SendFrame(frame, data.IncludeAll); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// parseStreamRequest returns the query type and payload of a stream request
+func parseStreamRequest(path string, payload json.RawMessage) (string, StreamQuery, error) {
+	streamQuery := StreamQuery{}
+	queryType, _, _ := strings.Cut(path, "/")
+	if queryType != QueryTypeQuery && queryType != QueryTypeAsset {
+		return "", streamQuery, fmt.Errorf("unsupported stream query type %s", queryType)
+	}
+
+	if err := json.Unmarshal(payload, &streamQuery); err != nil {
+		return "", streamQuery, err
+	}
+
+	return queryType, streamQuery, nil
+}
+
+// newMeasurementStream resolves the measurements of the stream query once, so every poll only queries data
+func (ds *HistorianDataSource) newMeasurementStream(ctx context.Context, path string, payload json.RawMessage) (*measurementStream, error) {
+	queryType, streamQuery, err := parseStreamRequest(path, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := &measurementStream{
+		interval: defaultStreamInterval,
+		cursor:   time.Now(),
+		lastSent: map[string]time.Time{},
+	}
+
+	if streamQuery.Interval != "" {
+		interval, err := time.ParseDuration(streamQuery.Interval)
+		if err != nil {
+			return nil, err
+		}
+		stream.interval = max(interval, minimumStreamInterval)
+	}
+
+	switch queryType {
+	case QueryTypeAsset:
+		assetMeasurementQuery := schemas.AssetMeasurementQuery{}
+		if err := json.Unmarshal(streamQuery.Query.Query, &assetMeasurementQuery); err != nil {
+			return nil, err
+		}
+
+		historianInfo := streamQuery.HistorianInfo
+		if historianInfo == nil {
+			historianInfo, err = ds.getHistorianInfo(ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		stream.assetSelection, err = ds.resolveAssetMeasurementQuery(ctx, assetMeasurementQuery, streamQuery.SeriesLimit, historianInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		if stream.assetSelection != nil {
+			stream.measurementQuery = stream.assetSelection.measurementQuery
+		}
+	case QueryTypeQuery:
+		measurementQuery := schemas.MeasurementQuery{}
+		if err := json.Unmarshal(streamQuery.Query.Query, &measurementQuery); err != nil {
+			return nil, err
+		}
+
+		measurementQuery.Measurements, err = ds.getMeasurements(ctx, measurementQuery, streamQuery.SeriesLimit)
+		if err != nil {
+			return nil, err
+		}
+		stream.measurementQuery = measurementQuery
+	}
+
+	// Only new points are pushed, so the options that reach back before the window do not apply
+	stream.measurementQuery.Options.IncludeLastKnownPoint = false
+	stream.measurementQuery.Options.FillInitialEmptyValues = false
+	return stream, nil
+}
+
+// pollStream queries the window since the previous poll and returns a frame with the new points,
+// or nil when there is nothing to push
+func (ds *HistorianDataSource) pollStream(ctx context.Context, stream *measurementStream, now time.Time) (*data.Frame, error) {
+	if len(stream.measurementQuery.Measurements) == 0 {
+		return nil, nil
+	}
+
+	// Points can arrive late at the historian, so the previous window is queried again and
+	// already pushed points are filtered out. Aggregated windows are only pushed once complete.
+	start := stream.cursor.Add(-stream.interval)
+	end := now
+	if aggregation := stream.measurementQuery.Options.Aggregation; aggregation != nil {
+		period := stream.interval
+		if parsedPeriod, err := time.ParseDuration(aggregation.Period); err == nil && parsedPeriod > 0 {
+			period = parsedPeriod
+		}
+		start = stream.cursor.Truncate(period)
+		end = now.Truncate(period)
+	}
+
+	if !end.After(start) {
+		return nil, nil
+	}
+
+	frames, err := ds.handleQuery(ctx, historianQuery(stream.measurementQuery, backend.TimeRange{From: start, To: end}, stream.interval), stream.measurementQuery.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	if stream.assetSelection != nil {
+		frames = stream.assetSelection.setFrameNames(frames)
+	} else {
+		setMeasurementFrameNames(frames, stream.measurementQuery.Options)
+		if stream.measurementQuery.Options.MetadataAsLabels {
+			setFieldLabels(frames)
+		}
+	}
+
+	stream.cursor = end
+	return stream.newPoints(frames), nil
+}
+
+// newPoints joins the points that were not pushed yet into a single wide frame with one
+// value field per series. Series seen in earlier pushes keep their field so the schema is stable.
+func (s *measurementStream) newPoints(frames data.Frames) *data.Frame {
+	pointsByTime := map[time.Time]map[int]interface{}{}
+
+	for _, frame := range frames {
+		timeField, _ := frame.FieldByName("time")
+		valueField, _ := frame.FieldByName(valueFieldName)
+		if timeField == nil || valueField == nil {
+			continue
+		}
+
+		key := getFrameID(frame)
+		if valueField.Config != nil {
+			key += "|" + valueField.Config.DisplayNameFromDS
+		}
+		seriesIndex := s.seriesIndex(key, valueField)
+
+		lastSent, sentBefore := s.lastSent[key]
+		for i := 0; i < timeField.Len(); i++ {
+			timestamp, ok := timeField.ConcreteAt(i)
+			if !ok {
+				continue
+			}
+
+			t, ok := timestamp.(time.Time)
+			if !ok || (sentBefore && !t.After(lastSent)) {
+				continue
+			}
+
+			if _, ok := pointsByTime[t]; !ok {
+				pointsByTime[t] = map[int]interface{}{}
+			}
+			pointsByTime[t][seriesIndex] = valueField.CopyAt(i)
+
+			if newest := s.lastSent[key]; t.After(newest) {
+				s.lastSent[key] = t
+			}
+		}
+	}
+
+	if len(pointsByTime) == 0 {
+		return nil
+	}
+
+	timestamps := slices.SortedFunc(maps.Keys(pointsByTime), func(a, b time.Time) int {
+		return a.Compare(b)
+	})
+
+	fields := make([]*data.Field, 0, len(s.series)+1)
+	fields = append(fields, data.NewField("time", nil, timestamps))
+	for i, series := range s.series {
+		field := data.NewFieldFromFieldType(series.fieldType, 0)
+		field.Name = series.name
+		field.Labels = series.labels
+		field.Config = series.config
+		for _, timestamp := range timestamps {
+			addValueToField(field, pointsByTime[timestamp][i])
+		}
+		fields = append(fields, field)
+	}
+
+	frame := data.NewFrame(streamFrameName, fields...)
+	frame.Meta = &data.FrameMeta{Type: data.FrameTypeTimeSeriesWide}
+	return frame
+}
+
+// seriesIndex returns the index of the series for the given key, registering it when it is new
+func (s *measurementStream) seriesIndex(key string, valueField *data.Field) int {
+	for i := range s.series {
+		if s.series[i].key == key {
+			return i
+		}
+	}
+
+	name := valueField.Name
+	if valueField.Config != nil && valueField.Config.DisplayNameFromDS != "" {
+		name = valueField.Config.DisplayNameFromDS
+	}
+
+	s.series = append(s.series, streamSeries{
+		key:       key,
+		name:      name,
+		fieldType: valueField.Type().NullableType(),
+		labels:    valueField.Labels,
+		config:    valueField.Config,
+	})
+	return len(s.series) - 1
+}
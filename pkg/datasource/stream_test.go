@@ -0,0 +1,68 @@
+package datasource
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeSeriesFrame(measurementUUID string, times []time.Time, values []*float64) *data.Frame {
+	frame := data.NewFrame("",
+		data.NewField("time", nil, times),
+		data.NewField(valueFieldName, nil, values).SetConfig(&data.FieldConfig{DisplayNameFromDS: measurementUUID}),
+	)
+	frame.Meta = &data.FrameMeta{Custom: map[string]interface{}{"MeasurementUUID": measurementUUID}}
+	return frame
+}
+
+func TestMeasurementStreamNewPoints(t *testing.T) {
+	t.Parallel()
+
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Second)
+	t2 := t0.Add(2 * time.Second)
+	stream := &measurementStream{lastSent: map[string]time.Time{}}
+
+	frame := stream.newPoints(data.Frames{
+		makeSeriesFrame("a", []time.Time{t0, t1}, []*float64{new(1.0), new(2.0)}),
+	})
+	require.NotNil(t, frame)
+	assert.Equal(t, 2, frame.Rows())
+	require.Len(t, frame.Fields, 2)
+
+	// the overlapping window returns t1 again, only t2 is new; series b appears later
+	frame = stream.newPoints(data.Frames{
+		makeSeriesFrame("a", []time.Time{t1, t2}, []*float64{new(2.0), new(3.0)}),
+		makeSeriesFrame("b", []time.Time{t1}, []*float64{new(10.0)}),
+	})
+	require.NotNil(t, frame)
+	require.Len(t, frame.Fields, 3, "known series must keep their field")
+	assert.Equal(t, 2, frame.Rows())
+	assert.Equal(t, "a", frame.Fields[1].Name)
+	assert.Equal(t, "b", frame.Fields[2].Name)
+	assert.Nil(t, frame.Fields[1].At(0), "series a was already pushed at t1")
+	assert.Equal(t, 3.0, *frame.Fields[1].At(1).(*float64))
+	assert.Equal(t, 10.0, *frame.Fields[2].At(0).(*float64))
+
+	assert.Nil(t, stream.newPoints(data.Frames{
+		makeSeriesFrame("a", []time.Time{t2}, []*float64{new(3.0)}),
+	}), "nothing new must not produce a frame")
+}
+
+func TestParseStreamRequest(t *testing.T) {
+	t.Parallel()
+
+	payload := json.RawMessage(`{"query":{"Measurements":["m"]},"seriesLimit":10,"interval":"2s"}`)
+	queryType, streamQuery, err := parseStreamRequest(QueryTypeQuery+"/panel-1", payload)
+	require.NoError(t, err)
+	assert.Equal(t, QueryTypeQuery, queryType)
+	assert.Equal(t, 10, streamQuery.SeriesLimit)
+	assert.Equal(t, "2s", streamQuery.Interval)
+
+	_, _, err = parseStreamRequest(QueryTypeEvent+"/panel-1", payload)
+	assert.Error(t, err)
+}
@@ -9,6 +9,22 @@ type FrameFormat string
 const (
 	FrameFormatAuto  FrameFormat = ""
 	FrameFormatTable FrameFormat = "table"
+	// FrameFormatNumeric reduces every series to a single value, the shape alerting expects
+	FrameFormatNumeric FrameFormat = "numeric"
+)
+
+// Reducer selects how FrameFormatNumeric reduces a series to a single value.
+type Reducer string
+
+// Reducer values. Empty string reduces to the last value.
+const (
+	ReducerLast  Reducer = "last"
+	ReducerFirst Reducer = "first"
+	ReducerMin   Reducer = "min"
+	ReducerMax   Reducer = "max"
+	ReducerMean  Reducer = "mean"
+	ReducerSum   Reducer = "sum"
+	ReducerCount Reducer = "count"
 )
 
 // MeasurementQueryOptions are measurement query options
@@ -29,6 +45,19 @@ type MeasurementQueryOptions struct {
 	Datatypes              []string
 	Desc                   bool
 	FrameFormat            FrameFormat
+	Reducer                Reducer
+	// Calculation replaces the queried measurements by a series derived from them, measurement queries only
+	Calculation *Calculation
+}
+
+// Calculation derives a series from measurements, e.g. "flow * density"
+type Calculation struct {
+	Expression string
+	// Aliases maps the variables of the expression to the UUID or name of a queried measurement
+	Aliases map[string]string
+	// Name of the derived series, defaults to the expression
+	Name string
+	Unit string
 }
 
 // ValueFilter is used to filter the values returned by the historian
@@ -43,6 +72,9 @@ type AssetMeasurementQuery struct {
 	Assets          []string
 	AssetProperties []string
 	Options         MeasurementQueryOptions
+	// Recursive also selects the descendants of the assets, up to MaxDepth levels below them when set
+	Recursive bool
+	MaxDepth  int
 }
 
 // MeasurementQuery is used to build the time series query to send to the historian
@@ -79,8 +111,57 @@ type EventQuery struct {
 	OverrideTimeRange    bool `json:"overrideTimeRange"`
 	TimeRange            TimeRange
 	Ascending            bool
+	// Recursive also selects the descendants of the assets, up to MaxDepth levels below them when set
+	Recursive bool
+	MaxDepth  int
+	// GroupBy are the columns or simple properties the events are grouped by for a summary query
+	GroupBy []string
+	// WallClockTime returns the periodic properties as time series on the time of the events instead of the offset
+	WallClockTime bool
+	// Envelope adds statistics across the events per offset to periodic queries when set
+	Envelope *EventEnvelope
+	// AssetPropertyAggregations replace the aggregation of the options for simple queries, each becomes a separate column
+	AssetPropertyAggregations []Aggregation
+	// Annotation configures the title and text of annotation queries, the selected properties become the tags
+	Annotation EventAnnotation
+	// ParentDepth is the number of ancestor levels that are added when IncludeParentInfo is set, defaults to 1
+	ParentDepth int
+	// ChildEvents also returns the child events of the events of simple queries when set
+	ChildEvents *EventChildren
+}
+
+// EventChildren selects the child events of the queried events
+type EventChildren struct {
+	EventTypes []string
+	// Aggregate adds the number and total duration of the child events per event type as columns to the rows of
+	// their parent instead of returning the child events as separate frames
+	Aggregate bool
 }
 
+// EventAnnotation contains the templates of the title and text of event annotations
+type EventAnnotation struct {
+	Title string
+	Text  string
+}
+
+// EventEnvelope configures the statistical envelope over the periodic properties of the events
+type EventEnvelope struct {
+	// StdDevs is the number of standard deviations of the band around the mean, defaults to 2
+	StdDevs float64
+	// ReferenceEventUUID is the UUID of the golden event that is added as a reference series, it has to be one of the queried events
+	ReferenceEventUUID string
+}
+
+// Event query types next to the event type property types
+const (
+	// EventQueryTypeSummary is the event query type that returns statistics per group of events
+	EventQueryTypeSummary = "summary"
+	// EventQueryTypeActive is the event query type that returns a step series per asset and event type
+	EventQueryTypeActive = "active"
+	// EventQueryTypeAnnotation is the event query type that returns the events as Grafana annotations
+	EventQueryTypeAnnotation = "annotation"
+)
+
 // TimeRange contains a user-defined time range that can be used to override the grafana dashboard time range
 type TimeRange struct {
 	From *time.Time `json:"fromParsed,omitempty"`
@@ -30,6 +30,13 @@ const (
 	Max      AggregationType = "max"
 	Min      AggregationType = "min"
 	TWA      AggregationType = "twa"
+
+	// The following aggregations are not supported by the historian, the datasource computes them
+	DurationInState AggregationType = "duration_in_state"
+	PercentGood     AggregationType = "percent_good"
+	StateDuration   AggregationType = "state_duration"
+	StateCount      AggregationType = "state_count"
+	StateAtStart    AggregationType = "state_at_start"
 )
 
 // FillType is a string
@@ -0,0 +1,167 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// ErrInvalidExpression is returned for expressions that can't be parsed or use unsupported syntax
+var ErrInvalidExpression = errors.New("invalid expression")
+
+// expressionFunctions are the functions that can be called in an expression
+var expressionFunctions = map[string]struct {
+	arguments int
+	call      func(arguments []float64) float64
+}{
+	"abs":   {1, func(a []float64) float64 { return math.Abs(a[0]) }},
+	"sqrt":  {1, func(a []float64) float64 { return math.Sqrt(a[0]) }},
+	"log":   {1, func(a []float64) float64 { return math.Log(a[0]) }},
+	"log10": {1, func(a []float64) float64 { return math.Log10(a[0]) }},
+	"exp":   {1, func(a []float64) float64 { return math.Exp(a[0]) }},
+	"round": {1, func(a []float64) float64 { return math.Round(a[0]) }},
+	"floor": {1, func(a []float64) float64 { return math.Floor(a[0]) }},
+	"ceil":  {1, func(a []float64) float64 { return math.Ceil(a[0]) }},
+	"pow":   {2, func(a []float64) float64 { return math.Pow(a[0], a[1]) }},
+	"min":   {2, func(a []float64) float64 { return math.Min(a[0], a[1]) }},
+	"max":   {2, func(a []float64) float64 { return math.Max(a[0], a[1]) }},
+}
+
+// Expression is a parsed arithmetic expression over named variables, e.g. "(a - b) / b * 100".
+// It supports + - * / %, parentheses, numbers and the functions abs, sqrt, log, log10, exp,
+// round, floor, ceil, pow, min and max.
+type Expression struct {
+	source    string
+	root      ast.Expr
+	variables []string
+}
+
+// ParseExpression parses an arithmetic expression
+func ParseExpression(source string) (*Expression, error) {
+	root, err := parser.ParseExpr(source)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %v", ErrInvalidExpression, source, err)
+	}
+
+	expression := &Expression{source: source, root: root}
+	if err := expression.validate(root); err != nil {
+		return nil, fmt.Errorf("%w %q: %v", ErrInvalidExpression, source, err)
+	}
+	slices.Sort(expression.variables)
+	expression.variables = slices.Compact(expression.variables)
+	return expression, nil
+}
+
+// String returns the source of the expression
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Variables returns the sorted names of the variables used in the expression
+func (e *Expression) Variables() []string {
+	return slices.Clone(e.variables)
+}
+
+// Evaluate evaluates the expression, variables missing from values evaluate to NaN
+func (e *Expression) Evaluate(values map[string]float64) float64 {
+	return evaluate(e.root, values)
+}
+
+// validate checks that the expression only uses supported syntax and collects its variables
+func (e *Expression) validate(node ast.Expr) error {
+	switch n := node.(type) {
+	case *ast.BasicLit:
+		if n.Kind != token.INT && n.Kind != token.FLOAT {
+			return fmt.Errorf("unsupported literal %s", n.Value)
+		}
+		_, err := strconv.ParseFloat(n.Value, 64)
+		return err
+	case *ast.Ident:
+		e.variables = append(e.variables, n.Name)
+		return nil
+	case *ast.ParenExpr:
+		return e.validate(n.X)
+	case *ast.UnaryExpr:
+		if n.Op != token.ADD && n.Op != token.SUB {
+			return fmt.Errorf("unsupported operator %s", n.Op)
+		}
+		return e.validate(n.X)
+	case *ast.BinaryExpr:
+		switch n.Op {
+		case token.ADD, token.SUB, token.MUL, token.QUO, token.REM:
+		default:
+			return fmt.Errorf("unsupported operator %s", n.Op)
+		}
+		if err := e.validate(n.X); err != nil {
+			return err
+		}
+		return e.validate(n.Y)
+	case *ast.CallExpr:
+		name, ok := n.Fun.(*ast.Ident)
+		if !ok {
+			return errors.New("unsupported function call")
+		}
+		function, ok := expressionFunctions[name.Name]
+		if !ok {
+			return fmt.Errorf("unknown function %s", name.Name)
+		}
+		if len(n.Args) != function.arguments {
+			return fmt.Errorf("%s expects %d arguments", name.Name, function.arguments)
+		}
+		for _, argument := range n.Args {
+			if err := e.validate(argument); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported syntax %T", node)
+	}
+}
+
+func evaluate(node ast.Expr, values map[string]float64) float64 {
+	switch n := node.(type) {
+	case *ast.BasicLit:
+		value, _ := strconv.ParseFloat(n.Value, 64)
+		return value
+	case *ast.Ident:
+		if value, ok := values[n.Name]; ok {
+			return value
+		}
+		return math.NaN()
+	case *ast.ParenExpr:
+		return evaluate(n.X, values)
+	case *ast.UnaryExpr:
+		if n.Op == token.SUB {
+			return -evaluate(n.X, values)
+		}
+		return evaluate(n.X, values)
+	case *ast.BinaryExpr:
+		x, y := evaluate(n.X, values), evaluate(n.Y, values)
+		switch n.Op {
+		case token.ADD:
+			return x + y
+		case token.SUB:
+			return x - y
+		case token.MUL:
+			return x * y
+		case token.QUO:
+			return x / y
+		case token.REM:
+			return math.Mod(x, y)
+		}
+	case *ast.CallExpr:
+		function := expressionFunctions[n.Fun.(*ast.Ident).Name]
+		arguments := make([]float64, len(n.Args))
+		for i, argument := range n.Args {
+			arguments[i] = evaluate(argument, values)
+		}
+		return function.call(arguments)
+	}
+	return math.NaN()
+}
@@ -0,0 +1,50 @@
+package util_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/factrylabs/factry-historian-datasource.git/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpression(t *testing.T) {
+	tests := []struct {
+		source    string
+		values    map[string]float64
+		variables []string
+		expected  float64
+	}{
+		{"(a - b) / b * 100", map[string]float64{"a": 12, "b": 10}, []string{"a", "b"}, 20},
+		{"-a + 2.5", map[string]float64{"a": 1}, []string{"a"}, 1.5},
+		{"a % 3", map[string]float64{"a": 7}, []string{"a"}, 1},
+		{"max(a, b) + abs(c)", map[string]float64{"a": 1, "b": 2, "c": -3}, []string{"a", "b", "c"}, 5},
+		{"pow(a, 2) + a", map[string]float64{"a": 3}, []string{"a"}, 12},
+		{"round(1.6)", nil, nil, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			expression, err := util.ParseExpression(tt.source)
+			require.NoError(t, err)
+			assert.Equal(t, tt.variables, expression.Variables())
+			assert.InDelta(t, tt.expected, expression.Evaluate(tt.values), 1e-9)
+		})
+	}
+}
+
+func TestExpression_MissingVariable(t *testing.T) {
+	expression, err := util.ParseExpression("a + b")
+	require.NoError(t, err)
+	assert.True(t, math.IsNaN(expression.Evaluate(map[string]float64{"a": 1})))
+}
+
+func TestParseExpression_Invalid(t *testing.T) {
+	for _, source := range []string{"", "a +", "a == b", `"a"`, "a.b", "foo(a)", "pow(a)", "a[0]"} {
+		t.Run(source, func(t *testing.T) {
+			_, err := util.ParseExpression(source)
+			assert.ErrorIs(t, err, util.ErrInvalidExpression)
+		})
+	}
+}
@@ -3,7 +3,7 @@ import { QueryEditorProps } from '@grafana/data'
 import { getTemplateSrv } from '@grafana/runtime'
 import { Events } from 'QueryEditor/Events'
 import { DataSource } from 'datasource'
-import { HistorianDataSourceOptions, Query, EventQuery, PropertyType } from 'types'
+import { AnnotationQueryType, HistorianDataSourceOptions, Query, EventQuery } from 'types'
 
 type Props = QueryEditorProps<DataSource, Query, HistorianDataSourceOptions>
 
@@ -28,7 +28,7 @@ export class AnnotationsQueryEditor extends Component<Props> {
     } catch (_) {}
     if (!query.query) {
       this.onChangeEventQuery({
-        Type: PropertyType.Simple,
+        Type: AnnotationQueryType,
         Assets: [],
         Statuses: [],
         PropertyFilter: [],
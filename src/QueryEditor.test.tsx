@@ -27,6 +27,9 @@ jest.mock('QueryEditor/RawQueryEditor', () => ({
 
 const mockDatasource = {
   getInfo: jest.fn().mockResolvedValue({}),
+  editorOpened: jest.fn(),
+  editorClosed: jest.fn(),
+  supportsLive: (query: Query) => query.queryType === 'MeasurementQuery' || query.queryType === 'AssetMeasurementQuery',
   defaultTab: TabIndex.Measurements,
   historianInfo: undefined,
 } as unknown as DataSource
@@ -78,6 +81,33 @@ describe('QueryEditor', () => {
     })
   })
 
+  it('marks the editor open while it is mounted', async () => {
+    const { unmount } = render(<QueryEditor {...defaultProps} />)
+
+    await waitFor(() => {
+      expect(mockDatasource.editorOpened).toHaveBeenCalledTimes(1)
+    })
+    expect(mockDatasource.editorClosed).not.toHaveBeenCalled()
+
+    unmount()
+    expect(mockDatasource.editorClosed).toHaveBeenCalledTimes(1)
+  })
+
+  it('shows the Live switch for measurement queries only', async () => {
+    const { unmount } = render(<QueryEditor {...defaultProps} />)
+    await waitFor(() => {
+      expect(screen.getByText('Live')).toBeInTheDocument()
+    })
+    unmount()
+
+    const query = makeQuery({ queryType: 'EventQuery', tabIndex: TabIndex.Events })
+    render(<QueryEditor {...defaultProps} query={query} />)
+    await waitFor(() => {
+      expect(screen.getByTestId('events-editor')).toBeInTheDocument()
+    })
+    expect(screen.queryByText('Live')).not.toBeInTheDocument()
+  })
+
   it('renders Measurements editor when queryType is MeasurementQuery', async () => {
     const query = makeQuery({ queryType: 'MeasurementQuery', tabIndex: TabIndex.Measurements })
     render(<QueryEditor {...defaultProps} query={query} />)
@@ -1,5 +1,5 @@
 import React, { Component } from 'react'
-import { RadioButtonGroup, InlineField, InlineFieldRow } from '@grafana/ui'
+import { RadioButtonGroup, InlineField, InlineFieldRow, InlineSwitch } from '@grafana/ui'
 import { CoreApp, dateTime, QueryEditorProps } from '@grafana/data'
 import { getTemplateSrv } from '@grafana/runtime'
 import { Assets } from 'QueryEditor/Assets'
@@ -32,6 +32,7 @@ export class QueryEditor extends Component<Props, QueryEditorState> {
     this.onChangeAssetMeasurementQuery = this.onChangeAssetMeasurementQuery.bind(this)
     this.onChangeEventQuery = this.onChangeEventQuery.bind(this)
     this.onChangeSeriesLimit = this.onChangeSeriesLimit.bind(this)
+    this.onChangeLive = this.onChangeLive.bind(this)
   }
 
   mountFinished = false
@@ -80,6 +81,7 @@ export class QueryEditor extends Component<Props, QueryEditorState> {
     const { query } = this.props
     const tabIndex = query.tabIndex ?? this.state.tabIndex
     this.setTabIndex(tabIndex)
+    this.props.datasource.editorOpened()
     try {
       await this.props.datasource.getInfo()
     } catch (_) {}
@@ -88,6 +90,10 @@ export class QueryEditor extends Component<Props, QueryEditorState> {
     this.setState({ ...this.state })
   }
 
+  componentWillUnmount(): void {
+    this.props.datasource.editorClosed()
+  }
+
   setTabIndex(index: number): void {
     this.setState(
       (prevState) => {
@@ -204,6 +210,15 @@ export class QueryEditor extends Component<Props, QueryEditorState> {
     this.onRunQuery(this.props)
   }
 
+  onChangeLive(event: React.FormEvent<HTMLInputElement>): void {
+    const { onChange, query } = this.props
+    const updatedQuery = JSON.parse(JSON.stringify(query)) as Query
+    updatedQuery.live = event.currentTarget.checked
+    updatedQuery.historianInfo = this.props.datasource.historianInfo
+    onChange(updatedQuery)
+    this.onRunQuery(this.props)
+  }
+
   onRunQuery(
     props: Readonly<Props> &
       Readonly<{
@@ -287,6 +302,14 @@ export class QueryEditor extends Component<Props, QueryEditorState> {
               options={tabs.map((tab, idx) => ({ label: tab.title, value: idx }))}
             />
           </InlineField>
+          {!this.appIsAlertingType && this.props.datasource.supportsLive(this.props.query) && (
+            <InlineField
+              label="Live"
+              tooltip="Push new points to the panel as they arrive instead of querying the dashboard time range"
+            >
+              <InlineSwitch value={this.props.query.live ?? false} onChange={this.onChangeLive} />
+            </InlineField>
+          )}
         </InlineFieldRow>
         {this.mountFinished && this.props.query.query && tabs[this.state.tabIndex].content}
       </>
@@ -0,0 +1,37 @@
+import React, { ChangeEvent, FormEvent } from 'react'
+import { InlineField, InlineFieldRow, InlineSwitch, Input } from '@grafana/ui'
+import { labelWidth } from 'types'
+
+export interface Props {
+  recursive?: boolean
+  maxDepth?: number
+  onChange: (recursive: boolean, maxDepth?: number) => void
+}
+
+export const AssetHierarchy = (props: Props): JSX.Element => {
+  const onChangeRecursive = (event: FormEvent<HTMLInputElement>): void => {
+    props.onChange((event as ChangeEvent<HTMLInputElement>).target.checked, props.maxDepth)
+  }
+
+  const onChangeMaxDepth = (event: ChangeEvent<HTMLInputElement>): void => {
+    const maxDepth = parseInt(event.target.value, 10)
+    props.onChange(props.recursive ?? false, isNaN(maxDepth) || maxDepth <= 0 ? undefined : maxDepth)
+  }
+
+  return (
+    <InlineFieldRow>
+      <InlineField
+        label="Include descendants"
+        labelWidth={labelWidth}
+        tooltip="Also select every asset below the selected assets. A single asset can be selected recursively by ending its path with /**"
+      >
+        <InlineSwitch value={props.recursive ?? false} onChange={onChangeRecursive} />
+      </InlineField>
+      {props.recursive && (
+        <InlineField label="Max depth" tooltip="The number of levels below the selected assets, leave empty for no limit">
+          <Input type="number" min={1} value={props.maxDepth ?? ''} onChange={onChangeMaxDepth} width={10} />
+        </InlineField>
+      )}
+    </InlineFieldRow>
+  )
+}
@@ -4,6 +4,7 @@ import type { SelectableValue } from '@grafana/data'
 import { default as Cascader } from 'components/Cascader/Cascader'
 import { AssetProperties } from 'components/util/AssetPropertiesSelect'
 import { DataSource } from 'datasource'
+import { AssetHierarchy } from './AssetHierarchy'
 import { QueryOptions } from './QueryOptions'
 import { getChildAssets, matchedAssets, tagsToQueryTags, valueFiltersToQueryTags } from './util'
 import { Asset, AssetMeasurementQuery, AssetProperty, labelWidth, MeasurementQueryOptions } from 'types'
@@ -91,6 +92,14 @@ export const Assets = (props: Props): JSX.Element => {
     })
   }
 
+  const onChangeAssetHierarchy = (recursive: boolean, maxDepth?: number): void => {
+    props.onChangeAssetMeasurementQuery({
+      ...props.query,
+      Recursive: recursive,
+      MaxDepth: maxDepth,
+    })
+  }
+
   const initialLabel = (): string => {
     if (!props.query.Assets || props.query.Assets.length === 0) {
       return ''
@@ -177,6 +186,11 @@ export const Assets = (props: Props): JSX.Element => {
               />
             </InlineField>
           </InlineFieldRow>
+          <AssetHierarchy
+            recursive={props.query.Recursive}
+            maxDepth={props.query.MaxDepth}
+            onChange={onChangeAssetHierarchy}
+          />
           <InlineFieldRow>
             <InlineField
               label="Properties"
@@ -7,6 +7,8 @@ import { QueryTag, TagsSection } from 'components/TagsSection/TagsSection'
 import { toSelectableValue } from 'components/TagsSection/util'
 import { DataSource } from 'datasource'
 import {
+  ActiveQueryType,
+  AnnotationQueryType,
   Asset,
   EventConfiguration,
   EventPropertyFilter,
@@ -16,8 +18,15 @@ import {
   labelWidth,
   PropertyDatatype,
   PropertyType,
+  SummaryQueryType,
 } from 'types'
-import { getValueFilterOperatorsForVersion, KnownOperator, needsValue } from 'util/eventFilter'
+import {
+  dateDatatype,
+  getValueFilterOperatorsForVersion,
+  isDateComparison,
+  KnownOperator,
+  needsValue,
+} from 'util/eventFilter'
 import { getChildAssets, isSupportedPropertyType, matchedAssets, propertyFilterToQueryTags } from './util'
 import { isFeatureEnabled } from 'util/semver'
 import { isRegex, isUUID } from 'util/util'
@@ -192,7 +201,10 @@ export const EventFilter = (props: Props): JSX.Element => {
     updatedTags.forEach((tag) => {
       const isParent = tag.key.startsWith('parent:')
       const cleanKey = tag.key.replace('parent:', '')
-      const dataType = getDatatype(cleanKey, isParent)
+      let dataType: string = getDatatype(cleanKey, isParent)
+      if (dataType === PropertyDatatype.String && isDateComparison(tag.operator as KnownOperator, tag.value)) {
+        dataType = dateDatatype
+      }
       const filter: EventPropertyFilter = {
         Property: tag.key,
         Datatype: dataType,
@@ -308,7 +320,12 @@ export const EventFilter = (props: Props): JSX.Element => {
 
   const availableProperties = (eventTypes: string[], includeParentInfo: boolean): Array<SelectableValue<string>> => {
     let properties = [] as string[]
-    if (props.query.Type === PropertyType.Simple) {
+    if (
+      props.query.Type === PropertyType.Simple ||
+      props.query.Type === SummaryQueryType ||
+      props.query.Type === ActiveQueryType ||
+      props.query.Type === AnnotationQueryType
+    ) {
       properties = availableSimpleProperties(eventTypes)
       if (includeParentInfo) {
         properties = [...properties, ...availableSimpleProperties(eventTypes, true).map((k) => `parent:${k}`)]
@@ -421,13 +438,21 @@ export const EventFilter = (props: Props): JSX.Element => {
               grow
               labelWidth={labelWidth}
               label="Query Type"
-              tooltip="Select the property type: simple or periodic"
+              tooltip="Select the property type: simple or periodic, summary for statistics per group of events or active for a series that is 1 while an event is active, or the value of the first selected property"
             >
               <Select
                 options={Object.entries(PropertyType)
                   .filter(([_, value]) => isSupportedPropertyType(value, props.datasource.historianInfo?.Version ?? ''))
                   .filter(([_, value]) => !props.isAnnotationQuery || value === PropertyType.Simple)
-                  .map(([key, value]) => ({ label: key, value }))}
+                  .map(([key, value]) => ({ label: key, value }))
+                  .concat(
+                    props.isAnnotationQuery
+                      ? [{ label: 'Annotation', value: AnnotationQueryType }]
+                      : [
+                          { label: 'Summary', value: SummaryQueryType },
+                          { label: 'Active', value: ActiveQueryType },
+                        ]
+                  )}
                 value={props.query.Type}
                 onChange={onChangeQueryType}
               />
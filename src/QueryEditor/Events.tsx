@@ -1,11 +1,26 @@
 import React, { ChangeEvent, FormEvent, useCallback, useEffect, useState } from 'react'
-import { FieldSet, InlineField, InlineFieldRow, InlineSwitch, Input, RadioButtonGroup } from '@grafana/ui'
-import { DateTime } from '@grafana/data'
+import { FieldSet, InlineField, InlineFieldRow, InlineSwitch, Input, MultiSelect, RadioButtonGroup } from '@grafana/ui'
+import { DateTime, SelectableValue } from '@grafana/data'
 import { getTemplateSrv } from '@grafana/runtime'
-import { defaultQueryOptions, matchedAssets, tagsToQueryTags, useDebounce } from './util'
+import { defaultQueryOptions, getAggregationsForDatatypes, matchedAssets, tagsToQueryTags, useDebounce } from './util'
 import { EventAssetProperties } from './EventAssetProperties'
 import { DataSource } from 'datasource'
-import { Asset, AssetMeasurementQuery, EventQuery, labelWidth, PropertyType, TimeRange } from 'types'
+import {
+  Aggregation,
+  AnnotationQueryType,
+  Asset,
+  AssetMeasurementQuery,
+  EventAnnotation,
+  EventChildren,
+  EventEnvelope,
+  EventQuery,
+  EventType,
+  labelWidth,
+  PropertyType,
+  SummaryQueryType,
+  TimeRange,
+} from 'types'
+import { AssetHierarchy } from './AssetHierarchy'
 import { EventFilter } from './EventFilter'
 import { DateRangePicker } from 'components/util/DateRangePicker'
 
@@ -23,6 +38,7 @@ export interface Props {
 export const Events = (props: Props): JSX.Element => {
   const [loading, setLoading] = useState(true)
   const [assets, setAssets] = useState<Asset[]>([])
+  const [eventTypes, setEventTypes] = useState<EventType[]>([])
   const [ordering, setOrdering] = useState(props.query.Ascending ? 'ascending' : 'descending')
   const [limit, setLimit] = useDebounce<number | string | undefined>(
     props.query.Limit,
@@ -45,6 +61,8 @@ export const Events = (props: Props): JSX.Element => {
   const fetchAll = useCallback(async () => {
     const assets = await props.datasource.getAssets()
     setAssets(assets)
+    const eventTypes = await props.datasource.getEventTypes()
+    setEventTypes(eventTypes)
   }, [props.datasource])
 
   useEffect(() => {
@@ -91,6 +109,77 @@ export const Events = (props: Props): JSX.Element => {
     props.onChangeEventQuery(updatedQuery)
   }
 
+  const onChangeParentDepth = (value: string): void => {
+    const updatedQuery = { ...props.query, ParentDepth: value === '' ? undefined : Number(value) } as EventQuery
+    props.onChangeEventQuery(updatedQuery)
+  }
+
+  const onChangeWallClockTime = (event: FormEvent<HTMLInputElement>): void => {
+    const enabled = (event as ChangeEvent<HTMLInputElement>).target.checked
+    const updatedQuery = { ...props.query, WallClockTime: enabled } as EventQuery
+    props.onChangeEventQuery(updatedQuery)
+  }
+
+  const onChangeEnvelopeEnabled = (event: FormEvent<HTMLInputElement>): void => {
+    const enabled = (event as ChangeEvent<HTMLInputElement>).target.checked
+    const updatedQuery = { ...props.query, Envelope: enabled ? {} : undefined } as EventQuery
+    props.onChangeEventQuery(updatedQuery)
+  }
+
+  const onChangeEnvelope = (envelope: EventEnvelope): void => {
+    const updatedQuery = { ...props.query, Envelope: { ...props.query.Envelope, ...envelope } } as EventQuery
+    props.onChangeEventQuery(updatedQuery)
+  }
+
+  const onChangeAssetPropertyAggregations = (items: Array<SelectableValue<string>>): void => {
+    const aggregations = items.map((e) => ({ Name: e.value ?? '' }) as Aggregation)
+    const updatedQuery = { ...props.query, AssetPropertyAggregations: aggregations } as EventQuery
+    props.onChangeEventQuery(updatedQuery)
+  }
+
+  const onChangeAnnotation = (annotation: EventAnnotation): void => {
+    const updatedQuery = { ...props.query, Annotation: { ...props.query.Annotation, ...annotation } } as EventQuery
+    props.onChangeEventQuery(updatedQuery)
+  }
+
+  const onChangeAssetHierarchy = (recursive: boolean, maxDepth?: number): void => {
+    const updatedQuery = { ...props.query, Recursive: recursive, MaxDepth: maxDepth } as EventQuery
+    props.onChangeEventQuery(updatedQuery)
+  }
+
+  const onChangeGroupBy = (items: Array<SelectableValue<string>>): void => {
+    const updatedQuery = { ...props.query, GroupBy: items.map((e) => e.value ?? '') } as EventQuery
+    props.onChangeEventQuery(updatedQuery)
+  }
+
+  const groupByOptions = (): Array<SelectableValue<string>> => {
+    return ['Asset', 'AssetPath', 'EventType', 'ParentEventUUID', 'Parent_Asset', 'Parent_EventType']
+      .concat(props.query.GroupBy ?? [])
+      .filter((value, index, values) => values.indexOf(value) === index)
+      .map((value) => ({ label: value, value }))
+  }
+
+  const onChangeChildEventTypes = (items: Array<SelectableValue<string>>): void => {
+    const childEventTypes = items.map((e) => e.value ?? '')
+    const childEvents =
+      childEventTypes.length > 0 ? { ...props.query.ChildEvents, EventTypes: childEventTypes } : undefined
+    const updatedQuery = { ...props.query, ChildEvents: childEvents } as EventQuery
+    props.onChangeEventQuery(updatedQuery)
+  }
+
+  const onChangeChildEventsAggregate = (event: FormEvent<HTMLInputElement>): void => {
+    const aggregate = (event as ChangeEvent<HTMLInputElement>).target.checked
+    const childEvents = { ...props.query.ChildEvents, Aggregate: aggregate } as EventChildren
+    const updatedQuery = { ...props.query, ChildEvents: childEvents } as EventQuery
+    props.onChangeEventQuery(updatedQuery)
+  }
+
+  const childEventTypeOptions = (): Array<SelectableValue<string>> => {
+    return eventTypes
+      .map((e) => ({ label: e.Name, value: e.Name }) as SelectableValue<string>)
+      .concat(templateVariables)
+  }
+
   const onChangeLimit = (event: ChangeEvent<HTMLInputElement> | null): void => {
     const value = event?.target.value
     setLimit(value === '' ? undefined : value)
@@ -145,6 +234,11 @@ export const Events = (props: Props): JSX.Element => {
               multiSelectProperties={true}
               onChangeQuery={onChangeEventFilter}
             />
+            <AssetHierarchy
+              recursive={props.query.Recursive}
+              maxDepth={props.query.MaxDepth}
+              onChange={onChangeAssetHierarchy}
+            />
             <InlineFieldRow>
               <InlineField
                 label="Include Parent Event"
@@ -155,7 +249,139 @@ export const Events = (props: Props): JSX.Element => {
               >
                 <InlineSwitch value={props.query.IncludeParentInfo} onChange={onChangeIncludeParentInfo} />
               </InlineField>
+              {props.query.IncludeParentInfo && (
+                <InlineField
+                  label="Depth"
+                  tooltip="Number of ancestor levels to add, e.g. 2 adds the Parent_ and Grandparent_ columns, defaults to 1"
+                >
+                  <Input
+                    type="number"
+                    min={1}
+                    width={10}
+                    defaultValue={props.query.ParentDepth}
+                    onBlur={(e) => onChangeParentDepth(e.currentTarget.value)}
+                  />
+                </InlineField>
+              )}
             </InlineFieldRow>
+            {(props.query.Type === PropertyType.Periodic || props.query.Type === PropertyType.PeriodicWithDimension) && (
+              <InlineFieldRow>
+                <InlineField
+                  label="Wall clock time"
+                  tooltip="Plot the periodic properties on the time of the events instead of the offset from their start"
+                  labelWidth={labelWidth}
+                >
+                  <InlineSwitch value={props.query.WallClockTime} onChange={onChangeWallClockTime} />
+                </InlineField>
+              </InlineFieldRow>
+            )}
+            {(props.query.Type === PropertyType.Periodic || props.query.Type === PropertyType.PeriodicWithDimension) &&
+              !props.query.WallClockTime && (
+                <InlineFieldRow>
+                  <InlineField
+                    label="Envelope"
+                    tooltip="Adds the mean, minimum, maximum and mean ± N stddev across the events per offset, and labels the events that leave the stddev band"
+                    labelWidth={labelWidth}
+                  >
+                    <InlineSwitch value={props.query.Envelope !== undefined} onChange={onChangeEnvelopeEnabled} />
+                  </InlineField>
+                  {props.query.Envelope && (
+                    <>
+                      <InlineField label="Stddev" tooltip="Number of standard deviations of the band, defaults to 2">
+                        <Input
+                          type="number"
+                          width={10}
+                          defaultValue={props.query.Envelope.StdDevs}
+                          onBlur={(e) =>
+                            onChangeEnvelope({
+                              StdDevs: e.currentTarget.value === '' ? undefined : Number(e.currentTarget.value),
+                            })
+                          }
+                        />
+                      </InlineField>
+                      <InlineField
+                        label="Reference event"
+                        tooltip="UUID of the golden event to add as a reference series, it has to be one of the queried events"
+                      >
+                        <Input
+                          width={40}
+                          defaultValue={props.query.Envelope.ReferenceEventUUID}
+                          onBlur={(e) => onChangeEnvelope({ ReferenceEventUUID: e.currentTarget.value })}
+                        />
+                      </InlineField>
+                    </>
+                  )}
+                </InlineFieldRow>
+              )}
+            {props.query.Type === AnnotationQueryType && (
+              <>
+                <InlineFieldRow>
+                  <InlineField
+                    label="Title"
+                    grow
+                    labelWidth={labelWidth}
+                    tooltip="Template of the annotation title, {{EventType}}, {{Asset}}, {{AssetPath}}, {{Duration}} and {{<property>}} are replaced by the values of the event. The selected properties become the tags"
+                  >
+                    <Input
+                      placeholder="{{EventType}}"
+                      defaultValue={props.query.Annotation?.Title}
+                      onBlur={(e) => onChangeAnnotation({ Title: e.currentTarget.value })}
+                    />
+                  </InlineField>
+                </InlineFieldRow>
+                <InlineFieldRow>
+                  <InlineField label="Text" grow labelWidth={labelWidth} tooltip="Template of the annotation text">
+                    <Input
+                      placeholder="{{AssetPath}}"
+                      defaultValue={props.query.Annotation?.Text}
+                      onBlur={(e) => onChangeAnnotation({ Text: e.currentTarget.value })}
+                    />
+                  </InlineField>
+                </InlineFieldRow>
+              </>
+            )}
+            {props.query.Type === SummaryQueryType && (
+              <InlineFieldRow>
+                <InlineField
+                  label="Group by"
+                  grow
+                  labelWidth={labelWidth}
+                  tooltip="Group the events by event columns or simple property names, prefix with Parent_ to group by the parent event. Defaults to EventType"
+                >
+                  <MultiSelect
+                    value={props.query.GroupBy ?? []}
+                    options={groupByOptions()}
+                    allowCustomValue
+                    onChange={onChangeGroupBy}
+                  />
+                </InlineField>
+              </InlineFieldRow>
+            )}
+            {props.query.Type === PropertyType.Simple && (
+              <InlineFieldRow>
+                <InlineField
+                  label="Child events"
+                  grow
+                  labelWidth={labelWidth}
+                  tooltip="Also return the child events of these event types, as separate frames linked by ParentEventUUID"
+                >
+                  <MultiSelect
+                    value={props.query.ChildEvents?.EventTypes ?? []}
+                    options={childEventTypeOptions()}
+                    allowCustomValue
+                    onChange={onChangeChildEventTypes}
+                  />
+                </InlineField>
+                {props.query.ChildEvents && (
+                  <InlineField
+                    label="Aggregate"
+                    tooltip="Add the number and total duration of the child events per event type as columns to their parent instead"
+                  >
+                    <InlineSwitch value={props.query.ChildEvents.Aggregate} onChange={onChangeChildEventsAggregate} />
+                  </InlineField>
+                )}
+              </InlineFieldRow>
+            )}
             <InlineFieldRow>
               <InlineField label="Override time range" labelWidth={labelWidth}>
                 <div>
@@ -178,7 +404,7 @@ export const Events = (props: Props): JSX.Element => {
             <InlineFieldRow>
               <InlineField
                 label="Limit"
-                tooltip="Limit the number of events returned, 0 for no limit"
+                tooltip="Limit the number of events returned, 0 for no limit. At most 100000 events are returned"
                 labelWidth={labelWidth}
               >
                 <Input
@@ -211,6 +437,22 @@ export const Events = (props: Props): JSX.Element => {
                 <InlineSwitch value={props.query.QueryAssetProperties} onChange={onChangeQueryAssetProperties} />
               </InlineField>
             </InlineFieldRow>
+            {props.query.QueryAssetProperties && props.query.Type === PropertyType.Simple && (
+              <InlineFieldRow>
+                <InlineField
+                  label="Aggregations"
+                  grow
+                  labelWidth={labelWidth}
+                  tooltip="Aggregate every asset property in several ways during each event, each aggregation becomes a separate column. Leave empty to use the aggregation of the query options"
+                >
+                  <MultiSelect
+                    value={(props.query.AssetPropertyAggregations ?? []).map((e) => e.Name)}
+                    options={getAggregationsForDatatypes(props.query.Options?.Datatypes ?? [])}
+                    onChange={onChangeAssetPropertyAggregations}
+                  />
+                </InlineField>
+              </InlineFieldRow>
+            )}
             {props.query.QueryAssetProperties && (
               <EventAssetProperties
                 appIsAlertingType={props.appIsAlertingType ?? false}
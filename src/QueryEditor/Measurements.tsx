@@ -212,6 +212,7 @@ export const Measurements = (props: Props): JSX.Element => {
             onChange={onChangeMeasurementQueryOptions}
             onChangeSeriesLimit={props.onChangeSeriesLimit}
             hideDatatypeFilter={!isFeatureEnabled(props.datasource.historianInfo?.Version ?? '', '7.0.0')}
+            showCalculation
           />
         </>
       )}
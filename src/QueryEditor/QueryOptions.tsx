@@ -18,15 +18,18 @@ import {
 } from '@grafana/ui'
 import { QueryTag, TagsSection } from 'components/TagsSection/TagsSection'
 import { GroupBySection } from 'components/GroupBySection/GroupBySection'
-import { getAggregationsForVersionAndDatatypes, getFillTypes, getPeriods, useDebounce } from './util'
+import { getAggregationsForDatatypes, getFillTypes, getPeriods, useDebounce } from './util'
 import {
   Aggregation,
+  AggregationName,
   Attributes,
+  Calculation,
   fieldWidth,
   FrameFormat,
   labelWidth,
   MeasurementDatatype,
   MeasurementQueryOptions,
+  Reducer,
   ValueFilter,
 } from 'types'
 import { isFeatureEnabled } from 'util/semver'
@@ -45,6 +48,7 @@ export interface Props {
   hideTagFilter?: boolean
   hideAdvancedOptions?: boolean
   hideDatatypeFilter?: boolean
+  showCalculation?: boolean
   aggregationRequired?: boolean
   templateVariables: Array<SelectableValue<string>>
   historianVersion: string
@@ -61,8 +65,13 @@ const datatypeOptions: Array<SelectableValue<string>> = Object.entries(Measureme
 const frameFormatOptions: Array<ComboboxOption<FrameFormat>> = [
   { label: 'Time series', value: FrameFormat.Auto },
   { label: 'Table', value: FrameFormat.Table },
+  { label: 'Numeric', value: FrameFormat.Numeric },
 ]
 
+const reducerOptions: Array<ComboboxOption<Reducer>> = Object.entries(Reducer).map(([label, value]) => {
+  return { label: label, value: value }
+})
+
 export const QueryOptions = (props: Props): JSX.Element => {
   const [periods, setPeriods] = useState(getPeriods())
   const [seriesLimit, setSeriesLimit] = useDebounce<number | string>(props.seriesLimit, 500, props.onChangeSeriesLimit)
@@ -86,7 +95,8 @@ export const QueryOptions = (props: Props): JSX.Element => {
     datatypes: string[],
     options: MeasurementQueryOptions
   ): Array<SelectableValue<string>> => {
-    const validAggregations = getAggregationsForVersionAndDatatypes(datatypes, props.historianVersion)
+    // Aggregations older historians lack are computed by the datasource from the raw points
+    const validAggregations = getAggregationsForDatatypes(datatypes)
     if (
       options.Aggregation?.Name !== undefined &&
       options.Aggregation?.Name !== 'last' &&
@@ -163,6 +173,15 @@ export const QueryOptions = (props: Props): JSX.Element => {
     onPeriodChange(customValue)
   }
 
+  const onStateChange = (event: React.FocusEvent<HTMLInputElement>): void => {
+    const aggregation = {
+      ...props.state.Aggregation,
+      Arguments: event.currentTarget.value ? [event.currentTarget.value] : undefined,
+    } as Aggregation
+
+    props.onChange({ ...props.state, Aggregation: aggregation })
+  }
+
   const onFillChange = (selected: SelectableValue<string>): void => {
     const aggregation = {
       ...props.state.Aggregation,
@@ -231,6 +250,19 @@ export const QueryOptions = (props: Props): JSX.Element => {
     props.onChange({ ...props.state, FrameFormat: option?.value ?? FrameFormat.Auto })
   }
 
+  const onChangeReducer = (option: ComboboxOption<Reducer> | null): void => {
+    props.onChange({ ...props.state, Reducer: option?.value ?? Reducer.Last })
+  }
+
+  const onChangeCalculation = (changes: Partial<Calculation>): void => {
+    const calculation = { Expression: '', Aliases: {}, ...props.state.Calculation, ...changes }
+    props.onChange({ ...props.state, Calculation: calculation.Expression ? calculation : undefined })
+  }
+
+  const onChangeCalculationAliases = (event: React.FocusEvent<HTMLInputElement>): void => {
+    onChangeCalculation({ Aliases: parseAliases(event.currentTarget.value) })
+  }
+
   return (
     <>
       <InlineFieldRow>
@@ -267,6 +299,16 @@ export const QueryOptions = (props: Props): JSX.Element => {
                   />
                 </InlineField>
               )}
+              {props.state.Aggregation?.Name === AggregationName.DurationInState && (
+                <InlineField tooltip="The state value to measure the time spent in. The result is in seconds.">
+                  <Input
+                    defaultValue={props.state.Aggregation.Arguments?.[0]}
+                    placeholder="state"
+                    onBlur={onStateChange}
+                    width={fieldWidth}
+                  />
+                </InlineField>
+              )}
               {!props.hideFill && props.state.Aggregation?.Period && (
                 <InlineField>
                   <Select
@@ -452,7 +494,7 @@ export const QueryOptions = (props: Props): JSX.Element => {
               <InlineField
                 label="Format as"
                 labelWidth={labelWidth}
-                tooltip="Default is time series for panel rendering. Pick Table for a flat tabular shape required for SQL expressions on string or bool measurements. Table mode supports single-series queries only — multi-series queries will fail at the SQL expression step."
+                tooltip="Default is time series for panel rendering. Pick Table for a flat tabular shape required for SQL expressions on string or bool measurements. Table mode supports single-series queries only — multi-series queries will fail at the SQL expression step. Pick Numeric to reduce every series to a single value, as alert rules expect."
               >
                 <Combobox
                   value={props.state.FrameFormat ?? FrameFormat.Auto}
@@ -462,9 +504,94 @@ export const QueryOptions = (props: Props): JSX.Element => {
                 />
               </InlineField>
             </InlineFieldRow>
+            {props.state.FrameFormat === FrameFormat.Numeric && (
+              <InlineFieldRow>
+                <InlineField
+                  label="Reduce"
+                  labelWidth={labelWidth}
+                  tooltip="How every series is reduced to a single value. Bool values count as 1 and 0, strings that are not a number are skipped."
+                >
+                  <Combobox
+                    value={props.state.Reducer ?? Reducer.Last}
+                    options={reducerOptions}
+                    onChange={onChangeReducer}
+                    width={fieldWidth}
+                  />
+                </InlineField>
+              </InlineFieldRow>
+            )}
+            {props.showCalculation && (
+              <>
+                <InlineFieldRow>
+                  <InlineField
+                    label="Calculation"
+                    labelWidth={labelWidth}
+                    tooltip="Derive a single series from the queried measurements, e.g. (a - b) / b * 100. Supports + - * / %, parentheses and abs, sqrt, log, log10, exp, round, floor, ceil, pow, min and max. Requires an aggregation, values are matched per aggregation period."
+                  >
+                    <Input
+                      defaultValue={props.state.Calculation?.Expression}
+                      placeholder="(a - b) / b * 100"
+                      onBlur={(e) => onChangeCalculation({ Expression: e.currentTarget.value.trim() })}
+                      width={fieldWidth}
+                    />
+                  </InlineField>
+                </InlineFieldRow>
+                {props.state.Calculation?.Expression && (
+                  <>
+                    <InlineFieldRow>
+                      <InlineField
+                        label="Aliases"
+                        labelWidth={labelWidth}
+                        tooltip="The measurement every alias in the expression refers to, by name or UUID, e.g. a=Flow in, b=Flow out"
+                      >
+                        <Input
+                          defaultValue={formatAliases(props.state.Calculation.Aliases)}
+                          placeholder="a=measurement, b=measurement"
+                          onBlur={onChangeCalculationAliases}
+                          width={fieldWidth}
+                        />
+                      </InlineField>
+                    </InlineFieldRow>
+                    <InlineFieldRow>
+                      <InlineField label="Name" labelWidth={labelWidth} tooltip="The name of the calculated series">
+                        <Input
+                          defaultValue={props.state.Calculation.Name}
+                          placeholder={props.state.Calculation.Expression}
+                          onBlur={(e) => onChangeCalculation({ Name: e.currentTarget.value })}
+                          width={fieldWidth}
+                        />
+                      </InlineField>
+                      <InlineField label="Unit" tooltip="The unit of the calculated series">
+                        <Input
+                          defaultValue={props.state.Calculation.Unit}
+                          onBlur={(e) => onChangeCalculation({ Unit: e.currentTarget.value })}
+                        />
+                      </InlineField>
+                    </InlineFieldRow>
+                  </>
+                )}
+              </>
+            )}
           </ControlledCollapse>
         </>
       )}
     </>
   )
 }
+
+function parseAliases(value: string): Record<string, string> {
+  const aliases: Record<string, string> = {}
+  for (const part of value.split(',')) {
+    const [alias, ...measurement] = part.split('=')
+    if (alias.trim() && measurement.length > 0) {
+      aliases[alias.trim()] = measurement.join('=').trim()
+    }
+  }
+  return aliases
+}
+
+function formatAliases(aliases: Record<string, string>): string {
+  return Object.entries(aliases)
+    .map(([alias, measurement]) => `${alias}=${measurement}`)
+    .join(', ')
+}
@@ -83,7 +83,7 @@ export const RawQueryEditor = (props: Props): JSX.Element => {
                 label={`${getTimeseriesDatabaseType(props.query.TimeseriesDatabase)} query`}
                 grow
                 labelWidth={labelWidth}
-                tooltip=""
+                tooltip="Supported macros: $__timeFilter, $__timeFrom, $__timeTo, $__interval, $__interval_ms, $__rate_interval and $__timeGroup(column, interval)"
               >
                 <CodeEditor
                   height={'200px'}
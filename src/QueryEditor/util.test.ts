@@ -2,7 +2,6 @@ import {
   debouncePromise,
   getAggregations,
   getAggregationsForDatatypes,
-  getAggregationsForVersionAndDatatypes,
   matchedAssets,
   migrateMeasurementQuery,
   propertyFilterToQueryTags,
@@ -67,6 +66,8 @@ describe('getAggregationsForDatatypes', () => {
     expect(values).toContain('first')
     expect(values).toContain('last')
     expect(values).toContain('mode')
+    expect(values).toContain('duration_in_state')
+    expect(values).toContain('state_duration')
     expect(values).not.toContain('mean')
     expect(values).not.toContain('sum')
   })
@@ -96,23 +97,6 @@ describe('getAggregationsForDatatypes', () => {
   })
 })
 
-describe('getAggregationsForVersionAndDatatypes', () => {
-  it('excludes twa for versions before 7.3.0', () => {
-    const result = getAggregationsForVersionAndDatatypes([], '7.2.0')
-    expect(result.map((r) => r.value)).not.toContain('twa')
-  })
-
-  it('includes twa for version 7.3.0', () => {
-    const result = getAggregationsForVersionAndDatatypes([], '7.3.0')
-    expect(result.map((r) => r.value)).toContain('twa')
-  })
-
-  it('includes twa for versions after 7.3.0', () => {
-    const result = getAggregationsForVersionAndDatatypes([], '8.0.0')
-    expect(result.map((r) => r.value)).toContain('twa')
-  })
-})
-
 describe('tagsToQueryTags', () => {
   it('converts attributes to query tags', () => {
     const result = tagsToQueryTags({ status: 'Good', region: 'EU' })
@@ -38,17 +38,6 @@ export function getAggregations(): Array<SelectableValue<string>> {
   })
 }
 
-export function getAggregationsForVersionAndDatatypes(
-  datatypes: string[],
-  version: string
-): Array<SelectableValue<string>> {
-  let selectable = getAggregationsForDatatypes(datatypes)
-  if (!isFeatureEnabled(version, '7.3.0', true)) {
-    return selectable.filter((aggregation) => aggregation.value !== 'twa')
-  }
-  return selectable
-}
-
 export function getAggregationsForDatatypes(datatypes: string[]): Array<SelectableValue<string>> {
   let aggregations = Object.values(AggregationName)
 
@@ -80,8 +69,9 @@ function getMostRestrictiveDatatype(datatypes: string[]): string {
 }
 
 const validAggregationsForNumber: string[] = Object.values(AggregationName) // all aggregations are valid for numbers
-const validAggregationsForString: string[] = ['count', 'first', 'last', 'mode']
-const validAggregationsForBoolean: string[] = ['count', 'first', 'last', 'mode', 'min', 'max']
+const stateAggregations: string[] = ['duration_in_state', 'percent_good', 'state_duration', 'state_count', 'state_at_start']
+const validAggregationsForString: string[] = ['count', 'first', 'last', 'mode', ...stateAggregations]
+const validAggregationsForBoolean: string[] = ['count', 'first', 'last', 'mode', 'min', 'max', ...stateAggregations]
 const validAggregationsForArray: string[] = ['count', 'first', 'last']
 
 function isValidAggregationForDatatypes(aggregation: string, datatype: string): boolean {
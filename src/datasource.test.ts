@@ -1,6 +1,7 @@
 import { DataSource } from './datasource'
-import { DataSourceInstanceSettings, ScopedVars } from '@grafana/data'
-import { TemplateSrv } from '@grafana/runtime'
+import { DataQueryRequest, DataSourceInstanceSettings, LiveChannelScope, ScopedVars } from '@grafana/data'
+import { DataSourceWithBackend, TemplateSrv } from '@grafana/runtime'
+import { of } from 'rxjs'
 import {
   EventQuery,
   HistorianDataSourceOptions,
@@ -10,6 +11,13 @@ import {
   TabIndex,
 } from './types'
 
+const mockGetDataStream = jest.fn()
+
+jest.mock('@grafana/runtime', () => ({
+  ...jest.requireActual('@grafana/runtime'),
+  getGrafanaLiveSrv: () => ({ getDataStream: mockGetDataStream }),
+}))
+
 const TEMPLATE_VARIABLE_PATTERN =
   /\$\{([_a-zA-Z][_a-zA-Z0-9]*)(?::[a-zA-Z0-9_]+)?\}|\$([_a-zA-Z][_a-zA-Z0-9]*)|\[\[([_a-zA-Z][_a-zA-Z0-9]*)(?::[a-zA-Z0-9_]+)?\]\]/
 const TEMPLATE_VARIABLE_GLOBAL_RE = new RegExp(TEMPLATE_VARIABLE_PATTERN, 'g')
@@ -261,3 +269,111 @@ describe('DataSource.applyTemplateVariables', () => {
     })
   })
 })
+
+// ---------------------------------------------------------------------------
+// query — live streaming
+// ---------------------------------------------------------------------------
+
+describe('DataSource.query', () => {
+  function makeRequest(targets: Query[]): DataQueryRequest<Query> {
+    return { requestId: 'Q1', targets, scopedVars: {} } as unknown as DataQueryRequest<Query>
+  }
+
+  beforeEach(() => {
+    mockGetDataStream.mockReset()
+    mockGetDataStream.mockReturnValue(of({ data: [] }))
+  })
+
+  afterEach(() => {
+    jest.restoreAllMocks()
+  })
+
+  it('subscribes to live queries through Grafana Live', () => {
+    const ds = makeDataSource(makeTemplateSrv({ measurement: 'Flow' }))
+    const query = makeMeasurementQuery()
+    query.Measurements = ['$measurement']
+
+    ds.query(makeRequest([makeQuery({ live: true, query })]))
+
+    expect(mockGetDataStream).toHaveBeenCalledTimes(1)
+    const { addr, key } = mockGetDataStream.mock.calls[0][0]
+    expect(key).toBe('Q1.A')
+    expect(addr.scope).toBe(LiveChannelScope.DataSource)
+    expect(addr.namespace).toBe('test')
+    expect(addr.path).toMatch(/^MeasurementQuery\/[0-9a-f]{16}$/)
+    expect(addr.data.seriesLimit).toBe(50)
+    expect((addr.data.query as MeasurementQuery).Measurements).toEqual(['Flow'])
+  })
+
+  it('names the channel after the resolved query', () => {
+    const ds = makeDataSource(makeTemplateSrv({}))
+    const flow = makeMeasurementQuery()
+    flow.Measurements = ['Flow']
+    const level = makeMeasurementQuery()
+    level.Measurements = ['Level']
+
+    ds.query(makeRequest([makeQuery({ live: true, query: flow })]))
+    ds.query(makeRequest([makeQuery({ live: true, query: flow })]))
+    ds.query(makeRequest([makeQuery({ live: true, query: level })]))
+
+    const paths = mockGetDataStream.mock.calls.map((call) => call[0].addr.path)
+    expect(paths[0]).toBe(paths[1])
+    expect(paths[0]).not.toBe(paths[2])
+  })
+
+  it('queries the other targets through the backend', () => {
+    const backendQuery = jest.spyOn(DataSourceWithBackend.prototype, 'query').mockReturnValue(of({ data: [] }))
+    const ds = makeDataSource(makeTemplateSrv({}))
+    const live = makeQuery({ refId: 'A', live: true })
+    const polled = makeQuery({ refId: 'B' })
+    const events = makeQuery({ refId: 'C', live: true, queryType: 'EventQuery', query: makeEventQuery() })
+
+    ds.query(makeRequest([live, polled, events]))
+
+    expect(mockGetDataStream).toHaveBeenCalledTimes(1)
+    expect(backendQuery).toHaveBeenCalledTimes(1)
+    expect(backendQuery.mock.calls[0][0].targets).toEqual([polled, events])
+  })
+
+  it('does not stream hidden queries', () => {
+    const backendQuery = jest.spyOn(DataSourceWithBackend.prototype, 'query').mockReturnValue(of({ data: [] }))
+    const ds = makeDataSource(makeTemplateSrv({}))
+
+    ds.query(makeRequest([makeQuery({ live: true, hide: true })]))
+
+    expect(mockGetDataStream).not.toHaveBeenCalled()
+    expect(backendQuery).toHaveBeenCalledTimes(1)
+  })
+})
+
+// ---------------------------------------------------------------------------
+// metadata lookups — backend cache bypass
+// ---------------------------------------------------------------------------
+
+describe('DataSource metadata lookups', () => {
+  afterEach(() => {
+    jest.restoreAllMocks()
+  })
+
+  it('use the backend metadata cache when no query editor is open', async () => {
+    const getResource = jest.spyOn(DataSourceWithBackend.prototype, 'getResource').mockResolvedValue([])
+    const ds = makeDataSource(makeTemplateSrv({}))
+
+    await ds.getAssets({ Keyword: 'Line' })
+
+    expect(getResource).toHaveBeenCalledWith('assets', { Keyword: 'Line' })
+  })
+
+  it('bypass the backend metadata cache while a query editor is open', async () => {
+    const getResource = jest.spyOn(DataSourceWithBackend.prototype, 'getResource').mockResolvedValue([])
+    const ds = makeDataSource(makeTemplateSrv({}))
+
+    ds.editorOpened()
+    await ds.getAssets({ Keyword: 'Line' })
+    ds.editorClosed()
+    await ds.getEventTypes()
+
+    expect(getResource).toHaveBeenNthCalledWith(1, 'assets', { Keyword: 'Line', noCache: true })
+    expect(getResource).toHaveBeenNthCalledWith(2, 'event-types', {})
+  })
+})
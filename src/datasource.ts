@@ -1,5 +1,15 @@
-import { type AdHocVariableFilter, CoreApp, DataSourceInstanceSettings, dateTime, ScopedVars } from '@grafana/data'
-import { DataSourceWithBackend, TemplateSrv, getTemplateSrv } from '@grafana/runtime'
+import {
+  type AdHocVariableFilter,
+  CoreApp,
+  DataQueryRequest,
+  DataQueryResponse,
+  DataSourceInstanceSettings,
+  dateTime,
+  LiveChannelScope,
+  ScopedVars,
+} from '@grafana/data'
+import { DataSourceWithBackend, TemplateSrv, getGrafanaLiveSrv, getTemplateSrv } from '@grafana/runtime'
+import { merge, Observable } from 'rxjs'
 import { VariableSupport } from 'variable_support'
 import { AnnotationsQueryEditor } from 'AnnotationsQueryEditor/AnnotationsQueryEditor'
 import {
@@ -42,6 +52,9 @@ export class DataSource extends DataSourceWithBackend<Query, HistorianDataSource
   private metadataCache = new Map<string, { data: unknown; timestamp: number; timeoutId: number }>()
   private cacheTTL = 5000 // 5 seconds
   private pendingRequests = new Map<string, Promise<unknown>>()
+  // While a query editor is open, metadata lookups bypass the metadata cache of the backend so newly
+  // created assets, measurements and event types show up
+  private openEditors = 0
 
   constructor(
     instanceSettings: DataSourceInstanceSettings<HistorianDataSourceOptions>,
@@ -55,6 +68,21 @@ export class DataSource extends DataSourceWithBackend<Query, HistorianDataSource
     }
   }
 
+  editorOpened(): void {
+    this.openEditors++
+  }
+
+  editorClosed(): void {
+    this.openEditors = Math.max(0, this.openEditors - 1)
+  }
+
+  private metadataResource<T = any>(path: string, params?: Record<string, unknown>): Promise<T> {
+    if (this.openEditors === 0) {
+      return this.getResource(path, params)
+    }
+    return this.getResource(path, { ...params, noCache: true })
+  }
+
   private async cachedRequest<T>(key: string, fetcher: () => Promise<T>): Promise<T> {
     // Check cache
     const cached = this.metadataCache.get(key)
@@ -87,6 +115,49 @@ export class DataSource extends DataSourceWithBackend<Query, HistorianDataSource
       })
   }
 
+  query(request: DataQueryRequest<Query>): Observable<DataQueryResponse> {
+    const liveTargets = request.targets.filter((target) => this.isLiveQuery(target))
+    if (liveTargets.length === 0) {
+      return super.query(request)
+    }
+
+    const responses = liveTargets.map((target) => this.streamQuery(target, request))
+    const targets = request.targets.filter((target) => !this.isLiveQuery(target))
+    if (targets.length > 0) {
+      responses.push(super.query({ ...request, targets }))
+    }
+    return merge(...responses)
+  }
+
+  supportsLive(target: Query): boolean {
+    return target.queryType === 'MeasurementQuery' || target.queryType === 'AssetMeasurementQuery'
+  }
+
+  isLiveQuery(target: Query): boolean {
+    return target.live === true && !target.hide && this.filterQuery(target) && this.supportsLive(target)
+  }
+
+  // Subscribes to the backend stream of the query, the channel path is unique per resolved query so panels
+  // showing the same query share a stream
+  private streamQuery(target: Query, request: DataQueryRequest<Query>): Observable<DataQueryResponse> {
+    const resolved = this.applyTemplateVariables(target, request.scopedVars)
+    const data = {
+      historianInfo: resolved.historianInfo,
+      query: resolved.query,
+      seriesLimit: resolved.seriesLimit,
+    }
+
+    return getGrafanaLiveSrv().getDataStream({
+      key: `${request.requestId}.${target.refId}`,
+      addr: {
+        scope: LiveChannelScope.DataSource,
+        namespace: this.uid,
+        path: `${target.queryType}/${hashString(JSON.stringify(data))}`,
+        data,
+      },
+    })
+  }
+
   getDefaultQuery(app: CoreApp): Partial<Query> {
     return {
       seriesLimit: 50,
@@ -150,6 +221,11 @@ export class DataSource extends DataSourceWithBackend<Query, HistorianDataSource
     )
     eventQuery.PropertyFilter = this.replaceEventPropertyFilter(eventQuery.PropertyFilter, scopedVars)
     eventQuery.Limit = this.templatedNumber(eventQuery.Limit, 500, scopedVars)
+    if (eventQuery.ChildEvents) {
+      eventQuery.ChildEvents.EventTypes = eventQuery.ChildEvents.EventTypes.flatMap((e) =>
+        this.multiSelectReplace(e, scopedVars)
+      )
+    }
 
     if (eventQuery.QueryAssetProperties) {
       eventQuery.OverrideAssets = eventQuery.OverrideAssets?.filter((e) => e !== '').flatMap((e) =>
@@ -220,6 +296,20 @@ export class DataSource extends DataSourceWithBackend<Query, HistorianDataSource
               return e
             }
             e.Value = replacedValue
+          } else if (e.Operator === 'BETWEEN' || e.Operator === 'NOT BETWEEN') {
+            // The bounds of a range are separated by a comma, e.g. "10,20" or "$__from,$__to"
+            const bounds = this.templateSrv
+              .replace(String(e.Value), scopedVars)
+              .split(',')
+              .map((v) => v.trim())
+            e.Value = e.Datatype === PropertyDatatype.Number ? bounds.map(parseFloat) : bounds
+          } else if (
+            (e.Operator === '=' || e.Operator === '!=') &&
+            e.Datatype === PropertyDatatype.Number &&
+            this.containsTemplate(String(e.Value))
+          ) {
+            // Multi-value variables become several values, the backend turns them into an IN filter
+            e.Value = this.multiSelectReplace(String(e.Value), scopedVars).map(parseFloat)
           } else {
             switch (e.Datatype) {
               case PropertyDatatype.Number:
@@ -314,12 +404,12 @@ export class DataSource extends DataSourceWithBackend<Query, HistorianDataSource
 
   async getInfo(): Promise<void> {
     const cacheKey = 'info'
-    this.historianInfo = await this.cachedRequest(cacheKey, () => this.getResource('info'))
+    this.historianInfo = await this.cachedRequest(cacheKey, () => this.metadataResource('info'))
   }
 
   async getMeasurement(uuid: string): Promise<Measurement> {
     const cacheKey = `measurement:${uuid}`
-    return this.cachedRequest(cacheKey, () => this.getResource(`measurements/${uuid}`))
+    return this.cachedRequest(cacheKey, () => this.metadataResource(`measurements/${uuid}`))
   }
 
   async getMeasurements(filter: MeasurementFilter, pagination: Pagination): Promise<Measurement[]> {
@@ -338,12 +428,14 @@ export class DataSource extends DataSourceWithBackend<Query, HistorianDataSource
       params['page'] = pagination.Page
     }
     delete params.ScopedVars
-    return this.cachedRequest(`measurements:${JSON.stringify(params)}`, () => this.getResource('measurements', params))
+    return this.cachedRequest(`measurements:${JSON.stringify(params)}`, () =>
+      this.metadataResource('measurements', params)
+    )
   }
 
   async getCollectors(): Promise<Collector[]> {
     const cacheKey = 'collectors'
-    return this.cachedRequest(cacheKey, () => this.getResource('collectors'))
+    return this.cachedRequest(cacheKey, () => this.metadataResource('collectors'))
   }
 
   async getTimeseriesDatabases(filter?: TimeseriesDatabaseFilter): Promise<TimeseriesDatabase[]> {
@@ -356,7 +448,7 @@ export class DataSource extends DataSourceWithBackend<Query, HistorianDataSource
       delete params.ScopedVars
     }
     const cacheKey = `databases:${JSON.stringify(params)}`
-    return this.cachedRequest(cacheKey, () => this.getResource('databases', params))
+    return this.cachedRequest(cacheKey, () => this.metadataResource('databases', params))
   }
 
   async getAssets(filter?: AssetFilter): Promise<Asset[]> {
@@ -387,7 +479,7 @@ export class DataSource extends DataSourceWithBackend<Query, HistorianDataSource
       delete params.ScopedVars
     }
     const cacheKey = `assets:${JSON.stringify(params)}`
-    return this.cachedRequest(cacheKey, () => this.getResource('assets', params))
+    return this.cachedRequest(cacheKey, () => this.metadataResource('assets', params))
   }
 
   async getAssetProperties(filter?: AssetPropertyFilter): Promise<AssetProperty[]> {
@@ -402,7 +494,7 @@ export class DataSource extends DataSourceWithBackend<Query, HistorianDataSource
       delete params.ScopedVars
     }
     const cacheKey = `assetProperties:${JSON.stringify(params)}`
-    return this.cachedRequest(cacheKey, () => this.getResource('asset-properties', params))
+    return this.cachedRequest(cacheKey, () => this.metadataResource('asset-properties', params))
   }
 
   async getEventTypes(filter?: EventTypeFilter): Promise<EventType[]> {
@@ -418,7 +510,7 @@ export class DataSource extends DataSourceWithBackend<Query, HistorianDataSource
       delete params.ScopedVars
     }
     const cacheKey = `eventTypes:${JSON.stringify(params)}`
-    return this.cachedRequest(cacheKey, () => this.getResource('event-types', params))
+    return this.cachedRequest(cacheKey, () => this.metadataResource('event-types', params))
   }
 
   async getEventTypeProperties(filter?: EventTypePropertiesFilter): Promise<EventTypeProperty[]> {
@@ -438,17 +530,17 @@ export class DataSource extends DataSourceWithBackend<Query, HistorianDataSource
       delete params.ScopedVars
     }
     const cacheKey = `eventTypeProperties:${JSON.stringify(params)}`
-    return this.cachedRequest(cacheKey, () => this.getResource('event-type-properties', params))
+    return this.cachedRequest(cacheKey, () => this.metadataResource('event-type-properties', params))
   }
 
   async getEventConfigurations(): Promise<EventConfiguration[]> {
     const cacheKey = 'eventConfigurations'
-    return this.cachedRequest(cacheKey, () => this.getResource('event-configurations'))
+    return this.cachedRequest(cacheKey, () => this.metadataResource('event-configurations'))
   }
 
   async getTagKeysForMeasurement(measurement: string): Promise<string[]> {
     const cacheKey = `tagKeys:${measurement}`
-    return this.cachedRequest(cacheKey, () => this.getResource(`measurements/${measurement}/tags`))
+    return this.cachedRequest(cacheKey, () => this.metadataResource(`measurements/${measurement}/tags`))
   }
 
   async getTagKeysForMeasurements(filter: MeasurementFilter): Promise<string[]> {
@@ -461,12 +553,12 @@ export class DataSource extends DataSourceWithBackend<Query, HistorianDataSource
     }
     delete params.ScopedVars
     const cacheKey = `tagKeys:multi:${JSON.stringify(params)}`
-    return this.cachedRequest(cacheKey, () => this.getResource(`tags`, params))
+    return this.cachedRequest(cacheKey, () => this.metadataResource(`tags`, params))
   }
 
   async getTagValuesForMeasurement(measurement: string, key: string): Promise<string[]> {
     const cacheKey = `tagValues:${measurement}:${key}`
-    return this.cachedRequest(cacheKey, () => this.getResource(`measurements/${measurement}/tags/${key}`))
+    return this.cachedRequest(cacheKey, () => this.metadataResource(`measurements/${measurement}/tags/${key}`))
   }
 
   async getTagValuesForMeasurements(filter: MeasurementFilter, key: string): Promise<string[]> {
@@ -479,7 +571,7 @@ export class DataSource extends DataSourceWithBackend<Query, HistorianDataSource
     }
     delete params.ScopedVars
     const cacheKey = `tagValues:multi:${key}:${JSON.stringify(params)}`
-    return this.cachedRequest(cacheKey, () => this.getResource(`tags/${key}`, params))
+    return this.cachedRequest(cacheKey, () => this.metadataResource(`tags/${key}`, params))
   }
 
   async getDistinctEventPropertyValues(filter: EventTypePropertiesValuesFilter): Promise<string[]> {
@@ -514,7 +606,7 @@ export class DataSource extends DataSourceWithBackend<Query, HistorianDataSource
       return Promise.resolve([])
     }
     return this.cachedRequest(`event-property-values:${JSON.stringify(params)}`, () =>
-      this.getResource(`event-property-values/${filter.EventFilter.Properties![0]}`, params)
+      this.metadataResource(`event-property-values/${filter.EventFilter.Properties![0]}`, params)
     )
   }
 
@@ -524,3 +616,15 @@ export class DataSource extends DataSourceWithBackend<Query, HistorianDataSource
     return typeof replaced === 'number' && !Number.isNaN(replaced) ? replaced : defaultValue
   }
 }
+
+// hashString returns a 64 bit hexadecimal hash of the value, used to name live channels
+export function hashString(value: string): string {
+  let h1 = 0xdeadbeef
+  let h2 = 0x41c6ce57
+  for (let i = 0; i < value.length; i++) {
+    const c = value.charCodeAt(i)
+    h1 = Math.imul(h1 ^ c, 2654435761)
+    h2 = Math.imul(h2 ^ c, 1597334677)
+  }
+  return (h1 >>> 0).toString(16).padStart(8, '0') + (h2 >>> 0).toString(16).padStart(8, '0')
+}
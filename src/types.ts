@@ -28,6 +28,8 @@ export interface Query extends DataQuery {
   selectedAssetPath?: string
   selectedAssetProperties?: string[]
   historianInfo?: HistorianInfo
+  // Streams new points through Grafana Live instead of querying the time range, measurement and asset queries only
+  live?: boolean
 }
 
 export const defaultQuery: Partial<Query> = {}
@@ -67,6 +69,11 @@ export enum AggregationName {
   Max = 'max',
   Min = 'min',
   TWA = 'twa',
+  DurationInState = 'duration_in_state',
+  PercentGood = 'percent_good',
+  StateDuration = 'state_duration',
+  StateCount = 'state_count',
+  StateAtStart = 'state_at_start',
 }
 
 export enum FillType {
@@ -87,6 +94,17 @@ export interface Aggregation {
 export enum FrameFormat {
   Auto = '',
   Table = 'table',
+  Numeric = 'numeric',
+}
+
+export enum Reducer {
+  Last = 'last',
+  First = 'first',
+  Min = 'min',
+  Max = 'max',
+  Mean = 'mean',
+  Sum = 'sum',
+  Count = 'count',
 }
 
 export interface MeasurementQueryOptions {
@@ -106,6 +124,15 @@ export interface MeasurementQueryOptions {
   Datatypes?: string[]
   Desc?: boolean
   FrameFormat?: FrameFormat
+  Reducer?: Reducer
+  Calculation?: Calculation
+}
+
+export interface Calculation {
+  Expression: string
+  Aliases: Record<string, string>
+  Name?: string
+  Unit?: string
 }
 
 export interface ValueFilter {
@@ -126,6 +153,8 @@ export interface AssetMeasurementQuery {
   Assets: string[]
   AssetProperties: string[]
   Options: MeasurementQueryOptions
+  Recursive?: boolean
+  MaxDepth?: number
 }
 
 export interface EventQuery {
@@ -140,12 +169,40 @@ export interface EventQuery {
   AssetProperties?: string[]
   Options?: MeasurementQueryOptions
   IncludeParentInfo?: boolean
+  ParentDepth?: number
+  ChildEvents?: EventChildren
   Limit?: number | string
   OverrideTimeRange: boolean
   TimeRange: TimeRange
   Ascending: boolean
+  Recursive?: boolean
+  MaxDepth?: number
+  GroupBy?: string[]
+  WallClockTime?: boolean
+  Envelope?: EventEnvelope
+  AssetPropertyAggregations?: Aggregation[]
+  Annotation?: EventAnnotation
+}
+
+export interface EventChildren {
+  EventTypes: string[]
+  Aggregate?: boolean
 }
 
+export interface EventAnnotation {
+  Title?: string
+  Text?: string
+}
+
+export interface EventEnvelope {
+  StdDevs?: number
+  ReferenceEventUUID?: string
+}
+
+export const SummaryQueryType = 'summary'
+export const ActiveQueryType = 'active'
+export const AnnotationQueryType = 'annotation'
+
 export interface TimeRange {
   from?: string | null
   fromParsed?: string | null
@@ -212,7 +269,7 @@ export interface OldEventTypePropertiesValuesFilter extends EventTypePropertiesV
 export interface EventPropertyFilter extends ResourceFilter {
   Property: string
   Datatype: string
-  Value?: string | number | boolean | string[]
+  Value?: string | number | boolean | string[] | number[]
   Operator: string
   Condition: string
   Parent: boolean
@@ -15,12 +15,22 @@ export type KnownOperator =
   | 'IS NOT NULL'
   | 'EXISTS'
   | 'NOT EXISTS'
+  | 'BETWEEN'
+  | 'NOT BETWEEN'
+  | 'LIKE'
+  | 'NOT LIKE'
 export type KnownCondition = 'AND' | 'OR'
 
 export const operatorsWithoutValue: KnownOperator[] = ['IS NULL', 'IS NOT NULL', 'EXISTS', 'NOT EXISTS']
 
 const basicOperators: KnownOperator[] = ['=', '!=', '<', '<=', '>', '>=']
 const v72Operators: KnownOperator[] = ['~', '!~', 'IN', 'NOT IN', 'IS NULL', 'IS NOT NULL', 'EXISTS', 'NOT EXISTS']
+// Operators the datasource evaluates on the returned events, they work with every historian version
+const datasourceOperators: KnownOperator[] = ['BETWEEN', 'NOT BETWEEN', 'LIKE', 'NOT LIKE']
+const comparisonOperators: KnownOperator[] = ['<', '<=', '>', '>=', 'BETWEEN', 'NOT BETWEEN']
+
+// Datatype of property filters that compare timestamps, e.g. a string property against $__from
+export const dateDatatype = 'date'
 
 export function needsValue(operator: KnownOperator): boolean {
   return !operatorsWithoutValue.includes(operator)
@@ -32,5 +42,15 @@ export function getValueFilterOperatorsForVersion(version: string): KnownOperato
     operators = operators.concat(v72Operators)
   }
 
-  return operators
+  return operators.concat(datasourceOperators)
+}
+
+// isDateComparison returns whether the filter compares its value as a timestamp, which is the case for comparisons
+// against Grafana's time range variables or RFC 3339 timestamps
+export function isDateComparison(operator: KnownOperator, value: string | undefined): boolean {
+  if (!comparisonOperators.includes(operator) || !value) {
+    return false
+  }
+
+  return /\$\{?__(from|to)\b/.test(value) || /^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}/.test(value)
 }